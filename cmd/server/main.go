@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/generator"
 	"github.com/denys-rosario/settlement-reconciler/internal/handler"
+	"github.com/denys-rosario/settlement-reconciler/internal/jobs"
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
 	"github.com/denys-rosario/settlement-reconciler/internal/reconciler"
 	"github.com/denys-rosario/settlement-reconciler/internal/store"
@@ -23,9 +27,16 @@ func main() {
 
 	// Initialize components.
 	cfg := models.DefaultConfig()
-	s := store.New()
+	s, err := openStore()
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
 	rec := reconciler.New(s, cfg)
-	h := handler.New(s, rec, cfg)
+	pool := jobs.New(envInt("RECONCILE_WORKERS", 2), envInt("RECONCILE_QUEUE_SIZE", 100))
+	h := handler.New(s, rec, cfg, pool)
+	if err := h.FailInterruptedRuns(); err != nil {
+		log.Fatalf("Failed to recover interrupted runs: %v", err)
+	}
 
 	// Register routes.
 	mux := http.NewServeMux()
@@ -35,18 +46,46 @@ func main() {
 	if len(os.Args) > 1 && os.Args[1] == "--seed-data" {
 		log.Println("Seeding test data...")
 		txns, setts := generator.GenerateTestData(42)
-		s.AddTransactions(txns)
-		s.AddSettlements(setts)
+		if _, err := s.AddTransactions(txns); err != nil {
+			log.Fatalf("Failed to seed transactions: %v", err)
+		}
+		if _, err := s.AddSettlements(setts); err != nil {
+			log.Fatalf("Failed to seed settlements: %v", err)
+		}
 		log.Printf("Loaded %d transactions and %d settlements", len(txns), len(setts))
 
 		// Run reconciliation and write report to testdata/.
-		report := rec.Run("SEED-0001")
+		in, err := rec.LoadInputs()
+		if err != nil {
+			log.Fatalf("Seed reconciliation failed: %v", err)
+		}
+		snap, err := reconciler.NewSnapshot(cfg, in)
+		if err != nil {
+			log.Fatalf("Seed reconciliation failed: %v", err)
+		}
+		// The seed data is deterministic, so inputs kept from an earlier seeding are identical.
+		if err := s.SaveRunInputs("SEED-0001", in); err != nil && !errors.Is(err, store.ErrExists) {
+			log.Fatalf("Failed to save seed run inputs: %v", err)
+		}
+		report, err := rec.Reconcile(context.Background(), "SEED-0001", in, nil)
+		if err != nil {
+			log.Fatalf("Seed reconciliation failed: %v", err)
+		}
+		reportHash, err := reconciler.ReportHash(report)
+		if err != nil {
+			log.Fatalf("Seed reconciliation failed: %v", err)
+		}
 		run := &models.ReconciliationRun{
-			ID:     "SEED-0001",
-			Status: "completed",
-			Report: report,
+			ID:         "SEED-0001",
+			Status:     models.RunCompleted,
+			Progress:   100,
+			Snapshot:   snap,
+			ReportHash: reportHash,
+			Report:     report,
+		}
+		if err := s.SaveRun(run); err != nil {
+			log.Fatalf("Failed to save seed run: %v", err)
 		}
-		s.SaveRun(run)
 
 		// Write report to file.
 		f, err := os.Create("testdata/reconciliation_report.json")
@@ -86,6 +125,26 @@ func main() {
 	}
 }
 
+// envInt reads a positive integer from the environment, falling back to def.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// openStore returns a SQLite store when SQLITE_PATH is set, otherwise an in-memory one.
+func openStore() (store.Store, error) {
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		log.Println("Using in-memory store (set SQLITE_PATH to persist data)")
+		return store.New(), nil
+	}
+	log.Printf("Using SQLite store at %s", path)
+	return store.OpenSQLite(path)
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
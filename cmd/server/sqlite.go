@@ -0,0 +1,4 @@
+package main
+
+// Link the pure-Go SQLite driver so SQLITE_PATH can be used.
+import _ "modernc.org/sqlite"
@@ -2,11 +2,11 @@ package generator
 
 import (
 	"fmt"
-	"math"
 	"math/rand"
 	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
 )
 
 var (
@@ -45,16 +45,16 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		return fmt.Sprintf("ORD-%06d", txnID)
 	}
 
-	randomAmount := func() float64 {
+	randomAmount := func(currency string) money.Amount {
 		// Mix of small ($5-50), medium ($50-500), large ($500-5000)
 		r := rng.Float64()
 		switch {
 		case r < 0.4:
-			return math.Round((5+rng.Float64()*45)*100) / 100
+			return money.FromFloat(5 + rng.Float64()*45).Round(currency)
 		case r < 0.8:
-			return math.Round((50+rng.Float64()*450)*100) / 100
+			return money.FromFloat(50 + rng.Float64()*450).Round(currency)
 		default:
-			return math.Round((500+rng.Float64()*4500)*100) / 100
+			return money.FromFloat(500 + rng.Float64()*4500).Round(currency)
 		}
 	}
 
@@ -83,7 +83,7 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		proc := randomProcessor()
 		country := randomCountry()
 		currency := currencies[country]
-		amount := randomAmount()
+		amount := randomAmount(currency)
 		authDate := randomDate()
 		captureDate := authDate.Add(time.Duration(rng.Intn(24)) * time.Hour)
 		settleDate := captureDate.Add(time.Duration(1+rng.Intn(5)) * 24 * time.Hour)
@@ -110,7 +110,6 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 			ProcessorTxnID:    procTxnID,
 			OrderReference:    orderID,
 			GrossAmount:       amount,
-			FeeAmount:         0,
 			NetAmount:         amount,
 			Currency:          currency,
 			SettledAt:         settleDate,
@@ -125,7 +124,7 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		proc := randomProcessor()
 		country := randomCountry()
 		currency := currencies[country]
-		amount := randomAmount()
+		amount := randomAmount(currency)
 		authDate := randomDate()
 		captureDate := authDate.Add(time.Duration(rng.Intn(24)) * time.Hour)
 		settleDate := captureDate.Add(time.Duration(1+rng.Intn(5)) * 24 * time.Hour)
@@ -148,23 +147,25 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 
 		// Vary the settlement amount: fee deduction, partial capture, or FX difference
 		varianceType := rng.Intn(3)
-		var grossAmount, feeAmount float64
+		var grossAmount, feeAmount money.Amount
 		var notes string
 		switch varianceType {
 		case 0: // Fee deduction — gross matches, but net is lower
 			feePercent := 0.02 + rng.Float64()*0.03 // 2-5% fee
-			feeAmount = math.Round(amount*feePercent*100) / 100
+			feeAmount = amount.MulRate(feePercent).Round(currency)
 			grossAmount = amount
 			notes = "fee_deduction"
-		case 1: // Partial capture — gross is less than auth amount
+		case 1: // Partial capture — only part of the auth amount is captured and settled
 			partialPct := 0.5 + rng.Float64()*0.4 // 50-90%
-			grossAmount = math.Round(amount*partialPct*100) / 100
-			feeAmount = math.Round(grossAmount*0.025*100) / 100
+			grossAmount = amount.MulRate(partialPct).Round(currency)
+			feeAmount = grossAmount.MulRate(0.025).Round(currency)
+			captured := grossAmount
+			transactions[len(transactions)-1].CapturedAmount = &captured
 			notes = "partial_capture"
 		case 2: // Small FX/rounding difference
-			diff := (rng.Float64()*2 - 1) * amount * 0.03 // ±3%
-			grossAmount = math.Round((amount+diff)*100) / 100
-			feeAmount = math.Round(grossAmount*0.02*100) / 100
+			diffPct := (rng.Float64()*2 - 1) * 0.03 // ±3%
+			grossAmount = amount.MulRate(1 + diffPct).Round(currency)
+			feeAmount = grossAmount.MulRate(0.02).Round(currency)
 			notes = "fx_rounding"
 		}
 		_ = notes
@@ -176,7 +177,7 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 			OrderReference:    orderID,
 			GrossAmount:       grossAmount,
 			FeeAmount:         feeAmount,
-			NetAmount:         math.Round((grossAmount-feeAmount)*100) / 100,
+			NetAmount:         grossAmount.Sub(feeAmount),
 			Currency:          currency,
 			SettledAt:         settleDate,
 			SettlementBatchID: batchID(settleDate),
@@ -190,7 +191,7 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		proc := randomProcessor()
 		country := randomCountry()
 		currency := currencies[country]
-		amount := randomAmount()
+		amount := randomAmount(currency)
 		authDate := randomDate()
 
 		status := "captured"
@@ -223,7 +224,8 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		proc := randomProcessor()
 		country := randomCountry()
 		currency := currencies[country]
-		amount := randomAmount()
+		amount := randomAmount(currency)
+		fee := amount.MulRate(0.025).Round(currency)
 		settleDate := randomDate().Add(time.Duration(3+rng.Intn(5)) * 24 * time.Hour)
 
 		settlements = append(settlements, models.SettlementRecord{
@@ -232,8 +234,8 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 			ProcessorTxnID:    fmt.Sprintf("%s-UNKNOWN-%04d", proc[:3], i+1),
 			OrderReference:    fmt.Sprintf("EXT-ORD-%04d", i+1),
 			GrossAmount:       amount,
-			FeeAmount:         math.Round(amount*0.025*100) / 100,
-			NetAmount:         math.Round(amount*0.975*100) / 100,
+			FeeAmount:         fee,
+			NetAmount:         amount.Sub(fee),
 			Currency:          currency,
 			SettledAt:         settleDate,
 			SettlementBatchID: batchID(settleDate),
@@ -253,7 +255,6 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 			ProcessorTxnID:    srcTxn.ProcessorTxnID,
 			OrderReference:    srcTxn.OrderID,
 			GrossAmount:       srcTxn.Amount,
-			FeeAmount:         0,
 			NetAmount:         srcTxn.Amount,
 			Currency:          srcTxn.Currency,
 			SettledAt:         settleDate,
@@ -266,7 +267,7 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 		id := nextTxnID()
 		orderID := nextOrderID()
 		proc := processors[rng.Intn(len(processors))]
-		amount := randomAmount()
+		amount := randomAmount("USD")
 		authDate := randomDate()
 		captureDate := authDate.Add(time.Duration(rng.Intn(24)) * time.Hour)
 		settleDate := captureDate.Add(time.Duration(1+rng.Intn(5)) * 24 * time.Hour)
@@ -296,7 +297,6 @@ func GenerateTestData(seed int64) ([]models.Transaction, []models.SettlementReco
 			ProcessorTxnID:    procTxnID,
 			OrderReference:    orderID,
 			GrossAmount:       amount,
-			FeeAmount:         0,
 			NetAmount:         amount,
 			Currency:          "USD",
 			SettledAt:         settleDate,
@@ -1,27 +1,47 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/generator"
+	"github.com/denys-rosario/settlement-reconciler/internal/ingest"
+	"github.com/denys-rosario/settlement-reconciler/internal/jobs"
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
 	"github.com/denys-rosario/settlement-reconciler/internal/reconciler"
+	"github.com/denys-rosario/settlement-reconciler/internal/report"
 	"github.com/denys-rosario/settlement-reconciler/internal/store"
 )
 
 // Handler holds dependencies for HTTP request handling.
 type Handler struct {
-	store      *store.Store
+	store store.Store
+	jobs  *jobs.Pool
+
+	mu         sync.Mutex // guards the fields below
 	reconciler *reconciler.Reconciler
 	config     models.ReconciliationConfig
 	runSeq     int
 }
 
-func New(s *store.Store, r *reconciler.Reconciler, cfg models.ReconciliationConfig) *Handler {
-	return &Handler{store: s, reconciler: r, config: cfg}
+// New returns a Handler that queues reconciliation runs on pool.
+func New(s store.Store, r *reconciler.Reconciler, cfg models.ReconciliationConfig, pool *jobs.Pool) *Handler {
+	return &Handler{store: s, jobs: pool, reconciler: r, config: cfg}
 }
 
 // RegisterRoutes wires all endpoints onto the given mux.
@@ -33,12 +53,20 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Data ingestion
 	mux.HandleFunc("POST /api/v1/transactions", h.uploadTransactions)
 	mux.HandleFunc("POST /api/v1/settlements", h.uploadSettlements)
+	mux.HandleFunc("POST /api/v1/processors/{name}/settlement-files", h.uploadProcessorSettlementFile)
+	mux.HandleFunc("POST /api/v1/fx-rates", h.uploadFXRates)
+	mux.HandleFunc("GET /api/v1/fx-rates", h.listFXRates)
 
 	// Reconciliation
 	mux.HandleFunc("POST /api/v1/reconciliation/run", h.triggerReconciliation)
 	mux.HandleFunc("GET /api/v1/reconciliation/runs", h.listRuns)
 	mux.HandleFunc("GET /api/v1/reconciliation/runs/{runID}", h.getRun)
 	mux.HandleFunc("GET /api/v1/reconciliation/runs/{runID}/report", h.getReport)
+	mux.HandleFunc("GET /api/v1/reconciliation/runs/{runID}/report.html", h.getReportHTML)
+	mux.HandleFunc("GET /api/v1/reconciliation/runs/{runID}/results", h.queryResults)
+	mux.HandleFunc("POST /api/v1/reconciliation/runs/{runID}/cancel", h.cancelRun)
+	mux.HandleFunc("POST /api/v1/reconciliation/runs/{runID}/replay", h.replayRun)
+	mux.HandleFunc("GET /api/v1/reconciliation/runs/{runID}/diff", h.diffRuns)
 
 	// Query
 	mux.HandleFunc("GET /api/v1/transactions/{txnID}/reconciliation", h.getTransactionReconciliation)
@@ -46,6 +74,7 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Configuration
 	mux.HandleFunc("GET /api/v1/config", h.getConfig)
 	mux.HandleFunc("PUT /api/v1/config", h.updateConfig)
+	mux.HandleFunc("POST /api/v1/config/reference-rules/dry-run", h.dryRunReferenceRules)
 
 	// Test data
 	mux.HandleFunc("POST /api/v1/test-data/generate", h.generateTestData)
@@ -55,23 +84,32 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 
 func (h *Handler) index(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
-		"service":     "AuraCommerce Settlement Reconciliation Service",
-		"version":     "1.0.0",
-		"status":      "running",
-		"docs":        "/docs",
-		"health":      "/health",
-		"api_base":    "/api/v1",
+		"service":  "AuraCommerce Settlement Reconciliation Service",
+		"version":  "1.0.0",
+		"status":   "running",
+		"docs":     "/docs",
+		"health":   "/health",
+		"api_base": "/api/v1",
 		"endpoints": map[string]string{
-			"generate_test_data":    "POST /api/v1/test-data/generate",
-			"upload_transactions":   "POST /api/v1/transactions",
-			"upload_settlements":    "POST /api/v1/settlements",
-			"run_reconciliation":    "POST /api/v1/reconciliation/run",
-			"list_runs":             "GET  /api/v1/reconciliation/runs",
-			"get_run":               "GET  /api/v1/reconciliation/runs/{runID}",
-			"get_report":            "GET  /api/v1/reconciliation/runs/{runID}/report",
-			"query_transaction":     "GET  /api/v1/transactions/{txnID}/reconciliation",
-			"get_config":            "GET  /api/v1/config",
-			"update_config":         "PUT  /api/v1/config",
+			"generate_test_data":      "POST /api/v1/test-data/generate",
+			"upload_transactions":     "POST /api/v1/transactions",
+			"upload_settlements":      "POST /api/v1/settlements",
+			"upload_settlement_file":  "POST /api/v1/processors/{name}/settlement-files",
+			"upload_fx_rates":         "POST /api/v1/fx-rates",
+			"list_fx_rates":           "GET  /api/v1/fx-rates",
+			"run_reconciliation":      "POST /api/v1/reconciliation/run",
+			"list_runs":               "GET  /api/v1/reconciliation/runs",
+			"get_run":                 "GET  /api/v1/reconciliation/runs/{runID}",
+			"get_report":              "GET  /api/v1/reconciliation/runs/{runID}/report",
+			"get_report_html":         "GET  /api/v1/reconciliation/runs/{runID}/report.html",
+			"query_results":           "GET  /api/v1/reconciliation/runs/{runID}/results",
+			"cancel_run":              "POST /api/v1/reconciliation/runs/{runID}/cancel",
+			"replay_run":              "POST /api/v1/reconciliation/runs/{runID}/replay",
+			"diff_runs":               "GET  /api/v1/reconciliation/runs/{runID}/diff?against={otherRunID}",
+			"query_transaction":       "GET  /api/v1/transactions/{txnID}/reconciliation",
+			"get_config":              "GET  /api/v1/config",
+			"update_config":           "PUT  /api/v1/config",
+			"dry_run_reference_rules": "POST /api/v1/config/reference-rules/dry-run",
 		},
 	})
 }
@@ -173,7 +211,7 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-post">POST</span>
     <span class="endpoint-path">/api/v1/transactions</span>
   </div>
-  <p class="endpoint-desc">Upload internal transaction records (JSON array)</p>
+  <p class="endpoint-desc">Upload internal transaction records (JSON array). <code>amount</code> is the authorized amount; a partial capture is recorded as <code>captured_amount</code>, or each capture in <code>captures</code> (<code>id</code>, <code>amount</code>, <code>captured_at</code>). Settlements are matched against the captured amount.</p>
   <details class="try-it"><summary>Example</summary>
   <pre><code>curl -X POST /api/v1/transactions \
   -H "Content-Type: application/json" \
@@ -194,7 +232,7 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-post">POST</span>
     <span class="endpoint-path">/api/v1/settlements</span>
   </div>
-  <p class="endpoint-desc">Upload processor settlement records (JSON array)</p>
+  <p class="endpoint-desc">Upload processor settlement records (JSON array, <code>text/csv</code> body or multipart <code>file</code> upload). CSV files are read with the column mapping configured for <code>?processor=</code>; invalid rows are reported individually.</p>
   <details class="try-it"><summary>Example</summary>
   <pre><code>curl -X POST /api/v1/settlements \
   -H "Content-Type: application/json" \
@@ -207,6 +245,47 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     "settlement_batch_id": "BATCH-20250117"
   }]'</code></pre>
   </details>
+  <details class="try-it"><summary>CSV example</summary>
+  <pre><code>curl -X POST "/api/v1/settlements?processor=BrazilConnect" \
+  -H "Content-Type: text/csv" \
+  --data-binary @brazilconnect_20250117.csv
+
+curl -X POST /api/v1/settlements \
+  -F processor=BrazilConnect -F file=@brazilconnect_20250117.csv</code></pre>
+  </details>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-post">POST</span>
+    <span class="endpoint-path">/api/v1/processors/{name}/settlement-files</span>
+  </div>
+  <p class="endpoint-desc">Upload a settlement file in the processor's native format (raw body or multipart <code>file</code>). Adapters exist for PaySureMX, GlobalTransact, LatamPay, BrazilConnect and AndesPago.</p>
+  <details class="try-it"><summary>Example</summary>
+  <pre><code>curl -X POST /api/v1/processors/AndesPago/settlement-files \
+  --data-binary @andespago_liq_0117.txt</code></pre>
+  </details>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-post">POST</span>
+    <span class="endpoint-path">/api/v1/fx-rates</span>
+  </div>
+  <p class="endpoint-desc">Upload dated FX rates (JSON array, <code>text/csv</code> body or multipart <code>file</code> with <code>from,to,date,rate</code> columns). A rate replaces an earlier one for the same pair and date.</p>
+  <details class="try-it"><summary>Example</summary>
+  <pre><code>curl -X POST /api/v1/fx-rates \
+  -H "Content-Type: application/json" \
+  -d '[{"from": "BRL", "to": "USD", "date": "2025-01-15", "rate": 0.165}]'</code></pre>
+  </details>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-get">GET</span>
+    <span class="endpoint-path">/api/v1/fx-rates</span>
+  </div>
+  <p class="endpoint-desc">List stored dated FX rates. Optional filters: <code>?from=</code>, <code>?to=</code>.</p>
 </div>
 
 <div class="endpoint">
@@ -224,7 +303,7 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-post">POST</span>
     <span class="endpoint-path">/api/v1/reconciliation/run</span>
   </div>
-  <p class="endpoint-desc">Trigger a reconciliation run. Optionally pass config overrides in the request body.</p>
+  <p class="endpoint-desc">Queue a reconciliation run on a background worker. Returns <code>202</code> with the <code>run_id</code>; poll the run for <code>status</code> (<code>pending</code>, <code>running</code>, <code>completed</code>, <code>failed</code>, <code>cancelled</code>) and <code>progress</code> (0-100). Optionally pass config overrides in the request body.</p>
   <details class="try-it"><summary>Example with config override</summary>
   <pre><code>curl -X POST /api/v1/reconciliation/run \
   -H "Content-Type: application/json" \
@@ -245,7 +324,34 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-get">GET</span>
     <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}</span>
   </div>
-  <p class="endpoint-desc">Get full reconciliation run details including report</p>
+  <p class="endpoint-desc">Get full reconciliation run details: status, progress, error message if it failed, the <code>snapshot</code> of the effective config, input IDs and input hash, and the report once completed</p>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-post">POST</span>
+    <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/cancel</span>
+  </div>
+  <p class="endpoint-desc">Cancel a pending or running reconciliation. Returns <code>202</code>; the run moves to <code>cancelled</code> shortly after. Returns <code>409</code> if the run already finished.</p>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-post">POST</span>
+    <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/replay</span>
+  </div>
+  <p class="endpoint-desc">Re-execute a run on its recorded input records and config, as a new run. When it completes, its <code>replay</code> field compares the report hash with the original's (<code>identical</code>).</p>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-get">GET</span>
+    <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/diff?against={otherRunID}</span>
+  </div>
+  <p class="endpoint-desc">Compare a run's results with an earlier run, keyed by transaction/settlement ID: items whose status changed (e.g. <code>unsettled</code> → <code>matched</code>), new items, disappeared items, and deltas (run minus against) for the summary and every currency/country/processor breakdown.</p>
+  <details class="try-it"><summary>Example</summary>
+  <pre><code>curl "/api/v1/reconciliation/runs/RUN-0002/diff?against=RUN-0001"</code></pre>
+  </details>
 </div>
 
 <div class="endpoint">
@@ -253,7 +359,32 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-get">GET</span>
     <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/report</span>
   </div>
-  <p class="endpoint-desc">Get only the reconciliation report (summary, breakdowns, detailed results, high-priority discrepancies)</p>
+  <p class="endpoint-desc">Get only the reconciliation report (summary, breakdowns, detailed results, high-priority discrepancies). With <code>?format=csv</code> or <code>Accept: text/csv</code> one table is returned as CSV, chosen by <code>section</code>: <code>results</code> (default), <code>high_priority</code>, <code>by_currency</code>, <code>by_country</code>, <code>by_processor</code> or <code>by_record_type</code>. Columns are always in the same order. <code>?format=xlsx</code> returns the whole report as an Excel workbook: a summary sheet, one sheet per breakdown, the results and the high-priority discrepancies, with frozen header rows and amounts formatted in their currency. <code>?format=pdf</code> (or <code>Accept: application/pdf</code>) returns an A4 board pack: the headline figures, reconciliation-rate and result charts per processor, the currency, country and processor breakdowns and the 25 largest high-priority discrepancies. The same report always gives the same file.</p>
+  <details class="try-it"><summary>CSV example</summary>
+  <pre><code>curl -o results.csv "/api/v1/reconciliation/runs/RUN-0001/report?format=csv"
+curl -H "Accept: text/csv" "/api/v1/reconciliation/runs/RUN-0001/report?section=by_processor"
+curl -o RUN-0001.xlsx "/api/v1/reconciliation/runs/RUN-0001/report?format=xlsx"
+curl -o RUN-0001.pdf "/api/v1/reconciliation/runs/RUN-0001/report?format=pdf"</code></pre>
+  </details>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-get">GET</span>
+    <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/report.html</span>
+  </div>
+  <p class="endpoint-desc">The report as a printable HTML page: summary cards, reconciliation-rate bars per processor, the currency, country and processor breakdowns, the high-priority discrepancies and a table of the first 200 discrepancies that sorts by any column when its header is clicked, linking to the results endpoint when there are more. Printing it gives a board-pack version without the interactive parts.</p>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-get">GET</span>
+    <span class="endpoint-path">/api/v1/reconciliation/runs/{runID}/results</span>
+  </div>
+  <p class="endpoint-desc">Query a run's results one page at a time instead of downloading the whole report. Filters: <code>status</code>, <code>processor</code>, <code>currency</code>, <code>country</code> (comma-separated or repeated), <code>min_variance</code>/<code>max_variance</code> (signed, in the result's currency; needs exactly one <code>currency</code>), <code>min_days_to_settle</code>/<code>max_days_to_settle</code>, <code>authorized_from</code>/<code>authorized_to</code> and <code>settled_from</code>/<code>settled_to</code> (RFC 3339 or <code>YYYY-MM-DD</code>; bounds are inclusive). <code>sort</code> is one of <code>expected_amount</code>, <code>variance_amount</code>, <code>days_to_settle</code>, <code>authorized_at</code> or <code>settled_at</code>, with a <code>-</code> prefix for descending order; results without the value come last, and the default is report order. Sorting by an amount needs exactly one <code>currency</code>. Unknown statuses and sort fields are rejected. <code>limit</code> is 1-1000 (default 100). The response has the page's <code>results</code>, the <code>total</code> matching the filters and a <code>next_cursor</code> to pass as <code>cursor</code> for the next page, absent on the last one.</p>
+  <details class="try-it"><summary>Example</summary>
+  <pre><code>curl "/api/v1/reconciliation/runs/RUN-0001/results?status=unsettled,matched_with_variance&amp;currency=MXN&amp;sort=-variance_amount&amp;limit=50"</code></pre>
+  </details>
 </div>
 
 <h3>Query</h3>
@@ -281,7 +412,21 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <span class="badge badge-put">PUT</span>
     <span class="endpoint-path">/api/v1/config</span>
   </div>
-  <p class="endpoint-desc">Update reconciliation configuration (tolerance, thresholds, FX rates)</p>
+  <p class="endpoint-desc">Update reconciliation configuration (tolerance, thresholds, FX rates, reference rules). Invalid reference rules or fee schedules, or an unknown <code>fx_date_policy</code>, are rejected with <code>400</code>.</p>
+</div>
+
+<div class="endpoint">
+  <div class="endpoint-header">
+    <span class="badge badge-post">POST</span>
+    <span class="endpoint-path">/api/v1/config/reference-rules/dry-run</span>
+  </div>
+  <p class="endpoint-desc">Apply reference normalization rules to sample references without running a reconciliation. Pass <code>rules</code>, or a <code>processor</code> to use its configured rules; <code>field</code> is <code>processor_txn_id</code> (default) or <code>order_reference</code>. Returns each reference's output and the value after every rule.</p>
+  <details class="try-it"><summary>Example</summary>
+  <pre><code>curl -X POST /api/v1/config/reference-rules/dry-run \
+  -H "Content-Type: application/json" \
+  -d '{"rules":[{"type":"trim"},{"type":"strip_prefix","prefix":"MXP-"},{"type":"zero_pad","width":8}],
+       "references":[" MXP-4521 ","MXP-00004521"]}'</code></pre>
+  </details>
 </div>
 
 <h2>Reconciliation Statuses</h2>
@@ -292,27 +437,44 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
     <tr><td><code>matched_with_variance</code></td><td>Settlement found, amount differs beyond tolerance threshold</td></tr>
     <tr><td><code>unsettled</code></td><td>Internal transaction exists but no corresponding settlement was found</td></tr>
     <tr><td><code>unexpected_settlement</code></td><td>Settlement record exists but no corresponding internal transaction found</td></tr>
-    <tr><td><code>duplicate</code></td><td>Multiple settlement records found for the same transaction</td></tr>
+    <tr><td><code>duplicate</code></td><td>Multiple settlement records found for the same transaction. <code>duplicate_kind</code> is <code>exact_resend</code> when another line has the same amount, currency, settlement date and batch (<code>duplicate_of</code> names the earlier line), or <code>content_mismatch</code> when the content differs</td></tr>
+    <tr><td><code>refunded</code></td><td>Refund settled for the expected amount (internal refund record, or the original sale)</td></tr>
+    <tr><td><code>chargeback</code></td><td>Chargeback debited for a known sale</td></tr>
+    <tr><td><code>chargeback_reversed</code></td><td>Chargeback reversal credited for a known sale</td></tr>
+    <tr><td><code>adjustment</code></td><td>Processor adjustment line with no internal record</td></tr>
+    <tr><td><code>unlinked</code></td><td>Refund, chargeback or reversal whose original transaction could not be found</td></tr>
+    <tr><td><code>matched_fuzzy</code></td><td>References differ, but amount, currency, processor and date fit; carries a <code>match_confidence</code> (0-1) and needs review</td></tr>
+    <tr><td><code>not_captured</code></td><td>Authorized but never captured; no settlement expected</td></tr>
+    <tr><td><code>failed</code></td><td>Transaction failed; no settlement expected</td></tr>
+    <tr><td><code>failed_transaction_settled</code></td><td>A settlement arrived for a failed transaction; always high priority</td></tr>
   </tbody>
 </table>
 
 <h2>Matching Algorithm</h2>
-<p>The reconciliation engine runs in 3 phases:</p>
-<p><strong>Phase 1 — Duplicate Detection:</strong> Groups settlement records by <code>processor_name:processor_txn_id</code>. Any key with more than one settlement is flagged as <code>duplicate</code>.</p>
-<p><strong>Phase 2 — Settlement Matching:</strong> Each remaining settlement is matched to an internal transaction. Primary match: <code>processor_name:processor_txn_id</code>. Fallback: <code>order_reference</code> to <code>order_id</code>. If matched, amounts are compared (with optional FX conversion and tolerance).</p>
-<p><strong>Phase 3 — Unsettled Detection:</strong> Any internal transaction not matched in phases 1-2 is marked <code>unsettled</code>.</p>
+<p>The reconciliation engine runs in 4 phases:</p>
+<p>Before matching, <code>processor_txn_id</code> and <code>order_reference</code>/<code>order_id</code> values on both sides are normalized with the processor's <code>reference_rules</code>, so <code>MXP-0042</code> and <code>mxp-42</code> can be made to meet.</p>
+<p><strong>Phase 1 — Split Settlements and Duplicates:</strong> Groups settlement records by <code>processor_name:processor_txn_id</code>. When a key has several lines with distinct content (gross amount, currency, settlement date) that add up to the transaction amount, they are matched together as a <code>split</code> group; exact copies of a line, and any other key with more than one settlement, are flagged as <code>duplicate</code>.</p>
+<p><strong>Phase 2 — Settlement Matching:</strong> Each remaining settlement is matched to an internal transaction. A line listing <code>processor_txn_ids</code> nets several transactions and is matched to all of them as an <code>aggregate</code> group. Primary match: <code>processor_name:processor_txn_id</code>. Fallback: <code>order_reference</code> to <code>order_id</code>. If matched, amounts are compared (with optional FX conversion and tolerance).</p>
+<p><strong>Phase 3 — Fuzzy Matching:</strong> Leftover unexpected settlements are paired with leftover transactions of the same processor when the amount agrees within tolerance (after FX) and the settlement falls within the configured date window. Each pair gets a confidence score and the <code>matched_fuzzy</code> status.</p>
+<p><strong>Phase 4 — Unsettled Detection:</strong> Any internal transaction not matched in phases 1-3 is marked <code>unsettled</code>, except failed (<code>failed</code>) and authorized-but-never-captured (<code>not_captured</code>) transactions, which are not expected to settle. A settlement matched to a failed transaction is flagged <code>failed_transaction_settled</code>. Unsettled transactions carry their <code>days_outstanding</code> and <code>aging_bucket</code>.</p>
+<p><strong>Validation:</strong> The inputs are checked for fee arithmetic that does not add up, currencies that are not ISO 4217, negative amounts, missing references and settlements dated before their authorization. Findings go to the report's <code>data_quality</code> section and do not affect matching.</p>
 
 <h2>Report Structure</h2>
 <p>The report JSON contains:</p>
 <table>
   <thead><tr><th>Field</th><th>Description</th></tr></thead>
   <tbody>
-    <tr><td><code>summary</code></td><td>Aggregate counts, totals, reconciliation rate %</td></tr>
+    <tr><td><code>summary</code></td><td>Aggregate counts, totals, reconciliation rate %, <code>unsettled_aging</code> counts (<code>0_3</code>, <code>4_7</code>, <code>8_14</code>, <code>15_30</code>, <code>over_30</code> days outstanding), and amount totals, with the variance split into fee, FX, partial-capture and residual parts, per currency (<code>native_totals</code>) and converted to the <code>reporting_currency</code> (<code>reporting_totals</code>) (also in every breakdown, each with its own reconciliation rate)</td></tr>
     <tr><td><code>by_currency</code></td><td>Summary breakdown per currency (MXN, COP, BRL, USD)</td></tr>
     <tr><td><code>by_country</code></td><td>Summary breakdown per country (MX, CO, BR)</td></tr>
     <tr><td><code>by_processor</code></td><td>Summary breakdown per payment processor</td></tr>
-    <tr><td><code>results</code></td><td>Detailed list of every reconciliation result</td></tr>
-    <tr><td><code>high_priority_discrepancies</code></td><td>Filtered list: large variances or late settlements</td></tr>
+    <tr><td><code>by_record_type</code></td><td>Summary breakdown per record type (sale, refund, chargeback, chargeback_reversal, adjustment)</td></tr>
+    <tr><td><code>results</code></td><td>Detailed list of every reconciliation result; members of a split or aggregated settlement carry its <code>match_group</code>, converted amounts carry the <code>fx_rate</code> and <code>fx_rate_date</code> used, and matched sales with a variance carry a <code>variance_breakdown</code> (<code>fee</code>, <code>fx</code>, <code>partial_capture</code>, <code>residual</code>) that adds up to the variance. With a fee schedule, they carry the <code>expected_fee</code> and any <code>fee_overcharge</code>. Unsettled results carry their <code>days_outstanding</code> as of the report's <code>as_of</code> date and <code>aging_bucket</code></td></tr>
+    <tr><td><code>match_groups</code></td><td>Split settlements (one transaction, several lines) and aggregated settlements (one line, several transactions), with group totals and status</td></tr>
+    <tr><td><code>duplicate_analysis</code></td><td>Re-delivered settlement batches (<code>complete</code> when every line arrived again) and the amount overpaid per processor and currency through duplicate lines</td></tr>
+    <tr><td><code>fee_overcharges</code></td><td>Fees charged beyond the configured fee schedules, per processor and currency, with charged, expected and overcharged totals</td></tr>
+    <tr><td><code>data_quality</code></td><td>Data-quality findings (<code>arithmetic_mismatch</code>, <code>invalid_currency</code>, <code>settlement_before_authorization</code>, <code>negative_amount</code>, <code>capture_exceeds_authorization</code>, <code>missing_reference</code>) with the records and field involved, and counts <code>by_kind</code></td></tr>
+    <tr><td><code>high_priority_discrepancies</code></td><td>Filtered list: large variances, late settlements, settled failed transactions and unsettled transactions outstanding beyond <code>unsettled_priority_days</code></td></tr>
   </tbody>
 </table>
 
@@ -322,8 +484,16 @@ curl /api/v1/reconciliation/runs/RUN-0001/report</code></pre>
   <tbody>
     <tr><td><code>variance_tolerance_pct</code></td><td>float</td><td>0.0</td><td>Variance % below which amounts are still "matched" (e.g., 0.02 = 2%)</td></tr>
     <tr><td><code>late_settlement_days</code></td><td>int</td><td>7</td><td>Days threshold for flagging late settlements</td></tr>
-    <tr><td><code>high_priority_threshold</code></td><td>float</td><td>1000.0</td><td>Minimum variance amount to flag as high priority</td></tr>
-    <tr><td><code>fx_rates</code></td><td>object</td><td>—</td><td>Static FX rates map (from currency → to currency → rate)</td></tr>
+    <tr><td><code>high_priority_threshold</code></td><td>float</td><td>1000.0</td><td>Minimum variance amount, in the reporting currency, to flag as high priority</td></tr>
+    <tr><td><code>as_of</code></td><td>timestamp</td><td>latest settlement</td><td>Date unsettled transactions are aged to; defaults to the latest <code>settled_at</code> among the settlements reconciled</td></tr>
+    <tr><td><code>unsettled_priority_days</code></td><td>int</td><td>14</td><td>Unsettled transactions outstanding longer than this many days are high priority; 0 disables</td></tr>
+    <tr><td><code>fx_rates</code></td><td>object</td><td>—</td><td>Static FX rates map (from currency → to currency → rate), used when no dated rate from <code>/api/v1/fx-rates</code> is on or before the conversion date</td></tr>
+    <tr><td><code>reporting_currency</code></td><td>string</td><td>USD</td><td>Currency the summary and breakdown totals are converted to (<code>reporting_totals</code>) at the report's <code>as_of</code> date, next to the per-currency <code>native_totals</code></td></tr>
+    <tr><td><code>fx_date_policy</code></td><td>string</td><td>settlement_date</td><td>Date a conversion uses the dated rate of: <code>settlement_date</code> or <code>authorization_date</code>. The nearest earlier rate is used when that day has none</td></tr>
+    <tr><td><code>fuzzy_match</code></td><td>object</td><td>enabled, 3 days, 0.5</td><td>Fuzzy matching phase: <code>enabled</code>, <code>date_window_days</code> (max days from authorization to settlement), <code>min_confidence</code> (0-1)</td></tr>
+    <tr><td><code>reference_rules</code></td><td>object</td><td>—</td><td>Reference normalization rules per processor, applied in order. Each rule has a <code>type</code> (<code>regex_extract</code> with <code>pattern</code>, keeping the first capture group; <code>strip_prefix</code> with <code>prefix</code>; <code>case_fold</code>; <code>zero_pad</code> with <code>width</code>; <code>trim</code> with optional <code>chars</code>) and an optional <code>field</code> (<code>processor_txn_id</code> or <code>order_reference</code>; both if omitted)</td></tr>
+    <tr><td><code>fee_schedules</code></td><td>object</td><td>—</td><td>Contracted fees per processor: a list of schedules with optional <code>payment_method</code> and <code>country</code> (the most specific match applies) and volume <code>tiers</code> of <code>min_volume</code>, <code>percentage</code>, <code>fixed</code>, <code>min</code>, <code>max</code>. Matched sales charged more are flagged with a <code>fee_overcharge</code></td></tr>
+    <tr><td><code>csv_mappings</code></td><td>object</td><td>—</td><td>CSV settlement file layout per processor: <code>columns</code> (field → header), <code>delimiter</code>, <code>decimal_separator</code>, <code>thousands_separator</code>, <code>date_layout</code></td></tr>
   </tbody>
 </table>
 
@@ -351,7 +521,17 @@ func (h *Handler) uploadTransactions(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "empty transaction list")
 		return
 	}
-	count := h.store.AddTransactions(txns)
+	for _, t := range txns {
+		if !t.RecordType.Valid() {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("transaction %s: unknown record_type %q", t.ID, t.RecordType))
+			return
+		}
+	}
+	count, err := h.store.AddTransactions(txns)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"message":  fmt.Sprintf("Uploaded %d transactions (%d new)", len(txns), count),
 		"received": len(txns),
@@ -360,6 +540,18 @@ func (h *Handler) uploadTransactions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) uploadSettlements(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" || mediaType == "multipart/form-data" {
+		file, processor, err := settlementFile(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		h.uploadSettlementsCSV(w, file, processor)
+		return
+	}
+
 	var recs []models.SettlementRecord
 	if err := json.NewDecoder(r.Body).Decode(&recs); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
@@ -369,7 +561,17 @@ func (h *Handler) uploadSettlements(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "empty settlement list")
 		return
 	}
-	count := h.store.AddSettlements(recs)
+	for _, rec := range recs {
+		if !rec.RecordType.Valid() {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("settlement %s: unknown record_type %q", rec.ID, rec.RecordType))
+			return
+		}
+	}
+	count, err := h.store.AddSettlements(recs)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"message":  fmt.Sprintf("Uploaded %d settlement records (%d new)", len(recs), count),
 		"received": len(recs),
@@ -377,19 +579,159 @@ func (h *Handler) uploadSettlements(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// --- Reconciliation ---
+// uploadSettlementsCSV ingests a CSV settlement file using the processor's column mapping.
+func (h *Handler) uploadSettlementsCSV(w http.ResponseWriter, body io.Reader, processor string) {
+	h.mu.Lock()
+	mapping, ok := h.config.CSVMappings[processor]
+	h.mu.Unlock()
+	if !ok {
+		mapping = models.DefaultCSVMapping()
+	}
+	recs, rowErrs, err := ingest.ParseSettlementsCSV(body, processor, mapping)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid CSV: "+err.Error())
+		return
+	}
+	h.writeIngestResult(w, recs, rowErrs)
+}
 
-func (h *Handler) triggerReconciliation(w http.ResponseWriter, r *http.Request) {
-	h.runSeq++
-	runID := fmt.Sprintf("RUN-%04d", h.runSeq)
+// uploadProcessorSettlementFile ingests a settlement file in the processor's native format.
+func (h *Handler) uploadProcessorSettlementFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	adapter, ok := ingest.Lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no settlement file adapter for processor %q", name))
+		return
+	}
+	file, _, err := settlementFile(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+	recs, rowErrs, err := adapter.Parse(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid settlement file: "+err.Error())
+		return
+	}
+	h.writeIngestResult(w, recs, rowErrs)
+}
 
-	run := &models.ReconciliationRun{
-		ID:        runID,
-		CreatedAt: time.Now().UTC(),
-		Status:    "running",
+// writeIngestResult stores the parsed records and reports per-row failures.
+// Valid rows are stored even when other rows fail.
+func (h *Handler) writeIngestResult(w http.ResponseWriter, recs []models.SettlementRecord, rowErrs []ingest.RowError) {
+	if rowErrs == nil {
+		rowErrs = []ingest.RowError{}
+	}
+	if len(recs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":  "no valid settlement rows in file",
+			"errors": rowErrs,
+		})
+		return
+	}
+	count, err := h.store.AddSettlements(recs)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"message":  fmt.Sprintf("Uploaded %d settlement records (%d new, %d rejected)", len(recs), count, len(rowErrs)),
+		"received": len(recs) + len(rowErrs),
+		"new":      count,
+		"rejected": len(rowErrs),
+		"errors":   rowErrs,
+	})
+}
+
+// --- FX Rates ---
+
+// uploadFXRates stores dated FX rates from a JSON array, or a CSV file (raw or
+// multipart) with from, to, date and rate columns. A rate replaces any earlier upload for
+// the same pair and date.
+func (h *Handler) uploadFXRates(w http.ResponseWriter, r *http.Request) {
+	var rates []models.FXRate
+	rowErrs := []ingest.RowError{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" || mediaType == "multipart/form-data" {
+		file, _, err := settlementFile(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		rates, rowErrs, err = ingest.ParseFXRatesCSV(file)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid CSV: "+err.Error())
+			return
+		}
+		if rowErrs == nil {
+			rowErrs = []ingest.RowError{}
+		}
+	} else {
+		var in []struct {
+			From string  `json:"from"`
+			To   string  `json:"to"`
+			Date string  `json:"date"`
+			Rate float64 `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		for i, v := range in {
+			rate, err := ingest.NewFXRate(v.From, v.To, v.Date, v.Rate)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("rate %d: %v", i+1, err))
+				return
+			}
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":  "no valid FX rates",
+			"errors": rowErrs,
+		})
+		return
+	}
+	count, err := h.store.AddFXRates(rates)
+	if err != nil {
+		writeInternalError(w, err)
+		return
 	}
-	h.store.SaveRun(run)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"message":  fmt.Sprintf("Uploaded %d FX rates (%d new, %d rejected)", len(rates), count, len(rowErrs)),
+		"received": len(rates) + len(rowErrs),
+		"new":      count,
+		"rejected": len(rowErrs),
+		"errors":   rowErrs,
+	})
+}
+
+// listFXRates returns the stored dated FX rates, optionally filtered by ?from= and ?to=.
+func (h *Handler) listFXRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.store.ListFXRates()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	from, to := strings.ToUpper(r.URL.Query().Get("from")), strings.ToUpper(r.URL.Query().Get("to"))
+	filtered := make([]models.FXRate, 0, len(rates))
+	for _, rate := range rates {
+		if (from == "" || rate.From == from) && (to == "" || rate.To == to) {
+			filtered = append(filtered, rate)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":    len(filtered),
+		"fx_rates": filtered,
+	})
+}
+
+// --- Reconciliation ---
 
+func (h *Handler) triggerReconciliation(w http.ResponseWriter, r *http.Request) {
 	// Parse optional config overrides from request body.
 	var cfgOverride *models.ReconciliationConfig
 	if r.Body != nil && r.ContentLength > 0 {
@@ -399,10 +741,11 @@ func (h *Handler) triggerReconciliation(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	h.mu.Lock()
 	// Use overridden config if provided, else use default.
 	rec := h.reconciler
 	if cfgOverride != nil {
-		if cfgOverride.VarianceTolerancePct > 0 || cfgOverride.LateSettlementDays > 0 || cfgOverride.HighPriorityThreshold > 0 {
+		if cfgOverride.VarianceTolerancePct > 0 || cfgOverride.LateSettlementDays > 0 || cfgOverride.HighPriorityThreshold.Sign() > 0 {
 			mergedCfg := h.config
 			if cfgOverride.VarianceTolerancePct > 0 {
 				mergedCfg.VarianceTolerancePct = cfgOverride.VarianceTolerancePct
@@ -410,32 +753,267 @@ func (h *Handler) triggerReconciliation(w http.ResponseWriter, r *http.Request)
 			if cfgOverride.LateSettlementDays > 0 {
 				mergedCfg.LateSettlementDays = cfgOverride.LateSettlementDays
 			}
-			if cfgOverride.HighPriorityThreshold > 0 {
+			if cfgOverride.HighPriorityThreshold.Sign() > 0 {
 				mergedCfg.HighPriorityThreshold = cfgOverride.HighPriorityThreshold
 			}
 			rec = reconciler.New(h.store, mergedCfg)
 		}
 	}
+	runID, err := h.nextRunID()
+	h.mu.Unlock()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
-	report := rec.Run(runID)
-	run.Status = "completed"
-	run.Report = report
-	h.store.SaveRun(run)
+	h.enqueueRun(w, &models.ReconciliationRun{
+		ID:        runID,
+		CreatedAt: time.Now().UTC(),
+		Status:    models.RunPending,
+	}, rec, nil)
+}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+// replayRun re-executes a run on its recorded inputs and config. The new run
+// is compared with the original when it completes.
+func (h *Handler) replayRun(w http.ResponseWriter, r *http.Request) {
+	orig, err := h.store.GetRunInfo(r.PathValue("runID"))
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found")
+		return
+	}
+	if orig.Snapshot == nil {
+		writeError(w, http.StatusConflict, "reconciliation run has no input snapshot to replay")
+		return
+	}
+	in, err := h.store.GetRunInputs(orig.ID)
+	if err != nil {
+		writeStoreError(w, err, "inputs of reconciliation run not found")
+		return
+	}
+	hash, err := reconciler.InputHash(in)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if hash != orig.Snapshot.InputHash {
+		writeInternalError(w, fmt.Errorf("stored inputs of run %s hash to %s, snapshot says %s", orig.ID, hash, orig.Snapshot.InputHash))
+		return
+	}
+
+	h.mu.Lock()
+	runID, err := h.nextRunID()
+	h.mu.Unlock()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	h.enqueueRun(w, &models.ReconciliationRun{
+		ID:        runID,
+		CreatedAt: time.Now().UTC(),
+		Status:    models.RunPending,
+		ReplayOf:  orig.ID,
+	}, reconciler.New(h.store, orig.Snapshot.Config), &in)
+}
+
+// enqueueRun saves a pending run, queues it on the worker pool and writes the
+// 202 response. If in is nil the run reconciles the store's current contents.
+func (h *Handler) enqueueRun(w http.ResponseWriter, run *models.ReconciliationRun, rec *reconciler.Reconciler, in *models.RunInputs) {
+	runID := run.ID
+	if err := h.store.SaveRun(run); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// The worker owns run from here on; only touch it again if it was never queued.
+	if err := h.jobs.Submit(runID, func(ctx context.Context) { h.executeRun(ctx, run, rec, in) }); err != nil {
+		run.Status = models.RunFailed
+		run.Error = err.Error()
+		h.saveRun(run)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			writeError(w, http.StatusServiceUnavailable, "too many reconciliation runs queued, retry later")
+			return
+		}
+		writeInternalError(w, err)
+		return
+	}
+
+	statusURL := "/api/v1/reconciliation/runs/" + runID
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"run_id":     runID,
+		"status":     models.RunPending,
+		"status_url": statusURL,
+	})
+}
+
+// executeRun runs on a worker goroutine and records progress and the outcome of
+// the run in the store.
+func (h *Handler) executeRun(ctx context.Context, run *models.ReconciliationRun, rec *reconciler.Reconciler, in *models.RunInputs) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("reconciliation %s panicked: %v\n%s", run.ID, p, debug.Stack())
+			h.finishRun(run, nil, fmt.Errorf("internal error: %v", p))
+		}
+	}()
+	if err := ctx.Err(); err != nil {
+		h.finishRun(run, nil, err) // cancelled while still queued
+		return
+	}
+
+	if in == nil {
+		loaded, err := rec.LoadInputs()
+		if err != nil {
+			h.finishRun(run, nil, err)
+			return
+		}
+		in = &loaded
+	}
+	snap, err := reconciler.NewSnapshot(rec.Config(), *in)
+	if err == nil {
+		err = h.store.SaveRunInputs(run.ID, *in)
+	}
+	if err != nil {
+		h.finishRun(run, nil, fmt.Errorf("recording run inputs: %w", err))
+		return
+	}
+
+	started := time.Now().UTC()
+	run.Status = models.RunRunning
+	run.StartedAt = &started
+	run.Snapshot = snap
+	h.saveRun(run)
+
+	report, err := rec.Reconcile(ctx, run.ID, *in, func(pct int) {
+		run.Progress = pct
+		h.saveRun(run)
+	})
+	h.finishRun(run, report, err)
+}
+
+func (h *Handler) finishRun(run *models.ReconciliationRun, report *models.ReconciliationReport, err error) {
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = models.RunCancelled
+		run.Error = "cancelled by request"
+	case err != nil:
+		run.Status = models.RunFailed
+		run.Error = err.Error()
+		log.Printf("reconciliation %s failed: %v", run.ID, err)
+	default:
+		run.Status = models.RunCompleted
+		run.Progress = 100
+		run.Report = report
+		h.recordReportHash(run)
+	}
+	h.saveRun(run)
+}
+
+// recordReportHash sets the run's report hash and, for a replay, compares it
+// with the original run's.
+func (h *Handler) recordReportHash(run *models.ReconciliationRun) {
+	hash, err := reconciler.ReportHash(run.Report)
+	if err != nil {
+		log.Printf("hashing report of run %s: %v", run.ID, err)
+		return
+	}
+	run.ReportHash = hash
+	if run.ReplayOf == "" {
+		return
+	}
+	orig, err := h.store.GetRunInfo(run.ReplayOf)
+	if err != nil {
+		log.Printf("loading original run %s of replay %s: %v", run.ReplayOf, run.ID, err)
+		return
+	}
+	run.Replay = &models.ReplayComparison{
+		OriginalRunID:      orig.ID,
+		OriginalReportHash: orig.ReportHash,
+		ReportHash:         hash,
+		Identical:          orig.ReportHash != "" && orig.ReportHash == hash,
+	}
+}
+
+// saveRun persists run from a background job, where there is no response to
+// report a storage error on.
+func (h *Handler) saveRun(run *models.ReconciliationRun) {
+	if err := h.store.SaveRun(run); err != nil {
+		log.Printf("saving run %s: %v", run.ID, err)
+	}
+}
+
+func (h *Handler) cancelRun(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("runID")
+	run, err := h.store.GetRunInfo(runID)
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found")
+		return
+	}
+	if run.Status != models.RunPending && run.Status != models.RunRunning {
+		writeError(w, http.StatusConflict, "reconciliation run already "+run.Status)
+		return
+	}
+	if !h.jobs.Cancel(runID) {
+		writeError(w, http.StatusConflict, "reconciliation run is no longer active")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{
 		"run_id":  runID,
-		"status":  "completed",
-		"summary": report.Summary,
+		"message": "Cancellation requested",
 	})
 }
 
+// FailInterruptedRuns marks runs left pending or running by a previous process
+// as failed. Call it once at startup, before any run is triggered.
+func (h *Handler) FailInterruptedRuns() error {
+	runs, err := h.store.ListRuns()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.Status != models.RunPending && run.Status != models.RunRunning {
+			continue
+		}
+		run.Status = models.RunFailed
+		run.Error = "interrupted by server restart"
+		if err := h.store.SaveRun(run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextRunID returns the next unused RUN-NNNN identifier. Runs persisted by an
+// earlier process are skipped so they are never overwritten. Callers hold h.mu.
+func (h *Handler) nextRunID() (string, error) {
+	for {
+		h.runSeq++
+		runID := fmt.Sprintf("RUN-%04d", h.runSeq)
+		_, err := h.store.GetRunInfo(runID)
+		if errors.Is(err, store.ErrNotFound) {
+			return runID, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
 func (h *Handler) listRuns(w http.ResponseWriter, _ *http.Request) {
-	runs := h.store.ListRuns()
+	runs, err := h.store.ListRuns()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 	// Return lightweight list (no full reports).
 	type runSummary struct {
 		ID        string    `json:"id"`
 		CreatedAt time.Time `json:"created_at"`
 		Status    string    `json:"status"`
+		Progress  int       `json:"progress"`
+		Error     string    `json:"error,omitempty"`
 	}
 	summaries := make([]runSummary, 0, len(runs))
 	for _, r := range runs {
@@ -443,6 +1021,8 @@ func (h *Handler) listRuns(w http.ResponseWriter, _ *http.Request) {
 			ID:        r.ID,
 			CreatedAt: r.CreatedAt,
 			Status:    r.Status,
+			Progress:  r.Progress,
+			Error:     r.Error,
 		})
 	}
 	writeJSON(w, http.StatusOK, summaries)
@@ -450,9 +1030,9 @@ func (h *Handler) listRuns(w http.ResponseWriter, _ *http.Request) {
 
 func (h *Handler) getRun(w http.ResponseWriter, r *http.Request) {
 	runID := r.PathValue("runID")
-	run, ok := h.store.GetRun(runID)
-	if !ok {
-		writeError(w, http.StatusNotFound, "reconciliation run not found")
+	run, err := h.store.GetRun(runID)
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found")
 		return
 	}
 	writeJSON(w, http.StatusOK, run)
@@ -460,16 +1040,251 @@ func (h *Handler) getRun(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) getReport(w http.ResponseWriter, r *http.Request) {
 	runID := r.PathValue("runID")
-	run, ok := h.store.GetRun(runID)
-	if !ok {
-		writeError(w, http.StatusNotFound, "reconciliation run not found")
+	run, err := h.store.GetRun(runID)
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found")
+		return
+	}
+	if run.Report == nil {
+		writeError(w, http.StatusNotFound, "report not available yet")
+		return
+	}
+	switch format := reportFormat(r); format {
+	case "json":
+		writeJSON(w, http.StatusOK, run.Report)
+	case "csv":
+		section := r.URL.Query().Get("section")
+		if section == "" {
+			section = report.SectionResults
+		}
+		if !slices.Contains(report.Sections, section) {
+			writeError(w, http.StatusBadRequest, "section must be one of: "+strings.Join(report.Sections, ", "))
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-"+section+".csv"))
+		if err := report.WriteCSV(w, run.Report, section); err != nil {
+			log.Printf("writing CSV report for %s: %v", runID, err)
+		}
+	case "xlsx":
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+".xlsx"))
+		if err := report.WriteXLSX(w, run.Report); err != nil {
+			log.Printf("writing XLSX report for %s: %v", runID, err)
+		}
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+".pdf"))
+		if err := report.WritePDF(w, run.Report); err != nil {
+			log.Printf("writing PDF report for %s: %v", runID, err)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported report format %q", format))
+	}
+}
+
+// getReportHTML serves a run's report as a printable HTML page.
+func (h *Handler) getReportHTML(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("runID")
+	run, err := h.store.GetRun(runID)
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found")
 		return
 	}
 	if run.Report == nil {
 		writeError(w, http.StatusNotFound, "report not available yet")
 		return
 	}
-	writeJSON(w, http.StatusOK, run.Report)
+	var buf bytes.Buffer
+	if err := report.WriteHTML(&buf, run.Report); err != nil {
+		log.Printf("rendering HTML report for %s: %v", runID, err)
+		writeError(w, http.StatusInternalServerError, "failed to render report")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// Page sizes of the results query.
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 1000
+)
+
+// queryResults returns one page of a run's results, filtered and sorted per
+// the query parameters, so clients need not download the whole report.
+func (h *Handler) queryResults(w http.ResponseWriter, r *http.Request) {
+	q, err := parseResultQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := h.store.QueryResults(r.PathValue("runID"), q)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor: pass the next_cursor of a page with the same sort")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run not found or report not available yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseResultQuery reads the filters, sort and page of a results query. List
+// filters take comma-separated or repeated values. Date bounds take RFC 3339
+// timestamps or dates; a date as upper bound includes the whole day.
+func parseResultQuery(v url.Values) (store.ResultQuery, error) {
+	list := func(name string, upper bool) []string {
+		var out []string
+		for _, value := range v[name] {
+			for _, s := range strings.Split(value, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					if upper {
+						s = strings.ToUpper(s)
+					}
+					out = append(out, s)
+				}
+			}
+		}
+		return out
+	}
+	q := store.ResultQuery{
+		Processors: list("processor", false),
+		Currencies: list("currency", true),
+		Countries:  list("country", true),
+		Sort:       v.Get("sort"),
+		Cursor:     v.Get("cursor"),
+		Limit:      defaultResultsLimit,
+	}
+	var errs []string
+	for _, s := range list("status", false) {
+		status := models.ReconciliationStatus(s)
+		if !slices.Contains(models.ReconciliationStatuses, status) {
+			errs = append(errs, fmt.Sprintf("unknown status %q", s))
+			continue
+		}
+		q.Statuses = append(q.Statuses, status)
+	}
+	amount := func(name string) *money.Amount {
+		if v.Get(name) == "" {
+			return nil
+		}
+		a, err := money.Parse(v.Get(name))
+		if err != nil {
+			errs = append(errs, name+" must be a decimal amount")
+			return nil
+		}
+		return &a
+	}
+	days := func(name string) *int {
+		if v.Get(name) == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v.Get(name))
+		if err != nil || n < 0 {
+			errs = append(errs, name+" must be a non-negative integer")
+			return nil
+		}
+		return &n
+	}
+	date := func(name string, upper bool) *time.Time {
+		if v.Get(name) == "" {
+			return nil
+		}
+		if t, err := time.Parse(time.RFC3339, v.Get(name)); err == nil {
+			return &t
+		}
+		t, err := time.Parse(time.DateOnly, v.Get(name))
+		if err != nil {
+			errs = append(errs, name+" must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return nil
+		}
+		if upper {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &t
+	}
+	q.MinVariance, q.MaxVariance = amount("min_variance"), amount("max_variance")
+	q.MinDaysToSettle, q.MaxDaysToSettle = days("min_days_to_settle"), days("max_days_to_settle")
+	q.AuthorizedFrom, q.AuthorizedTo = date("authorized_from", false), date("authorized_to", true)
+	q.SettledFrom, q.SettledTo = date("settled_from", false), date("settled_to", true)
+
+	if field := strings.TrimPrefix(q.Sort, "-"); q.Sort != "" && !slices.Contains(store.ResultSortFields, field) {
+		errs = append(errs, "sort must be one of: "+strings.Join(store.ResultSortFields, ", ")+", optionally prefixed with - for descending order")
+	}
+	// Amounts in different currencies do not compare, so variance ranges and
+	// amount sorts apply within a single currency.
+	amountSort := slices.Contains([]string{"expected_amount", "variance_amount"}, strings.TrimPrefix(q.Sort, "-"))
+	if (q.MinVariance != nil || q.MaxVariance != nil || amountSort) && len(slices.Compact(slices.Sorted(slices.Values(q.Currencies)))) != 1 {
+		errs = append(errs, "min_variance, max_variance and sorting by expected_amount or variance_amount need exactly one currency")
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxResultsLimit {
+			errs = append(errs, fmt.Sprintf("limit must be between 1 and %d", maxResultsLimit))
+		}
+		q.Limit = n
+	}
+	if len(errs) > 0 {
+		return q, errors.New(strings.Join(errs, "; "))
+	}
+	return q, nil
+}
+
+// reportMediaTypes maps the media types a report can be requested with in
+// the Accept header to their format.
+var reportMediaTypes = map[string]string{
+	"text/csv": "csv",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+	"application/pdf": "pdf",
+}
+
+// reportFormat is the format a report is requested in: the format query
+// parameter if given, else the first one the Accept header lists, else json.
+func reportFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && reportMediaTypes[mediaType] != "" {
+			return reportMediaTypes[mediaType]
+		}
+	}
+	return "json"
+}
+
+func (h *Handler) diffRuns(w http.ResponseWriter, r *http.Request) {
+	againstID := r.URL.Query().Get("against")
+	if againstID == "" {
+		writeError(w, http.StatusBadRequest, "query parameter 'against' is required")
+		return
+	}
+	run, ok := h.completedReport(w, r.PathValue("runID"))
+	if !ok {
+		return
+	}
+	against, ok := h.completedReport(w, againstID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, report.Diff(run, against))
+}
+
+// completedReport loads the report of a run, writing an error response and
+// returning false if the run does not exist or has no report yet.
+func (h *Handler) completedReport(w http.ResponseWriter, runID string) (*models.ReconciliationReport, bool) {
+	run, err := h.store.GetRun(runID)
+	if err != nil {
+		writeStoreError(w, err, "reconciliation run "+runID+" not found")
+		return nil, false
+	}
+	if run.Report == nil {
+		writeError(w, http.StatusConflict, "reconciliation run "+runID+" has no report ("+run.Status+")")
+		return nil, false
+	}
+	return run.Report, true
 }
 
 // --- Transaction Query ---
@@ -478,15 +1293,27 @@ func (h *Handler) getTransactionReconciliation(w http.ResponseWriter, r *http.Re
 	txnID := r.PathValue("txnID")
 
 	// Check if transaction exists.
-	_, ok := h.store.GetTransaction(txnID)
-	if !ok {
-		writeError(w, http.StatusNotFound, "transaction not found")
+	if _, err := h.store.GetTransaction(txnID); err != nil {
+		writeStoreError(w, err, "transaction not found")
 		return
 	}
 
-	// Search through all runs for results matching this transaction.
+	// Search through all completed runs for results matching this transaction.
+	runs, err := h.store.ListRuns()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 	var matchingResults []models.ReconciliationResult
-	for _, run := range h.store.ListRuns() {
+	for _, info := range runs {
+		if info.Status != models.RunCompleted {
+			continue
+		}
+		run, err := h.store.GetRun(info.ID)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
 		if run.Report == nil {
 			continue
 		}
@@ -506,7 +1333,10 @@ func (h *Handler) getTransactionReconciliation(w http.ResponseWriter, r *http.Re
 // --- Configuration ---
 
 func (h *Handler) getConfig(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, h.config)
+	h.mu.Lock()
+	cfg := h.config
+	h.mu.Unlock()
+	writeJSON(w, http.StatusOK, cfg)
 }
 
 func (h *Handler) updateConfig(w http.ResponseWriter, r *http.Request) {
@@ -515,21 +1345,115 @@ func (h *Handler) updateConfig(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
+	if err := reconciler.ValidateReferenceRules(cfg.ReferenceRules); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := reconciler.ValidateFeeSchedules(cfg.FeeSchedules); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch cfg.FXDatePolicy {
+	case "", models.FXDateSettlement, models.FXDateAuthorization:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("fx_date_policy must be %s or %s", models.FXDateSettlement, models.FXDateAuthorization))
+		return
+	}
+	if cfg.ReportingCurrency != "" && !money.ValidCurrency(cfg.ReportingCurrency) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("reporting_currency %q is not an ISO 4217 code", cfg.ReportingCurrency))
+		return
+	}
+	if cfg.UnsettledPriorityDays < 0 {
+		writeError(w, http.StatusBadRequest, "unsettled_priority_days must not be negative")
+		return
+	}
+	h.mu.Lock()
 	h.config = cfg
 	h.reconciler = reconciler.New(h.store, cfg)
+	h.mu.Unlock()
 	writeJSON(w, http.StatusOK, map[string]any{
 		"message": "Configuration updated",
 		"config":  cfg,
 	})
 }
 
+// dryRunReferenceRules applies reference rules to sample references and
+// reports the value after each rule.
+func (h *Handler) dryRunReferenceRules(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Processor  string                 `json:"processor"`
+		Rules      []models.ReferenceRule `json:"rules"`
+		Field      string                 `json:"field"`
+		References []string               `json:"references"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	switch req.Field {
+	case "":
+		req.Field = models.RefFieldProcessorTxnID
+	case models.RefFieldProcessorTxnID, models.RefFieldOrderReference:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("field must be %s or %s", models.RefFieldProcessorTxnID, models.RefFieldOrderReference))
+		return
+	}
+	if req.Rules == nil {
+		if req.Processor == "" {
+			writeError(w, http.StatusBadRequest, "pass rules or a processor with configured rules")
+			return
+		}
+		h.mu.Lock()
+		req.Rules = h.config.ReferenceRules[req.Processor]
+		h.mu.Unlock()
+		if req.Rules == nil {
+			req.Rules = []models.ReferenceRule{}
+		}
+	}
+	rules, err := reconciler.CompileReferenceRules(req.Rules)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	type result struct {
+		Input  string   `json:"input"`
+		Output string   `json:"output"`
+		Steps  []string `json:"steps"`
+	}
+	results := make([]result, 0, len(req.References))
+	for _, ref := range req.References {
+		steps := rules.Trace(req.Field, ref)
+		out := ref
+		if len(steps) > 0 {
+			out = steps[len(steps)-1]
+		}
+		results = append(results, result{Input: ref, Output: out, Steps: steps})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"processor": req.Processor,
+		"field":     req.Field,
+		"rules":     req.Rules,
+		"results":   results,
+	})
+}
+
 // --- Test Data ---
 
 func (h *Handler) generateTestData(w http.ResponseWriter, _ *http.Request) {
-	h.store.Clear()
 	txns, setts := generator.GenerateTestData(42)
-	h.store.AddTransactions(txns)
-	h.store.AddSettlements(setts)
+	if err := h.store.Clear(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if _, err := h.store.AddTransactions(txns); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if _, err := h.store.AddSettlements(setts); err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"message":      "Test data generated and loaded",
@@ -540,6 +1464,24 @@ func (h *Handler) generateTestData(w http.ResponseWriter, _ *http.Request) {
 
 // --- Helpers ---
 
+// settlementFile returns the uploaded file from a multipart "file" field, or the raw
+// request body otherwise, along with the optional "processor" form or query value.
+func settlementFile(r *http.Request) (io.ReadCloser, string, error) {
+	processor := r.URL.Query().Get("processor")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, processor, nil
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", fmt.Errorf("multipart upload needs a \"file\" field: %w", err)
+	}
+	if v := r.FormValue("processor"); v != "" {
+		processor = v
+	}
+	return file, processor, nil
+}
+
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -551,3 +1493,18 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
+
+// writeStoreError reports store.ErrNotFound as 404 with notFoundMsg and anything else as 500.
+func writeStoreError(w http.ResponseWriter, err error, notFoundMsg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusNotFound, notFoundMsg)
+		return
+	}
+	writeInternalError(w, err)
+}
+
+// writeInternalError logs err and returns a generic 500 so storage details are not leaked.
+func writeInternalError(w http.ResponseWriter, err error) {
+	log.Printf("internal error: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
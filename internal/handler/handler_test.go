@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/jobs"
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+	"github.com/denys-rosario/settlement-reconciler/internal/reconciler"
+	"github.com/denys-rosario/settlement-reconciler/internal/store"
+)
+
+// newTestServer serves a Handler on an in-memory store.
+func newTestServer(t *testing.T) (*httptest.Server, *Handler, store.Store) {
+	t.Helper()
+	s := store.New()
+	srv, h := serve(t, s, jobs.New(1, 10))
+	return srv, h, s
+}
+
+// serve serves a Handler on s that runs reconciliations on pool.
+func serve(t *testing.T, s store.Store, pool *jobs.Pool) (*httptest.Server, *Handler) {
+	t.Helper()
+	cfg := models.DefaultConfig()
+	h := New(s, reconciler.New(s, cfg), cfg, pool)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		pool.Close()
+	})
+	return srv, h
+}
+
+// doJSON sends a request and decodes the JSON response into out, if not nil.
+func doJSON(t *testing.T, method, url string, body any, out any) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestParseResultQuery(t *testing.T) {
+	endOfDay := time.Date(2025, 1, 31, 23, 59, 59, 999999999, time.UTC)
+	tests := []struct {
+		name    string
+		query   string
+		check   func(store.ResultQuery) bool
+		wantErr string
+	}{
+		{"default limit", "", func(q store.ResultQuery) bool { return q.Limit == defaultResultsLimit && q.Sort == "" }, ""},
+		{"lowest limit", "limit=1", func(q store.ResultQuery) bool { return q.Limit == 1 }, ""},
+		{"highest limit", "limit=1000", func(q store.ResultQuery) bool { return q.Limit == maxResultsLimit }, ""},
+		{"zero limit", "limit=0", nil, "limit must be between 1 and 1000"},
+		{"limit above max", "limit=1001", nil, "limit must be between 1 and 1000"},
+		{"limit not a number", "limit=ten", nil, "limit must be between 1 and 1000"},
+		{"lists", "status=unsettled,matched&status=duplicate&currency=mxn,%20brl&country=mx&processor=stripe",
+			func(q store.ResultQuery) bool {
+				return slices.Equal(q.Statuses, []models.ReconciliationStatus{models.StatusUnsettled, models.StatusMatched, models.StatusDuplicate}) &&
+					slices.Equal(q.Currencies, []string{"MXN", "BRL"}) && slices.Equal(q.Countries, []string{"MX"}) && slices.Equal(q.Processors, []string{"stripe"})
+			}, ""},
+		{"unknown status", "status=unsettled,settled", nil, `unknown status "settled"`},
+		{"date upper bound includes the day", "settled_from=2025-01-01&settled_to=2025-01-31&authorized_to=2025-01-31",
+			func(q store.ResultQuery) bool {
+				return q.SettledFrom.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) && q.SettledTo.Equal(endOfDay) && q.AuthorizedTo.Equal(endOfDay)
+			}, ""},
+		{"timestamp upper bound is exact", "settled_to=2025-01-31T12:00:00Z",
+			func(q store.ResultQuery) bool {
+				return q.SettledTo.Equal(time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC))
+			}, ""},
+		{"bad date", "authorized_from=31/01/2025", nil, "authorized_from must be an RFC 3339 timestamp or a YYYY-MM-DD date"},
+		{"ranges", "currency=MXN&min_variance=-12.5&max_variance=3&min_days_to_settle=2&max_days_to_settle=7",
+			func(q store.ResultQuery) bool {
+				return *q.MinVariance == money.MustParse("-12.5") && *q.MaxVariance == money.MustParse("3") && *q.MinDaysToSettle == 2 && *q.MaxDaysToSettle == 7
+			}, ""},
+		{"negative days", "max_days_to_settle=-1", nil, "max_days_to_settle must be a non-negative integer"},
+		{"descending sort", "currency=mxn,MXN&sort=-variance_amount", func(q store.ResultQuery) bool { return q.Sort == "-variance_amount" }, ""},
+		{"variance range without currency", "min_variance=1", nil, "need exactly one currency"},
+		{"amount sort across currencies", "currency=MXN,BRL&sort=expected_amount", nil, "need exactly one currency"},
+		{"other sorts across currencies", "currency=MXN,BRL&sort=-days_to_settle", func(q store.ResultQuery) bool { return q.Sort == "-days_to_settle" }, ""},
+		{"unknown sort", "sort=amount", nil, "sort must be one of: expected_amount, variance_amount, days_to_settle, authorized_at, settled_at"},
+		{"errors are joined", "sort=amount&limit=0", nil, "sort must be one of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := parseResultQuery(v)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(q) {
+				t.Errorf("unexpected query: %+v", q)
+			}
+		})
+	}
+}
+
+func TestQueryResults(t *testing.T) {
+	srv, _, s := newTestServer(t)
+	results := []models.ReconciliationResult{
+		{ID: "R0", Status: models.StatusMatched, Currency: "MXN", VarianceAmount: money.MustParse("0")},
+		{ID: "R1", Status: models.StatusUnsettled, Currency: "MXN", VarianceAmount: money.MustParse("-100")},
+		{ID: "R2", Status: models.StatusMatchedWithVariance, Currency: "BRL", VarianceAmount: money.MustParse("-5")},
+	}
+	run := &models.ReconciliationRun{ID: "RUN-0001", Status: models.RunCompleted, Report: &models.ReconciliationReport{RunID: "RUN-0001", Results: results}}
+	if err := s.SaveRun(run); err != nil {
+		t.Fatal(err)
+	}
+	base := srv.URL + "/api/v1/reconciliation/runs/RUN-0001/results"
+
+	var page store.ResultPage
+	if code := doJSON(t, "GET", base+"?currency=mxn&sort=variance_amount&limit=1", nil, &page); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if page.Total != 2 || len(page.Results) != 1 || page.Results[0].ID != "R1" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	next := page.NextCursor
+	page = store.ResultPage{}
+	if code := doJSON(t, "GET", base+"?currency=mxn&sort=variance_amount&limit=1&cursor="+next, nil, &page); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if len(page.Results) != 1 || page.Results[0].ID != "R0" || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	var body map[string]string
+	for _, query := range []string{
+		"?cursor=not-a-cursor",
+		"?currency=mxn&sort=-variance_amount&cursor=" + next, // issued for another sort
+	} {
+		if code := doJSON(t, "GET", base+query, nil, &body); code != http.StatusBadRequest || !strings.Contains(body["error"], "invalid cursor") {
+			t.Errorf("%s: expected 400 invalid cursor, got %d %v", query, code, body)
+		}
+	}
+	if code := doJSON(t, "GET", base+"?status=settled", nil, &body); code != http.StatusBadRequest {
+		t.Errorf("unknown status: expected 400, got %d", code)
+	}
+	if code := doJSON(t, "GET", srv.URL+"/api/v1/reconciliation/runs/RUN-0404/results", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown run: expected 404, got %d", code)
+	}
+}
+
+// addRecords adds a transaction and the settlement that matches it to s.
+func addRecords(t *testing.T, s store.Store) {
+	t.Helper()
+	authAt := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	_, err := s.AddTransactions([]models.Transaction{{
+		ID: "TXN-1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "MXN", Country: "MX", AuthorizedAt: authAt,
+	}})
+	if err == nil {
+		_, err = s.AddSettlements([]models.SettlementRecord{{
+			ID: "S-1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour),
+		}})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// trigger starts a run at url and returns its ID.
+func trigger(t *testing.T, url string) string {
+	t.Helper()
+	var body map[string]any
+	if code := doJSON(t, "POST", url, nil, &body); code != http.StatusAccepted {
+		t.Fatalf("POST %s: expected 202, got %d %v", url, code, body)
+	}
+	if body["status"] != models.RunPending {
+		t.Errorf("expected a pending run, got %v", body)
+	}
+	id, _ := body["run_id"].(string)
+	return id
+}
+
+// waitForRun polls a run until it is neither pending nor running.
+func waitForRun(t *testing.T, base, runID string) models.ReconciliationRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var run models.ReconciliationRun
+		if code := doJSON(t, "GET", base+"/api/v1/reconciliation/runs/"+runID, nil, &run); code != http.StatusOK {
+			t.Fatalf("GET run %s: expected 200, got %d", runID, code)
+		}
+		if run.Status != models.RunPending && run.Status != models.RunRunning {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s still %s", runID, run.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// block occupies the pool's only worker until the returned func is called.
+func block(t *testing.T, h *Handler) (release func()) {
+	t.Helper()
+	started, done := make(chan struct{}), make(chan struct{})
+	if err := h.jobs.Submit("blocker", func(context.Context) {
+		close(started)
+		<-done
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	var once sync.Once
+	release = func() { once.Do(func() { close(done) }) }
+	t.Cleanup(release) // before the pool is closed
+	return release
+}
+
+func TestRunCompletesAndReplays(t *testing.T) {
+	srv, _, s := newTestServer(t)
+	addRecords(t, s)
+
+	runID := trigger(t, srv.URL+"/api/v1/reconciliation/run")
+	run := waitForRun(t, srv.URL, runID)
+	if run.Status != models.RunCompleted || run.Progress != 100 || run.StartedAt == nil || run.FinishedAt == nil {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if run.Snapshot == nil || run.ReportHash == "" || run.Report == nil || run.Report.Summary.Matched != 1 {
+		t.Fatalf("expected a snapshot, a report and its hash: %+v", run)
+	}
+
+	var body map[string]string
+	if code := doJSON(t, "POST", srv.URL+"/api/v1/reconciliation/runs/"+runID+"/cancel", nil, &body); code != http.StatusConflict {
+		t.Errorf("cancelling a completed run: expected 409, got %d", code)
+	}
+
+	// New records do not change what a replay reconciles.
+	if _, err := s.AddTransactions([]models.Transaction{{ID: "TXN-2", ProcessorName: "P1", Amount: money.MustParse("5.00"), Currency: "MXN"}}); err != nil {
+		t.Fatal(err)
+	}
+	replayID := trigger(t, srv.URL+"/api/v1/reconciliation/runs/"+runID+"/replay")
+	replay := waitForRun(t, srv.URL, replayID)
+	if replay.Status != models.RunCompleted || replay.ReplayOf != runID {
+		t.Fatalf("unexpected replay: %+v", replay)
+	}
+	if replay.Replay == nil || !replay.Replay.Identical || replay.ReportHash != run.ReportHash {
+		t.Errorf("expected the replay to reproduce the report: %+v", replay.Replay)
+	}
+
+	for _, path := range []string{"/api/v1/reconciliation/runs/RUN-0404/cancel", "/api/v1/reconciliation/runs/RUN-0404/replay"} {
+		if code := doJSON(t, "POST", srv.URL+path, nil, nil); code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, code)
+		}
+	}
+}
+
+func TestRunWithoutSnapshotCannotBeReplayed(t *testing.T) {
+	srv, _, s := newTestServer(t)
+	if err := s.SaveRun(&models.ReconciliationRun{ID: "RUN-0001", Status: models.RunFailed}); err != nil {
+		t.Fatal(err)
+	}
+	if code := doJSON(t, "POST", srv.URL+"/api/v1/reconciliation/runs/RUN-0001/replay", nil, nil); code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", code)
+	}
+}
+
+func TestCancelQueuedRun(t *testing.T) {
+	srv, h, s := newTestServer(t)
+	addRecords(t, s)
+	release := block(t, h)
+
+	runID := trigger(t, srv.URL+"/api/v1/reconciliation/run")
+	var body map[string]any
+	if code := doJSON(t, "POST", srv.URL+"/api/v1/reconciliation/runs/"+runID+"/cancel", nil, &body); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d %v", code, body)
+	}
+	release()
+
+	run := waitForRun(t, srv.URL, runID)
+	if run.Status != models.RunCancelled || run.Error != "cancelled by request" || run.Report != nil {
+		t.Errorf("expected a cancelled run, got %+v", run)
+	}
+	if code := doJSON(t, "POST", srv.URL+"/api/v1/reconciliation/runs/"+runID+"/cancel", nil, nil); code != http.StatusConflict {
+		t.Errorf("cancelling a cancelled run: expected 409, got %d", code)
+	}
+}
+
+func TestRunFailsWhenQueueIsFull(t *testing.T) {
+	s := store.New()
+	srv, h := serve(t, s, jobs.New(1, 1))
+	block(t, h)
+
+	queued := trigger(t, srv.URL+"/api/v1/reconciliation/run")
+	var body map[string]string
+	if code := doJSON(t, "POST", srv.URL+"/api/v1/reconciliation/run", nil, &body); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d %v", code, body)
+	}
+	rejected, err := s.GetRun("RUN-0002")
+	if err != nil || rejected.Status != models.RunFailed || rejected.Error != jobs.ErrQueueFull.Error() {
+		t.Errorf("expected the rejected run to be failed, got %+v, %v", rejected, err)
+	}
+	if run, err := s.GetRun(queued); err != nil || run.Status != models.RunPending {
+		t.Errorf("expected %s to stay queued, got %+v, %v", queued, run, err)
+	}
+}
+
+// failingInputsStore cannot record run inputs.
+type failingInputsStore struct{ store.Store }
+
+func (failingInputsStore) SaveRunInputs(string, models.RunInputs) error {
+	return errors.New("disk full")
+}
+
+func TestRunFails(t *testing.T) {
+	s := failingInputsStore{store.New()}
+	srv, _ := serve(t, s, jobs.New(1, 10))
+	addRecords(t, s)
+
+	run := waitForRun(t, srv.URL, trigger(t, srv.URL+"/api/v1/reconciliation/run"))
+	if run.Status != models.RunFailed || run.Error != "recording run inputs: disk full" || run.FinishedAt == nil {
+		t.Errorf("expected a failed run, got %+v", run)
+	}
+}
+
+func TestFailInterruptedRuns(t *testing.T) {
+	srv, h, s := newTestServer(t)
+	for id, status := range map[string]string{"RUN-0001": models.RunCompleted, "RUN-0002": models.RunRunning, "RUN-0003": models.RunPending, "RUN-0004": models.RunCancelled} {
+		if err := s.SaveRun(&models.ReconciliationRun{ID: id, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.FailInterruptedRuns(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"RUN-0001": models.RunCompleted, "RUN-0002": models.RunFailed, "RUN-0003": models.RunFailed, "RUN-0004": models.RunCancelled}
+	for id, status := range want {
+		run := waitForRun(t, srv.URL, id)
+		if run.Status != status {
+			t.Errorf("%s: expected %s, got %s", id, status, run.Status)
+		}
+		if interrupted := run.Error == "interrupted by server restart"; interrupted != (status == models.RunFailed) {
+			t.Errorf("%s: unexpected error %q", id, run.Error)
+		}
+	}
+
+	// New runs get IDs past the stored ones.
+	if id := trigger(t, srv.URL+"/api/v1/reconciliation/run"); id != "RUN-0005" {
+		t.Errorf("expected RUN-0005, got %s", id)
+	}
+}
@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// Adapter parses a processor's native settlement file into SettlementRecords.
+type Adapter interface {
+	// Processor returns the ProcessorName the adapter handles.
+	Processor() string
+
+	// Parse reads a settlement file. Rows that cannot be converted are skipped and
+	// reported as RowErrors; the error is only set when the file is unusable as a whole.
+	Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Adapter)
+)
+
+// Register makes an adapter available under its processor name.
+// It panics if an adapter for the same processor is already registered.
+func Register(a Adapter) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := a.Processor()
+	if _, dup := registry[name]; dup {
+		panic("ingest: adapter already registered for processor " + name)
+	}
+	registry[name] = a
+}
+
+// Lookup returns the adapter registered for the given processor name.
+func Lookup(processor string) (Adapter, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	a, ok := registry[processor]
+	return a, ok
+}
+
+// Processors returns the names of all processors with a registered adapter, sorted.
+func Processors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readTable reads a delimited file with a header row and calls fn for every
+// non-blank data row with a header -> value lookup. RowErrors returned by fn are
+// stamped with the row's line number.
+// Missing required headers make the whole file unusable.
+func readTable(r io.Reader, comma rune, required []string, fn func(get func(col string) string) *RowError) ([]RowError, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty file")
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel exports start with a BOM.
+	}
+	colIndex := make(map[string]int, len(header))
+	for i, h := range header {
+		colIndex[strings.TrimSpace(h)] = i
+	}
+	var missing []string
+	for _, col := range required {
+		if _, ok := colIndex[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+
+	var rowErrs []RowError
+	for {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return rowErrs, fmt.Errorf("reading file: %w", err)
+			}
+			rowErrs = append(rowErrs, RowError{Row: pe.StartLine, Message: pe.Err.Error()})
+			continue
+		}
+		if isBlank(fields) {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) string {
+			i, ok := colIndex[col]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+		if rowErr := fn(get); rowErr != nil {
+			rowErr.Row = line
+			rowErrs = append(rowErrs, *rowErr)
+		}
+	}
+	return rowErrs, nil
+}
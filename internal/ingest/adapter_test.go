@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestAdaptersGolden parses testdata/adapters/<processor>.<ext> with each registered
+// adapter and compares the records and row errors to <processor>.golden.json.
+// Run with -update to regenerate the golden files after an intended change.
+func TestAdaptersGolden(t *testing.T) {
+	for _, name := range Processors() {
+		t.Run(name, func(t *testing.T) {
+			adapter, _ := Lookup(name)
+
+			inputs, err := filepath.Glob(filepath.Join("testdata", "adapters", name+".*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var input string
+			for _, p := range inputs {
+				if !strings.HasSuffix(p, ".golden.json") {
+					input = p
+				}
+			}
+			if input == "" {
+				t.Fatalf("no sample file for %s in testdata/adapters", name)
+			}
+
+			f, err := os.Open(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			recs, rowErrs, err := adapter.Parse(f)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(recs) == 0 {
+				t.Fatal("expected at least one parsed record")
+			}
+			for _, rec := range recs {
+				if rec.ProcessorName != name {
+					t.Errorf("record %s has processor %q, want %q", rec.ID, rec.ProcessorName, name)
+				}
+			}
+
+			got, err := json.MarshalIndent(struct {
+				Records []models.SettlementRecord `json:"records"`
+				Errors  []RowError                `json:"errors"`
+			}{recs, rowErrs}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "adapters", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s (run with -update if intended)\n--- got ---\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering a second PaySureMX adapter")
+		}
+	}()
+	Register(paySureMX{})
+}
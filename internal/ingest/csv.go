@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// RowError describes a CSV row that could not be converted into a settlement record.
+type RowError struct {
+	Row     int    `json:"row"` // 1-based line number in the file, the header is row 1
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d, column %q: %s", e.Row, e.Column, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// requiredFields must be mapped to a CSV column. processor_name is only
+// required when the caller does not supply the processor.
+var requiredFields = []string{"id", "gross_amount", "currency", "settled_at"}
+
+// ParseSettlementsCSV reads settlement records from a CSV file laid out as described by m.
+// If processor is non-empty it is used for every record and the processor_name column is optional.
+// Rows that fail to parse are skipped and reported as RowErrors; the returned error is only
+// set when the file itself is unusable (unreadable header, missing required columns).
+func ParseSettlementsCSV(r io.Reader, processor string, m models.CSVMapping) ([]models.SettlementRecord, []RowError, error) {
+	comma := ','
+	if m.Delimiter != "" {
+		d, size := utf8.DecodeRuneInString(m.Delimiter)
+		if size != len(m.Delimiter) {
+			return nil, nil, fmt.Errorf("delimiter must be a single character, got %q", m.Delimiter)
+		}
+		comma = d
+	}
+
+	required := requiredFields
+	if processor == "" {
+		required = append([]string{"processor_name"}, required...)
+	}
+	headers := make([]string, 0, len(required))
+	for _, f := range required {
+		col := m.Columns[f]
+		if col == "" {
+			return nil, nil, fmt.Errorf("mapping has no column for required field %s", f)
+		}
+		headers = append(headers, col)
+	}
+	if m.Columns["processor_txn_id"] == "" && m.Columns["order_reference"] == "" && m.Columns["processor_txn_ids"] == "" {
+		return nil, nil, errors.New("mapping needs a processor_txn_id, order_reference or processor_txn_ids column")
+	}
+
+	var recs []models.SettlementRecord
+	rowErrs, err := readTable(r, comma, headers, func(get func(string) string) *RowError {
+		rec, rowErr := parseRow(func(field string) string { return get(m.Columns[field]) }, processor, m)
+		if rowErr != nil {
+			return rowErr
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recs, rowErrs, nil
+}
+
+func parseRow(get func(field string) string, processor string, m models.CSVMapping) (models.SettlementRecord, *RowError) {
+	fail := func(field, format string, args ...any) (models.SettlementRecord, *RowError) {
+		return models.SettlementRecord{}, &RowError{Column: m.Columns[field], Message: fmt.Sprintf(format, args...)}
+	}
+
+	rec := models.SettlementRecord{
+		ID:                     get("id"),
+		ProcessorName:          processor,
+		ProcessorTxnID:         get("processor_txn_id"),
+		OrderReference:         get("order_reference"),
+		Currency:               strings.ToUpper(get("currency")),
+		SettlementBatchID:      get("settlement_batch_id"),
+		OriginalProcessorTxnID: get("original_processor_txn_id"),
+		ProcessorTxnIDs:        splitRefs(get("processor_txn_ids")),
+	}
+	if rec.ProcessorName == "" {
+		rec.ProcessorName = get("processor_name")
+	}
+
+	if rec.ID == "" {
+		return fail("id", "settlement ID is empty")
+	}
+	if rec.ProcessorName == "" {
+		return fail("processor_name", "processor name is empty")
+	}
+	if rec.ProcessorTxnID == "" && rec.OrderReference == "" && len(rec.ProcessorTxnIDs) == 0 {
+		return fail("processor_txn_id", "neither processor transaction ID nor order reference is set")
+	}
+	if rec.Currency == "" {
+		return fail("currency", "currency is empty")
+	}
+
+	var err error
+	if v := get("record_type"); v != "" {
+		if rec.RecordType, err = ParseRecordType(v); err != nil {
+			return fail("record_type", "%v", err)
+		}
+	}
+	if rec.GrossAmount, err = ParseAmount(get("gross_amount"), m.DecimalSeparator, m.ThousandsSeparator); err != nil {
+		return fail("gross_amount", "%v", err)
+	}
+	if v := get("fee_amount"); v != "" {
+		if rec.FeeAmount, err = ParseAmount(v, m.DecimalSeparator, m.ThousandsSeparator); err != nil {
+			return fail("fee_amount", "%v", err)
+		}
+	}
+	if v := get("net_amount"); v != "" {
+		if rec.NetAmount, err = ParseAmount(v, m.DecimalSeparator, m.ThousandsSeparator); err != nil {
+			return fail("net_amount", "%v", err)
+		}
+	} else {
+		rec.NetAmount = rec.GrossAmount.Sub(rec.FeeAmount)
+	}
+	if rec.SettledAt, err = ParseDate(get("settled_at"), m.DateLayout); err != nil {
+		return fail("settled_at", "%v", err)
+	}
+	return rec, nil
+}
+
+// splitRefs splits a "|"-separated list of references, dropping empty entries.
+func splitRefs(s string) []string {
+	var refs []string
+	for _, ref := range strings.Split(s, "|") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// recordTypeAliases maps the record type spellings found in processor files to record types.
+var recordTypeAliases = map[string]models.RecordType{
+	"":                    models.RecordSale,
+	"sale":                models.RecordSale,
+	"payment":             models.RecordSale,
+	"capture":             models.RecordSale,
+	"refund":              models.RecordRefund,
+	"chargeback":          models.RecordChargeback,
+	"dispute":             models.RecordChargeback,
+	"chargeback_reversal": models.RecordChargebackReversal,
+	"reversal":            models.RecordChargebackReversal,
+	"adjustment":          models.RecordAdjustment,
+}
+
+// ParseRecordType parses a record type case-insensitively, accepting common
+// aliases ("payment", "dispute", "reversal", ...). Empty means a sale.
+func ParseRecordType(s string) (models.RecordType, error) {
+	key := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+	rt, ok := recordTypeAliases[key]
+	if !ok {
+		return "", fmt.Errorf("unknown record type %q", s)
+	}
+	return rt, nil
+}
+
+// ParseAmount parses a locale-formatted decimal number such as "1.234,56"
+// (decimalSep ",", thousandsSep ".") or "1,234.56" (decimalSep ".", thousandsSep ",").
+// An empty decimalSep means ".".
+func ParseAmount(s, decimalSep, thousandsSep string) (money.Amount, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return money.Amount{}, errors.New("amount is empty")
+	}
+	if decimalSep == "" {
+		decimalSep = "."
+	}
+	if thousandsSep != "" {
+		s = strings.ReplaceAll(s, thousandsSep, "")
+	}
+	if strings.Count(s, decimalSep) > 1 {
+		return money.Amount{}, fmt.Errorf("invalid amount %q", raw)
+	}
+	s = strings.Replace(s, decimalSep, ".", 1)
+	v, err := money.Parse(s)
+	if err != nil {
+		return money.Amount{}, fmt.Errorf("invalid amount %q", raw)
+	}
+	return v, nil
+}
+
+// dateFallbackLayouts are tried when no explicit layout is configured.
+var dateFallbackLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseDate parses s with layout, or with the fallback layouts if layout is empty.
+// Values without a zone are interpreted as UTC.
+func ParseDate(s, layout string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, errors.New("date is empty")
+	}
+	layouts := dateFallbackLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func isBlank(fields []string) bool {
+	for _, f := range fields {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in                 string
+		decimal, thousands string
+		want               string
+		wantErr            bool
+	}{
+		{"1234.56", "", "", "1234.56", false},
+		{"1,234.56", ".", ",", "1234.56", false},
+		{"1.234,56", ",", ".", "1234.56", false},
+		{"-12,5", ",", ".", "-12.50", false},
+		{" 7 ", "", "", "7.00", false},
+		{"12,3,4", ",", ".", "", true},
+		{"abc", "", "", "", true},
+		{"", "", "", "", true},
+	}
+	for _, c := range cases {
+		got, err := ParseAmount(c.in, c.decimal, c.thousands)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseAmount(%q): err = %v, wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if err == nil && got.String() != c.want {
+			t.Errorf("ParseAmount(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseSettlementsCSVWithMapping(t *testing.T) {
+	mapping := models.CSVMapping{
+		Columns: map[string]string{
+			"id":               "id_liquidacao",
+			"processor_txn_id": "id_transacao",
+			"order_reference":  "pedido",
+			"gross_amount":     "valor_bruto",
+			"fee_amount":       "tarifa",
+			"currency":         "moeda",
+			"settled_at":       "data_credito",
+		},
+		Delimiter:          ";",
+		DecimalSeparator:   ",",
+		ThousandsSeparator: ".",
+		DateLayout:         "02/01/2006",
+	}
+	file := strings.Join([]string{
+		"id_liquidacao;id_transacao;pedido;valor_bruto;tarifa;moeda;data_credito",
+		"BC-1;Bra-TXN-000001;ORD-000001;1.234,56;30,86;brl;17/01/2025",
+		"BC-2;Bra-TXN-000002;ORD-000002;12,3,4;0;BRL;17/01/2025",
+		"BC-3;Bra-TXN-000003;ORD-000003;10,00;0;BRL;2025-01-17",
+		"",
+		"BC-4;;;10,00;0;BRL;17/01/2025",
+	}, "\n")
+
+	recs, rowErrs, err := ParseSettlementsCSV(strings.NewReader(file), "BrazilConnect", mapping)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 valid record, got %d", len(recs))
+	}
+	rec := recs[0]
+	if rec.ProcessorName != "BrazilConnect" || rec.Currency != "BRL" {
+		t.Errorf("unexpected processor/currency: %s/%s", rec.ProcessorName, rec.Currency)
+	}
+	if rec.GrossAmount != money.MustParse("1234.56") || rec.FeeAmount != money.MustParse("30.86") || rec.NetAmount != money.MustParse("1203.70") {
+		t.Errorf("unexpected amounts: gross %s fee %s net %s", rec.GrossAmount, rec.FeeAmount, rec.NetAmount)
+	}
+	if !rec.SettledAt.Equal(time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected settled_at: %v", rec.SettledAt)
+	}
+
+	if len(rowErrs) != 3 {
+		t.Fatalf("expected 3 row errors, got %d: %v", len(rowErrs), rowErrs)
+	}
+	wantRows := []struct {
+		row    int
+		column string
+	}{{3, "valor_bruto"}, {4, "data_credito"}, {6, "id_transacao"}}
+	for i, w := range wantRows {
+		if rowErrs[i].Row != w.row || rowErrs[i].Column != w.column {
+			t.Errorf("row error %d: got row %d column %q, want row %d column %q",
+				i, rowErrs[i].Row, rowErrs[i].Column, w.row, w.column)
+		}
+	}
+}
+
+func TestParseSettlementsCSVMissingColumns(t *testing.T) {
+	file := "id,gross_amount\nS1,10\n"
+	_, _, err := ParseSettlementsCSV(strings.NewReader(file), "", models.DefaultCSVMapping())
+	if err == nil {
+		t.Fatal("expected error for missing required columns")
+	}
+}
+
+func TestParseSettlementsCSVAggregatedLine(t *testing.T) {
+	file := strings.Join([]string{
+		"id,processor_txn_id,processor_txn_ids,gross_amount,currency,settled_at",
+		"S1,,PSM-1| PSM-2 ||PSM-3,300.00,MXN,2025-01-17",
+	}, "\n")
+	recs, rowErrs, err := ParseSettlementsCSV(strings.NewReader(file), "PaySureMX", models.DefaultCSVMapping())
+	if err != nil || len(rowErrs) != 0 {
+		t.Fatalf("unexpected errors: %v %v", err, rowErrs)
+	}
+	if got := recs[0].ProcessorTxnIDs; !slices.Equal(got, []string{"PSM-1", "PSM-2", "PSM-3"}) {
+		t.Errorf("unexpected processor_txn_ids: %q", got)
+	}
+}
+
+func TestParseRecordType(t *testing.T) {
+	cases := map[string]models.RecordType{
+		"":                    models.RecordSale,
+		"Refund":              models.RecordRefund,
+		" DISPUTE ":           models.RecordChargeback,
+		"chargeback-reversal": models.RecordChargebackReversal,
+		"adjustment":          models.RecordAdjustment,
+	}
+	for in, want := range cases {
+		if got, err := ParseRecordType(in); err != nil || got != want {
+			t.Errorf("ParseRecordType(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseRecordType("payout"); err == nil {
+		t.Error("expected error for unknown record type")
+	}
+}
+
+func TestParseFXRatesCSV(t *testing.T) {
+	file := strings.Join([]string{
+		"from,to,date,rate",
+		"brl,usd,2025-01-15,0.165",
+		"MXN,USD,2025-01-15T18:30:00Z,0.049",
+		"MXN,USD,2025-01-16,-1",
+		"MXN,USD,16/01/2025,0.05",
+	}, "\n")
+	rates, rowErrs, err := ParseFXRatesCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	want := []models.FXRate{
+		{From: "BRL", To: "USD", Date: day, Rate: 0.165},
+		{From: "MXN", To: "USD", Date: day, Rate: 0.049},
+	}
+	if !slices.Equal(rates, want) {
+		t.Errorf("rates = %+v, want %+v", rates, want)
+	}
+	if len(rowErrs) != 2 || rowErrs[0].Row != 4 || rowErrs[1].Row != 5 {
+		t.Errorf("unexpected row errors: %v", rowErrs)
+	}
+}
@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// fxColumns are the columns of an FX rate CSV file.
+var fxColumns = []string{"from", "to", "date", "rate"}
+
+// ParseFXRatesCSV reads dated FX rates from a comma-separated file with from,
+// to, date and rate columns. Rows that fail to parse are skipped and reported
+// as RowErrors.
+func ParseFXRatesCSV(r io.Reader) ([]models.FXRate, []RowError, error) {
+	var rates []models.FXRate
+	rowErrs, err := readTable(r, ',', fxColumns, func(get func(string) string) *RowError {
+		rate, err := strconv.ParseFloat(get("rate"), 64)
+		if err != nil {
+			return &RowError{Column: "rate", Message: fmt.Sprintf("invalid rate %q", get("rate"))}
+		}
+		fx, err := NewFXRate(get("from"), get("to"), get("date"), rate)
+		if err != nil {
+			return &RowError{Message: err.Error()}
+		}
+		rates = append(rates, fx)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rates, rowErrs, nil
+}
+
+// NewFXRate validates a dated FX rate. Currencies are upper-cased and the date
+// is parsed with ParseDate and truncated to its UTC day.
+func NewFXRate(from, to, date string, rate float64) (models.FXRate, error) {
+	from, to = strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(strings.TrimSpace(to))
+	if from == "" || to == "" {
+		return models.FXRate{}, errors.New("from and to currencies are required")
+	}
+	if rate <= 0 {
+		return models.FXRate{}, fmt.Errorf("rate must be positive, got %v", rate)
+	}
+	day, err := ParseDate(date, "")
+	if err != nil {
+		return models.FXRate{}, err
+	}
+	return models.FXRate{From: from, To: to, Date: day.Truncate(24 * time.Hour), Rate: rate}, nil
+}
@@ -0,0 +1,381 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// Native settlement file adapters for the processors we currently work with.
+// Each file layout is documented on its adapter.
+
+func init() {
+	Register(paySureMX{})
+	Register(globalTransact{})
+	Register(latamPay{})
+	Register(brazilConnect{})
+	Register(andesPago{})
+}
+
+// paySureMX reads PaySureMX's comma-separated daily liquidation report. Headers are in
+// Spanish, amounts use "," as thousands separator, dates are dd/mm/yyyy hh:mm, and the
+// fee is split into the commission and the VAT charged on it.
+//
+//	folio,referencia,pedido,moneda,importe_bruto,comision,iva_comision,importe_neto,fecha_liquidacion,lote
+type paySureMX struct{}
+
+func (paySureMX) Processor() string { return "PaySureMX" }
+
+func (a paySureMX) Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error) {
+	required := []string{"folio", "referencia", "moneda", "importe_bruto", "comision", "iva_comision", "importe_neto", "fecha_liquidacion"}
+	var recs []models.SettlementRecord
+	rowErrs, err := readTable(r, ',', required, func(get func(string) string) *RowError {
+		amount := func(col string) (money.Amount, *RowError) {
+			v, err := ParseAmount(get(col), ".", ",")
+			if err != nil {
+				return money.Amount{}, &RowError{Column: col, Message: err.Error()}
+			}
+			return v, nil
+		}
+		gross, rowErr := amount("importe_bruto")
+		if rowErr != nil {
+			return rowErr
+		}
+		commission, rowErr := amount("comision")
+		if rowErr != nil {
+			return rowErr
+		}
+		vat, rowErr := amount("iva_comision")
+		if rowErr != nil {
+			return rowErr
+		}
+		net, rowErr := amount("importe_neto")
+		if rowErr != nil {
+			return rowErr
+		}
+		settledAt, err := ParseDate(get("fecha_liquidacion"), "02/01/2006 15:04")
+		if err != nil {
+			return &RowError{Column: "fecha_liquidacion", Message: err.Error()}
+		}
+		if get("folio") == "" || get("referencia") == "" {
+			return &RowError{Column: "referencia", Message: "folio and referencia are required"}
+		}
+		recs = append(recs, models.SettlementRecord{
+			ID:                "PSM-" + get("folio"),
+			ProcessorName:     a.Processor(),
+			ProcessorTxnID:    get("referencia"),
+			OrderReference:    get("pedido"),
+			GrossAmount:       gross,
+			FeeAmount:         commission.Add(vat),
+			NetAmount:         net,
+			Currency:          strings.ToUpper(get("moneda")),
+			SettledAt:         settledAt,
+			SettlementBatchID: get("lote"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recs, rowErrs, nil
+}
+
+// globalTransact reads GlobalTransact's JSON settlement report: one document per payout
+// with a shared currency and date, and an itemised fee list per transaction. RowError.Row
+// is the 1-based position in the transactions array.
+//
+//	{"report_id": "...", "currency": "USD", "settlement_date": "2025-01-17T09:00:00Z",
+//	 "transactions": [{"line_id": "...", "transaction_id": "...", "merchant_reference": "...",
+//	                   "gross": "100.00", "fees": [{"type": "...", "amount": "1.20"}], "net": "98.80"}]}
+type globalTransact struct{}
+
+func (globalTransact) Processor() string { return "GlobalTransact" }
+
+func (a globalTransact) Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error) {
+	var doc struct {
+		ReportID       string `json:"report_id"`
+		Currency       string `json:"currency"`
+		SettlementDate string `json:"settlement_date"`
+		Transactions   []struct {
+			LineID            string      `json:"line_id"`
+			TransactionID     string      `json:"transaction_id"`
+			MerchantReference string      `json:"merchant_reference"`
+			Gross             json.Number `json:"gross"`
+			Net               json.Number `json:"net"`
+			Fees              []struct {
+				Type   string      `json:"type"`
+				Amount json.Number `json:"amount"`
+			} `json:"fees"`
+		} `json:"transactions"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if doc.Currency == "" {
+		return nil, nil, errors.New("report has no currency")
+	}
+	settledAt, err := ParseDate(doc.SettlementDate, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("settlement_date: %w", err)
+	}
+
+	var recs []models.SettlementRecord
+	var rowErrs []RowError
+	for i, t := range doc.Transactions {
+		row := i + 1
+		if t.LineID == "" || t.TransactionID == "" {
+			rowErrs = append(rowErrs, RowError{Row: row, Column: "transaction_id", Message: "line_id and transaction_id are required"})
+			continue
+		}
+		gross, err := ParseAmount(t.Gross.String(), ".", "")
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: row, Column: "gross", Message: err.Error()})
+			continue
+		}
+		net, err := ParseAmount(t.Net.String(), ".", "")
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: row, Column: "net", Message: err.Error()})
+			continue
+		}
+		var fee money.Amount
+		var feeErr error
+		for _, f := range t.Fees {
+			v, err := ParseAmount(f.Amount.String(), ".", "")
+			if err != nil {
+				feeErr = fmt.Errorf("fee %q: %w", f.Type, err)
+				break
+			}
+			fee = fee.Add(v)
+		}
+		if feeErr != nil {
+			rowErrs = append(rowErrs, RowError{Row: row, Column: "fees", Message: feeErr.Error()})
+			continue
+		}
+		recs = append(recs, models.SettlementRecord{
+			ID:                "GT-" + t.LineID,
+			ProcessorName:     a.Processor(),
+			ProcessorTxnID:    t.TransactionID,
+			OrderReference:    t.MerchantReference,
+			GrossAmount:       gross,
+			FeeAmount:         fee,
+			NetAmount:         net,
+			Currency:          strings.ToUpper(doc.Currency),
+			SettledAt:         settledAt,
+			SettlementBatchID: doc.ReportID,
+		})
+	}
+	return recs, rowErrs, nil
+}
+
+// latamPay reads LatamPay's semicolon-separated payout file. Amounts are integers in
+// minor units of the row's currency (cents for MXN, COP, BRL and USD) and dates are
+// ISO yyyy-mm-dd.
+//
+//	line_id;psp_reference;merchant_order;currency;gross_minor;fee_minor;net_minor;settled_on;payout_id
+type latamPay struct{}
+
+func (latamPay) Processor() string { return "LatamPay" }
+
+func (a latamPay) Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error) {
+	required := []string{"line_id", "psp_reference", "currency", "gross_minor", "fee_minor", "net_minor", "settled_on"}
+	var recs []models.SettlementRecord
+	rowErrs, err := readTable(r, ';', required, func(get func(string) string) *RowError {
+		currency := strings.ToUpper(get("currency"))
+		minor := func(col string) (money.Amount, *RowError) {
+			v, err := strconv.ParseInt(get(col), 10, 64)
+			if err != nil {
+				return money.Amount{}, &RowError{Column: col, Message: fmt.Sprintf("invalid minor-unit amount %q", get(col))}
+			}
+			return money.FromMinor(v, currency), nil
+		}
+		gross, rowErr := minor("gross_minor")
+		if rowErr != nil {
+			return rowErr
+		}
+		fee, rowErr := minor("fee_minor")
+		if rowErr != nil {
+			return rowErr
+		}
+		net, rowErr := minor("net_minor")
+		if rowErr != nil {
+			return rowErr
+		}
+		settledAt, err := ParseDate(get("settled_on"), "2006-01-02")
+		if err != nil {
+			return &RowError{Column: "settled_on", Message: err.Error()}
+		}
+		if get("line_id") == "" || get("psp_reference") == "" {
+			return &RowError{Column: "psp_reference", Message: "line_id and psp_reference are required"}
+		}
+		recs = append(recs, models.SettlementRecord{
+			ID:                "LTP-" + get("line_id"),
+			ProcessorName:     a.Processor(),
+			ProcessorTxnID:    get("psp_reference"),
+			OrderReference:    get("merchant_order"),
+			GrossAmount:       gross,
+			FeeAmount:         fee,
+			NetAmount:         net,
+			Currency:          currency,
+			SettledAt:         settledAt,
+			SettlementBatchID: get("payout_id"),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recs, rowErrs, nil
+}
+
+// brazilConnect reads BrazilConnect's semicolon-separated extrato with pt-BR number
+// formatting (1.234,56) and dd/mm/yyyy dates. The layout is regular enough to be
+// described as a CSVMapping.
+//
+//	id_liquidacao;id_transacao;pedido;valor_bruto;tarifa;valor_liquido;moeda;data_credito;lote
+type brazilConnect struct{}
+
+func (brazilConnect) Processor() string { return "BrazilConnect" }
+
+var brazilConnectMapping = models.CSVMapping{
+	Columns: map[string]string{
+		"id":                  "id_liquidacao",
+		"processor_txn_id":    "id_transacao",
+		"order_reference":     "pedido",
+		"gross_amount":        "valor_bruto",
+		"fee_amount":          "tarifa",
+		"net_amount":          "valor_liquido",
+		"currency":            "moeda",
+		"settled_at":          "data_credito",
+		"settlement_batch_id": "lote",
+	},
+	Delimiter:          ";",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: ".",
+	DateLayout:         "02/01/2006",
+}
+
+func (a brazilConnect) Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error) {
+	return ParseSettlementsCSV(r, a.Processor(), brazilConnectMapping)
+}
+
+// andesPago reads AndesPago's pipe-delimited batch file made of a header record, detail
+// records and a trailer carrying the detail count. Detail timestamps are yyyymmddhhmmss.
+//
+//	H|ANDESPAGO|<yyyymmdd>|<batch id>
+//	D|<processor txn id>|<order reference>|<currency>|<gross>|<fee>|<net>|<settled at>
+//	T|<detail count>
+type andesPago struct{}
+
+func (andesPago) Processor() string { return "AndesPago" }
+
+func (a andesPago) Parse(r io.Reader) ([]models.SettlementRecord, []RowError, error) {
+	sc := bufio.NewScanner(r)
+	var (
+		recs     []models.SettlementRecord
+		rowErrs  []RowError
+		batchID  string
+		details  int
+		trailer  bool
+		line     int
+		sawFirst bool
+	)
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "|")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if !sawFirst {
+			sawFirst = true
+			if fields[0] != "H" || len(fields) < 4 || fields[3] == "" {
+				return nil, nil, errors.New("file does not start with an H|ANDESPAGO|<date>|<batch> header record")
+			}
+			batchID = fields[3]
+			continue
+		}
+		if trailer {
+			rowErrs = append(rowErrs, RowError{Row: line, Message: "record after trailer"})
+			continue
+		}
+
+		switch fields[0] {
+		case "D":
+			details++
+			if len(fields) != 8 {
+				rowErrs = append(rowErrs, RowError{Row: line, Message: fmt.Sprintf("detail record has %d fields, want 8", len(fields))})
+				continue
+			}
+			rec, rowErr := a.parseDetail(fields, batchID, details)
+			if rowErr != nil {
+				rowErr.Row = line
+				rowErrs = append(rowErrs, *rowErr)
+				continue
+			}
+			recs = append(recs, rec)
+		case "T":
+			trailer = true
+			if len(fields) < 2 {
+				rowErrs = append(rowErrs, RowError{Row: line, Message: "trailer record has no detail count"})
+				continue
+			}
+			want, err := strconv.Atoi(fields[1])
+			if err != nil || want != details {
+				rowErrs = append(rowErrs, RowError{Row: line, Message: fmt.Sprintf("trailer declares %s detail records, file has %d", fields[1], details)})
+			}
+		default:
+			rowErrs = append(rowErrs, RowError{Row: line, Message: fmt.Sprintf("unknown record type %q", fields[0])})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading file: %w", err)
+	}
+	if !sawFirst {
+		return nil, nil, errors.New("empty settlement file")
+	}
+	if !trailer {
+		rowErrs = append(rowErrs, RowError{Row: line, Message: "file has no trailer record; it may be truncated"})
+	}
+	return recs, rowErrs, nil
+}
+
+func (a andesPago) parseDetail(fields []string, batchID string, seq int) (models.SettlementRecord, *RowError) {
+	names := [...]string{"record_type", "processor_txn_id", "order_reference", "currency", "gross", "fee", "net", "settled_at"}
+	var amounts [3]money.Amount
+	for i := range amounts {
+		v, err := ParseAmount(fields[4+i], ".", "")
+		if err != nil {
+			return models.SettlementRecord{}, &RowError{Column: names[4+i], Message: err.Error()}
+		}
+		amounts[i] = v
+	}
+	settledAt, err := ParseDate(fields[7], "20060102150405")
+	if err != nil {
+		return models.SettlementRecord{}, &RowError{Column: names[7], Message: err.Error()}
+	}
+	if fields[1] == "" {
+		return models.SettlementRecord{}, &RowError{Column: names[1], Message: "processor transaction ID is empty"}
+	}
+	return models.SettlementRecord{
+		ID:                fmt.Sprintf("ANP-%s-%04d", batchID, seq),
+		ProcessorName:     a.Processor(),
+		ProcessorTxnID:    fields[1],
+		OrderReference:    fields[2],
+		GrossAmount:       amounts[0],
+		FeeAmount:         amounts[1],
+		NetAmount:         amounts[2],
+		Currency:          strings.ToUpper(fields[3]),
+		SettledAt:         settledAt,
+		SettlementBatchID: batchID,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when every queue slot is taken.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed is returned by Submit after Close.
+	ErrClosed = errors.New("job pool is closed")
+)
+
+// Func is the work for one job. It should return promptly once ctx is done.
+// Func is responsible for recording its own outcome; a panic is recovered and
+// logged so it cannot take down the worker.
+type Func func(ctx context.Context)
+
+type job struct {
+	id  string
+	ctx context.Context
+	fn  Func
+}
+
+// Pool runs queued jobs on a fixed number of background workers. Each job gets
+// its own context, which Cancel cancels whether the job is queued or running.
+type Pool struct {
+	queue chan job
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	cancels map[string]context.CancelFunc // queued and running jobs, keyed by ID
+}
+
+// New starts a pool with the given number of workers and queue capacity.
+func New(workers, queueSize int) *Pool {
+	p := &Pool{
+		queue:   make(chan job, max(queueSize, 0)),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	for range max(workers, 1) {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+// Submit queues fn under id. It never blocks: if the queue is full it returns
+// ErrQueueFull and fn will not run.
+func (p *Pool) Submit(id string, fn Func) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		cancel()
+		return ErrClosed
+	}
+	select {
+	case p.queue <- job{id: id, ctx: ctx, fn: fn}:
+		p.cancels[id] = cancel
+		return nil
+	default:
+		cancel()
+		return ErrQueueFull
+	}
+}
+
+// Cancel cancels the context of the queued or running job with the given ID.
+// It reports false if no such job is pending.
+func (p *Pool) Cancel(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cancel, ok := p.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Close stops accepting jobs and waits for queued and running jobs to finish.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for j := range p.queue {
+		p.run(j)
+	}
+}
+
+func (p *Pool) run(j job) {
+	defer func() {
+		p.mu.Lock()
+		if cancel, ok := p.cancels[j.id]; ok {
+			cancel()
+			delete(p.cancels, j.id)
+		}
+		p.mu.Unlock()
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked: %v\n%s", j.id, r, debug.Stack())
+		}
+	}()
+	j.fn(j.ctx)
+}
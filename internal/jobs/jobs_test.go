@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubmitRunsJob(t *testing.T) {
+	p := New(1, 1)
+	done := make(chan struct{})
+	if err := p.Submit("a", func(context.Context) { close(done) }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+	p.Close()
+	if err := p.Submit("b", func(context.Context) {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestCancelQueuedAndRunningJobs(t *testing.T) {
+	p := New(1, 1)
+	defer p.Close()
+
+	started := make(chan struct{})
+	runningErr := make(chan error, 1)
+	p.Submit("running", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		runningErr <- ctx.Err()
+	})
+	<-started
+
+	queuedErr := make(chan error, 1)
+	if err := p.Submit("queued", func(ctx context.Context) { queuedErr <- ctx.Err() }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if err := p.Submit("overflow", func(context.Context) {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	if !p.Cancel("queued") || !p.Cancel("running") {
+		t.Fatal("expected both jobs to be cancellable")
+	}
+	for name, ch := range map[string]chan error{"running": runningErr, "queued": queuedErr} {
+		select {
+		case err := <-ch:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%s job: expected context.Canceled, got %v", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s job did not observe cancellation", name)
+		}
+	}
+	if p.Cancel("unknown") {
+		t.Error("expected Cancel of unknown job to report false")
+	}
+}
+
+func TestPanicDoesNotKillWorker(t *testing.T) {
+	p := New(1, 2)
+	defer p.Close()
+	p.Submit("panics", func(context.Context) { panic("boom") })
+	done := make(chan struct{})
+	p.Submit("after", func(context.Context) { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker stopped after a panicking job")
+	}
+}
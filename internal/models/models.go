@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
 
 // ReconciliationStatus represents the result of matching a transaction.
 type ReconciliationStatus string
@@ -11,101 +15,479 @@ const (
 	StatusUnsettled            ReconciliationStatus = "unsettled"
 	StatusUnexpectedSettlement ReconciliationStatus = "unexpected_settlement"
 	StatusDuplicate            ReconciliationStatus = "duplicate"
+
+	// Statuses for refund, chargeback and adjustment records.
+	StatusRefunded           ReconciliationStatus = "refunded"            // refund settled as expected
+	StatusChargeback         ReconciliationStatus = "chargeback"          // chargeback debited for a known sale
+	StatusChargebackReversed ReconciliationStatus = "chargeback_reversed" // chargeback credited back
+	StatusAdjustment         ReconciliationStatus = "adjustment"          // processor adjustment with no internal record
+	StatusUnlinked           ReconciliationStatus = "unlinked"            // refund/chargeback/reversal whose original transaction is unknown
+
+	// StatusMatchedFuzzy pairs a settlement and transaction whose references did
+	// not match, by amount, currency, processor and date. It needs human review.
+	StatusMatchedFuzzy ReconciliationStatus = "matched_fuzzy"
+
+	// Statuses for transactions no settlement is expected for, and for the
+	// settlement of a failed transaction, which is always high priority.
+	StatusNotCaptured   ReconciliationStatus = "not_captured"               // authorized, never captured, no settlement
+	StatusFailed        ReconciliationStatus = "failed"                     // failed transaction, no settlement
+	StatusFailedSettled ReconciliationStatus = "failed_transaction_settled" // settlement received for a failed transaction
+)
+
+// ReconciliationStatuses lists every ReconciliationStatus.
+var ReconciliationStatuses = []ReconciliationStatus{
+	StatusMatched, StatusMatchedWithVariance, StatusUnsettled, StatusUnexpectedSettlement, StatusDuplicate,
+	StatusRefunded, StatusChargeback, StatusChargebackReversed, StatusAdjustment, StatusUnlinked,
+	StatusMatchedFuzzy, StatusNotCaptured, StatusFailed, StatusFailedSettled,
+}
+
+// Transaction statuses. Transactions with any other status are expected to settle.
+const (
+	TxnAuthorized = "authorized"
+	TxnCaptured   = "captured"
+	TxnFailed     = "failed"
+)
+
+// RecordType classifies transactions and settlement lines. An empty value means RecordSale.
+type RecordType string
+
+const (
+	RecordSale               RecordType = "sale"
+	RecordRefund             RecordType = "refund"
+	RecordChargeback         RecordType = "chargeback"
+	RecordChargebackReversal RecordType = "chargeback_reversal"
+	RecordAdjustment         RecordType = "adjustment"
 )
 
+// Normalize returns t with the empty value replaced by RecordSale.
+func (t RecordType) Normalize() RecordType {
+	if t == "" {
+		return RecordSale
+	}
+	return t
+}
+
+// Valid reports whether t is empty or one of the known record types.
+func (t RecordType) Valid() bool {
+	switch t.Normalize() {
+	case RecordSale, RecordRefund, RecordChargeback, RecordChargebackReversal, RecordAdjustment:
+		return true
+	}
+	return false
+}
+
+// Direction is -1 for record types that move money back to the customer
+// (refunds, chargebacks), +1 for sales and chargeback reversals, and 0 for
+// adjustments, whose sign is taken as given.
+func (t RecordType) Direction() int {
+	switch t.Normalize() {
+	case RecordRefund, RecordChargeback:
+		return -1
+	case RecordAdjustment:
+		return 0
+	}
+	return 1
+}
+
 // Transaction represents an internal payment authorization/capture record.
 type Transaction struct {
-	ID              string    `json:"id"`
-	OrderID         string    `json:"order_id"`
-	ProcessorName   string    `json:"processor_name"`
-	ProcessorTxnID  string    `json:"processor_txn_id"`
-	Amount          float64   `json:"amount"`
-	Currency        string    `json:"currency"`
-	Country         string    `json:"country"`
-	Status          string    `json:"status"` // authorized, captured, failed
-	AuthorizedAt    time.Time `json:"authorized_at"`
-	CapturedAt      *time.Time `json:"captured_at,omitempty"`
-	CustomerEmail   string    `json:"customer_email"`
-	PaymentMethod   string    `json:"payment_method"`
+	ID                    string        `json:"id"`
+	OrderID               string        `json:"order_id"`
+	ProcessorName         string        `json:"processor_name"`
+	ProcessorTxnID        string        `json:"processor_txn_id"`
+	Amount                money.Amount  `json:"amount"` // authorized amount
+	Currency              string        `json:"currency"`
+	Country               string        `json:"country"`
+	Status                string        `json:"status"` // authorized, captured, failed; see ExpectsSettlement
+	RecordType            RecordType    `json:"record_type,omitempty"`
+	OriginalTransactionID string        `json:"original_transaction_id,omitempty"` // sale a refund, chargeback or reversal reverses
+	AuthorizedAt          time.Time     `json:"authorized_at"`
+	CapturedAt            *time.Time    `json:"captured_at,omitempty"`
+	CapturedAmount        *money.Amount `json:"captured_amount,omitempty"` // total captured, when it differs from the authorized amount
+	Captures              []Capture     `json:"captures,omitempty"`        // individual captures, when there were several
+	CustomerEmail         string        `json:"customer_email"`
+	PaymentMethod         string        `json:"payment_method"`
+}
+
+// Capture is one capture against an authorization.
+type Capture struct {
+	ID         string       `json:"id,omitempty"`
+	Amount     money.Amount `json:"amount"`
+	CapturedAt time.Time    `json:"captured_at"`
+}
+
+// CaptureKnown reports whether t records what was captured, in Captures or
+// CapturedAmount, rather than only the authorized Amount.
+func (t Transaction) CaptureKnown() bool {
+	return len(t.Captures) > 0 || t.CapturedAmount != nil
+}
+
+// Captured returns the amount captured for t, which is what its settlement is
+// expected to cover: the sum of its Captures if it has any, else its
+// CapturedAmount, else the full authorized Amount.
+func (t Transaction) Captured() money.Amount {
+	if len(t.Captures) > 0 {
+		var total money.Amount
+		for _, c := range t.Captures {
+			total = total.Add(c.Amount)
+		}
+		return total
+	}
+	if t.CapturedAmount != nil {
+		return *t.CapturedAmount
+	}
+	return t.Amount
+}
+
+// ExpectsSettlement reports whether a settlement is due for t: it did not fail,
+// and it was captured unless it is still only authorized.
+func (t Transaction) ExpectsSettlement() bool {
+	switch t.Status {
+	case TxnFailed:
+		return false
+	case TxnAuthorized:
+		return t.CapturedAt != nil || len(t.Captures) > 0
+	}
+	return true
 }
 
 // SettlementRecord represents a line item from a processor's settlement file.
 type SettlementRecord struct {
-	ID                string    `json:"id"`
-	ProcessorName     string    `json:"processor_name"`
-	ProcessorTxnID    string    `json:"processor_txn_id"`
-	OrderReference    string    `json:"order_reference"`
-	GrossAmount       float64   `json:"gross_amount"`
-	FeeAmount         float64   `json:"fee_amount"`
-	NetAmount         float64   `json:"net_amount"`
-	Currency          string    `json:"currency"`
-	SettledAt         time.Time `json:"settled_at"`
-	SettlementBatchID string    `json:"settlement_batch_id"`
+	ID                     string       `json:"id"`
+	ProcessorName          string       `json:"processor_name"`
+	ProcessorTxnID         string       `json:"processor_txn_id"`
+	OrderReference         string       `json:"order_reference"`
+	GrossAmount            money.Amount `json:"gross_amount"`
+	FeeAmount              money.Amount `json:"fee_amount"`
+	NetAmount              money.Amount `json:"net_amount"`
+	Currency               string       `json:"currency"`
+	SettledAt              time.Time    `json:"settled_at"`
+	SettlementBatchID      string       `json:"settlement_batch_id"`
+	RecordType             RecordType   `json:"record_type,omitempty"`
+	OriginalProcessorTxnID string       `json:"original_processor_txn_id,omitempty"` // processor ID of the sale a non-sale line refers to
+	ProcessorTxnIDs        []string     `json:"processor_txn_ids,omitempty"`         // transactions an aggregated line covers
 }
 
 // ReconciliationResult holds the outcome for a single matched/unmatched record.
 type ReconciliationResult struct {
-	ID                  string               `json:"id"`
-	TransactionID       string               `json:"transaction_id,omitempty"`
-	SettlementID        string               `json:"settlement_id,omitempty"`
-	ProcessorName       string               `json:"processor_name"`
-	Status              ReconciliationStatus  `json:"status"`
-	ExpectedAmount      float64              `json:"expected_amount"`
-	SettledGrossAmount  float64              `json:"settled_gross_amount"`
-	SettledNetAmount    float64              `json:"settled_net_amount"`
-	FeeAmount           float64              `json:"fee_amount"`
-	VarianceAmount      float64              `json:"variance_amount"`
-	Currency            string               `json:"currency"`
-	Country             string               `json:"country"`
-	AuthorizedAt        *time.Time           `json:"authorized_at,omitempty"`
-	SettledAt           *time.Time           `json:"settled_at,omitempty"`
-	DaysToSettle        *int                 `json:"days_to_settle,omitempty"`
-	Notes               string               `json:"notes,omitempty"`
+	ID                    string               `json:"id"`
+	TransactionID         string               `json:"transaction_id,omitempty"`
+	SettlementID          string               `json:"settlement_id,omitempty"`
+	ProcessorName         string               `json:"processor_name"`
+	Status                ReconciliationStatus `json:"status"`
+	RecordType            RecordType           `json:"record_type"`
+	OriginalTransactionID string               `json:"original_transaction_id,omitempty"` // sale a non-sale record was linked to
+	ExpectedAmount        money.Amount         `json:"expected_amount"`
+	SettledGrossAmount    money.Amount         `json:"settled_gross_amount"`
+	SettledNetAmount      money.Amount         `json:"settled_net_amount"`
+	FeeAmount             money.Amount         `json:"fee_amount"`
+	VarianceAmount        money.Amount         `json:"variance_amount"`
+	Currency              string               `json:"currency"`
+	Country               string               `json:"country"`
+	AuthorizedAt          *time.Time           `json:"authorized_at,omitempty"`
+	SettledAt             *time.Time           `json:"settled_at,omitempty"`
+	DaysToSettle          *int                 `json:"days_to_settle,omitempty"`
+	MatchConfidence       *float64             `json:"match_confidence,omitempty"`   // 0-1, only for matched_fuzzy
+	MatchGroup            string               `json:"match_group,omitempty"`        // ID of the split or aggregated group this result belongs to
+	DuplicateKind         string               `json:"duplicate_kind,omitempty"`     // exact_resend or content_mismatch, only for duplicate
+	DuplicateOf           string               `json:"duplicate_of,omitempty"`       // earlier settlement this line is an exact copy of
+	FXRate                *float64             `json:"fx_rate,omitempty"`            // rate applied to convert the expected amount
+	FXRateDate            *time.Time           `json:"fx_rate_date,omitempty"`       // date of the dated rate applied; unset for a static config rate
+	VarianceBreakdown     *VarianceBreakdown   `json:"variance_breakdown,omitempty"` // only for matched sales with a variance
+	ExpectedFee           *money.Amount        `json:"expected_fee,omitempty"`       // fee per the processor's fee schedule, when one applies
+	FeeOvercharge         *money.Amount        `json:"fee_overcharge,omitempty"`     // fee charged beyond ExpectedFee
+	DaysOutstanding       *int                 `json:"days_outstanding,omitempty"`   // unsettled only: days since authorization, as of the report's as-of date
+	AgingBucket           string               `json:"aging_bucket,omitempty"`       // unsettled only: bucket of DaysOutstanding
+	Notes                 string               `json:"notes,omitempty"`
+}
+
+// VarianceBreakdown splits a matched result's variance into the parts that
+// explain it. The parts add up to the variance amount.
+type VarianceBreakdown struct {
+	// Fee is the part of a shortfall covered by the settlement's fee, as when a
+	// processor reports the amount net of its fee as gross.
+	Fee money.Amount `json:"fee"`
+	// FX is the difference between converting at the applied rate and at the
+	// reference rate, the rate on the other of the authorization and settlement
+	// dates. It is zero for same-currency results.
+	FX money.Amount `json:"fx"`
+	// PartialCapture is the difference between what was expected and what was
+	// captured: captures made after the settlement, which a later settlement
+	// line should cover (negative), and authorized amounts settled although
+	// never captured (positive).
+	PartialCapture money.Amount `json:"partial_capture"`
+	// Residual is what none of the above explains: money actually missing or extra.
+	Residual money.Amount `json:"residual"`
 }
 
+// Duplicate kinds. A duplicate line is an exact resend when another line under
+// its processor key has the same fingerprint (gross amount, currency, settled
+// date and batch ID), and a content mismatch when its content is unique.
+const (
+	DuplicateExactResend     = "exact_resend"
+	DuplicateContentMismatch = "content_mismatch"
+)
+
+// Match group types.
+const (
+	GroupSplit     = "split"     // one transaction settled across several lines
+	GroupAggregate = "aggregate" // one settlement line covering several transactions
+)
+
+// MatchGroup is a set of results matched together: a transaction settled in
+// parts, or a settlement line netting several transactions. Amounts are
+// totals over the group, in the settlement currency.
+type MatchGroup struct {
+	ID                 string               `json:"id"`
+	Type               string               `json:"type"` // split or aggregate
+	Status             ReconciliationStatus `json:"status"`
+	TransactionIDs     []string             `json:"transaction_ids"`
+	SettlementIDs      []string             `json:"settlement_ids"`
+	ExpectedAmount     money.Amount         `json:"expected_amount"`
+	SettledGrossAmount money.Amount         `json:"settled_gross_amount"`
+	VarianceAmount     money.Amount         `json:"variance_amount"`
+	Currency           string               `json:"currency"`
+}
+
+// Reconciliation run lifecycle states.
+const (
+	RunPending   = "pending"
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
 // ReconciliationRun represents a single reconciliation execution.
 type ReconciliationRun struct {
-	ID          string    `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	Status      string    `json:"status"` // pending, running, completed, failed
-	Report      *ReconciliationReport `json:"report,omitempty"`
+	ID         string                `json:"id"`
+	CreatedAt  time.Time             `json:"created_at"`
+	StartedAt  *time.Time            `json:"started_at,omitempty"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+	Status     string                `json:"status"`   // pending, running, completed, failed, cancelled
+	Progress   int                   `json:"progress"` // percent complete, 0-100
+	Error      string                `json:"error,omitempty"`
+	Snapshot   *RunSnapshot          `json:"snapshot,omitempty"`
+	ReportHash string                `json:"report_hash,omitempty"` // see reconciler.ReportHash
+	ReplayOf   string                `json:"replay_of,omitempty"`   // ID of the run this one re-executes
+	Replay     *ReplayComparison     `json:"replay,omitempty"`
+	Report     *ReconciliationReport `json:"report,omitempty"`
+}
+
+// RunSnapshot records exactly what a run was computed from. It is written once
+// when the run starts and never changed afterwards.
+type RunSnapshot struct {
+	Config         ReconciliationConfig `json:"config"`
+	TransactionIDs []string             `json:"transaction_ids"`
+	SettlementIDs  []string             `json:"settlement_ids"`
+	InputHash      string               `json:"input_hash"` // SHA-256 of the input records
+}
+
+// RunInputs are the transactions and settlements a run reconciled, sorted by
+// ID, and the dated FX rates it converted with, sorted by pair and date.
+type RunInputs struct {
+	Transactions []Transaction      `json:"transactions"`
+	Settlements  []SettlementRecord `json:"settlements"`
+	FXRates      []FXRate           `json:"fx_rates,omitempty"`
+}
+
+// ReplayComparison compares a replayed run's report with the original run's.
+type ReplayComparison struct {
+	OriginalRunID      string `json:"original_run_id"`
+	OriginalReportHash string `json:"original_report_hash"`
+	ReportHash         string `json:"report_hash"`
+	Identical          bool   `json:"identical"`
+}
+
+// RunDiff lists what changed in a run's report compared with an earlier run.
+// Summary fields hold differences (run minus against), not totals.
+type RunDiff struct {
+	RunID        string                   `json:"run_id"`
+	AgainstRunID string                   `json:"against_run_id"`
+	Changed      []ResultChange           `json:"changed"`
+	Added        []ReconciliationResult   `json:"added"`
+	Removed      []ReconciliationResult   `json:"removed"`
+	Summary      ReportSummary            `json:"summary_delta"`
+	ByCurrency   map[string]ReportSummary `json:"by_currency_delta"`
+	ByCountry    map[string]ReportSummary `json:"by_country_delta"`
+	ByProcessor  map[string]ReportSummary `json:"by_processor_delta"`
+	ByRecordType map[string]ReportSummary `json:"by_record_type_delta"`
+}
+
+// ResultChange is a transaction or settlement whose status differs between two runs.
+type ResultChange struct {
+	TransactionID string               `json:"transaction_id,omitempty"`
+	SettlementID  string               `json:"settlement_id,omitempty"`
+	FromStatus    ReconciliationStatus `json:"from_status"`
+	ToStatus      ReconciliationStatus `json:"to_status"`
+	From          ReconciliationResult `json:"from"`
+	To            ReconciliationResult `json:"to"`
 }
 
 // ReconciliationReport holds summary and detailed results.
 type ReconciliationReport struct {
 	RunID       string    `json:"run_id"`
 	GeneratedAt time.Time `json:"generated_at"`
+	AsOf        time.Time `json:"as_of"` // date unsettled transactions are aged to
 
 	// Summary
 	Summary ReportSummary `json:"summary"`
 
 	// Breakdowns
-	ByCurrency  map[string]ReportSummary `json:"by_currency"`
-	ByCountry   map[string]ReportSummary `json:"by_country"`
-	ByProcessor map[string]ReportSummary `json:"by_processor"`
+	ByCurrency   map[string]ReportSummary `json:"by_currency"`
+	ByCountry    map[string]ReportSummary `json:"by_country"`
+	ByProcessor  map[string]ReportSummary `json:"by_processor"`
+	ByRecordType map[string]ReportSummary `json:"by_record_type"`
 
 	// Detailed results
 	Results []ReconciliationResult `json:"results"`
 
+	// Split and aggregated settlements matched as groups; members are in Results.
+	MatchGroups []MatchGroup `json:"match_groups"`
+
+	// Re-delivered batches and overpayments caused by duplicate settlement lines.
+	DuplicateAnalysis DuplicateAnalysis `json:"duplicate_analysis"`
+
+	// Fees charged beyond the fee schedules, per processor and currency.
+	FeeOvercharges []ProcessorFeeOvercharge `json:"fee_overcharges"`
+
+	// Problems found in the input records. They do not affect matching.
+	DataQuality DataQuality `json:"data_quality"`
+
 	// High-priority discrepancies
 	HighPriority []ReconciliationResult `json:"high_priority_discrepancies"`
 }
 
+// DuplicateAnalysis describes what duplicate settlement lines cost.
+type DuplicateAnalysis struct {
+	RedeliveredBatches  []RedeliveredBatch     `json:"redelivered_batches"`
+	OverpaidByProcessor []ProcessorOverpayment `json:"overpaid_by_processor"`
+}
+
+// RedeliveredBatch is a settlement batch some of whose lines arrived more than once.
+type RedeliveredBatch struct {
+	ProcessorName     string       `json:"processor_name"`
+	BatchID           string       `json:"settlement_batch_id"`
+	ResentSettlements int          `json:"resent_settlements"` // lines that are exact copies of an earlier line
+	ResentAmount      money.Amount `json:"resent_amount"`      // gross amount of those lines
+	Currency          string       `json:"currency"`
+	Complete          bool         `json:"complete"` // every line of the batch arrived more than once
+}
+
+// ProcessorOverpayment is the amount a processor paid out beyond what was due
+// for transactions with duplicate settlement lines.
+type ProcessorOverpayment struct {
+	ProcessorName        string       `json:"processor_name"`
+	Currency             string       `json:"currency"`
+	Amount               money.Amount `json:"amount"`
+	DuplicateSettlements int          `json:"duplicate_settlements"`
+}
+
+// DataQuality lists the data-quality findings of a run, with a count per kind.
+type DataQuality struct {
+	Findings []DataQualityFinding `json:"findings"`
+	ByKind   map[string]int       `json:"by_kind"`
+}
+
+// Data-quality finding kinds.
+const (
+	FindingArithmeticMismatch = "arithmetic_mismatch"             // gross - fee != net
+	FindingInvalidCurrency    = "invalid_currency"                // not an active ISO 4217 code
+	FindingSettledBeforeAuth  = "settlement_before_authorization" // a matched line settled before its transaction was authorized
+	FindingNegativeAmount     = "negative_amount"                 // negative sale amount or fee
+	FindingMissingReference   = "missing_reference"               // nothing to match the record by
+	FindingCaptureExceedsAuth = "capture_exceeds_authorization"   // more captured than authorized
+)
+
+// DataQualityFinding is a problem with one input record, or with a matched
+// transaction and settlement pair.
+type DataQualityFinding struct {
+	Kind          string `json:"kind"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	SettlementID  string `json:"settlement_id,omitempty"`
+	Field         string `json:"field,omitempty"`
+	Message       string `json:"message"`
+}
+
+// Aging buckets of unsettled transactions, by days outstanding.
+const (
+	Aging0To3   = "0-3"
+	Aging4To7   = "4-7"
+	Aging8To14  = "8-14"
+	Aging15To30 = "15-30"
+	AgingOver30 = "30+"
+)
+
+// AgingBuckets counts unsettled transactions per aging bucket.
+type AgingBuckets struct {
+	Days0To3   int `json:"0_3"`
+	Days4To7   int `json:"4_7"`
+	Days8To14  int `json:"8_14"`
+	Days15To30 int `json:"15_30"`
+	Over30     int `json:"over_30"`
+}
+
+// ProcessorFeeOvercharge totals the settlements on which a processor charged
+// more than its fee schedule allows.
+type ProcessorFeeOvercharge struct {
+	ProcessorName string       `json:"processor_name"`
+	Currency      string       `json:"currency"`
+	Settlements   int          `json:"settlements"`
+	ChargedFees   money.Amount `json:"charged_fees"`
+	ExpectedFees  money.Amount `json:"expected_fees"`
+	Overcharged   money.Amount `json:"overcharged"`
+}
+
 // ReportSummary holds aggregate reconciliation statistics.
 type ReportSummary struct {
-	TotalTransactions      int     `json:"total_transactions"`
-	TotalSettlements       int     `json:"total_settlements"`
-	Matched                int     `json:"matched"`
-	MatchedWithVariance    int     `json:"matched_with_variance"`
-	Unsettled              int     `json:"unsettled"`
-	UnexpectedSettlements  int     `json:"unexpected_settlements"`
-	Duplicates             int     `json:"duplicates"`
-	TotalExpectedAmount    float64 `json:"total_expected_amount"`
-	TotalSettledGross      float64 `json:"total_settled_gross"`
-	TotalSettledNet        float64 `json:"total_settled_net"`
-	TotalVarianceAmount    float64 `json:"total_variance_amount"`
-	TotalFees              float64 `json:"total_fees"`
-	ReconciliationRate     float64 `json:"reconciliation_rate_pct"`
+	TotalTransactions     int          `json:"total_transactions"`
+	TotalSettlements      int          `json:"total_settlements"`
+	Matched               int          `json:"matched"`
+	MatchedWithVariance   int          `json:"matched_with_variance"`
+	Unsettled             int          `json:"unsettled"`
+	UnexpectedSettlements int          `json:"unexpected_settlements"`
+	Duplicates            int          `json:"duplicates"`
+	ExactResends          int          `json:"exact_resends"`      // duplicates that are copies of another line
+	ContentMismatches     int          `json:"content_mismatches"` // duplicates sharing a key with differing content
+	Refunded              int          `json:"refunded"`
+	Chargebacks           int          `json:"chargebacks"`
+	ChargebackReversals   int          `json:"chargeback_reversals"`
+	Adjustments           int          `json:"adjustments"`
+	Unlinked              int          `json:"unlinked"`
+	MatchedFuzzy          int          `json:"matched_fuzzy"`
+	NotCaptured           int          `json:"not_captured"`
+	Failed                int          `json:"failed"`
+	FailedSettled         int          `json:"failed_transaction_settled"`
+	SplitGroups           int          `json:"split_groups"`          // transactions settled across several lines
+	AggregatedGroups      int          `json:"aggregated_groups"`     // settlement lines covering several transactions
+	FeeOvercharges        int          `json:"fee_overcharges"`       // results charged more than the fee schedule allows
+	DataQualityFindings   int          `json:"data_quality_findings"` // top-level summary only
+	UnsettledAging        AgingBuckets `json:"unsettled_aging"`
+	ReconciliationRate    float64      `json:"reconciliation_rate_pct"`
+
+	// Amount totals are kept per currency in NativeTotals, and converted to
+	// ReportingCurrency at the report's as-of date in ReportingTotals.
+	// Currencies with no rate to it are listed in UnconvertedCurrencies and
+	// left out of ReportingTotals.
+	NativeTotals          map[string]AmountTotals `json:"native_totals"`
+	ReportingCurrency     string                  `json:"reporting_currency"`
+	ReportingTotals       AmountTotals            `json:"reporting_totals"`
+	UnconvertedCurrencies []string                `json:"unconverted_currencies,omitempty"`
+}
+
+// AmountTotals are the amount totals of a set of results in one currency.
+type AmountTotals struct {
+	ExpectedAmount money.Amount `json:"expected_amount"`
+	SettledGross   money.Amount `json:"settled_gross"`
+	SettledNet     money.Amount `json:"settled_net"`
+	VarianceAmount money.Amount `json:"variance_amount"`
+	Fees           money.Amount `json:"fees"`
+	FeeOvercharge  money.Amount `json:"fee_overcharge"`
+	// Variance parts of matched results; see VarianceBreakdown.
+	FeeVariance            money.Amount `json:"fee_variance"`
+	FXVariance             money.Amount `json:"fx_variance"`
+	PartialCaptureVariance money.Amount `json:"partial_capture_variance"`
+	ResidualVariance       money.Amount `json:"residual_variance"`
 }
 
 // ReconciliationConfig holds configurable matching parameters.
@@ -117,12 +499,154 @@ type ReconciliationConfig struct {
 	// LateSettlementDays flags settlements that took longer than this many days.
 	LateSettlementDays int `json:"late_settlement_days"`
 
-	// HighPriorityThreshold is the minimum variance amount to flag as high priority.
-	HighPriorityThreshold float64 `json:"high_priority_threshold"`
+	// HighPriorityThreshold is the minimum variance amount, in the reporting
+	// currency, to flag as high priority.
+	HighPriorityThreshold money.Amount `json:"high_priority_threshold"`
+
+	// AsOf is the date unsettled transactions are aged to. When unset, the
+	// latest settlement date among the run's settlements is used.
+	AsOf *time.Time `json:"as_of,omitempty"`
+
+	// UnsettledPriorityDays flags unsettled transactions outstanding longer
+	// than this many days as high priority. Zero disables it.
+	UnsettledPriorityDays int `json:"unsettled_priority_days"`
 
 	// FX rates for multi-currency reconciliation (from -> to -> rate).
 	// E.g., "BRL" -> "USD" -> 0.20
+	// These static rates are used only for pairs with no dated rate in the FX rate store.
 	FXRates map[string]map[string]float64 `json:"fx_rates,omitempty"`
+
+	// ReportingCurrency is the currency report totals are converted to, next
+	// to the native per-currency totals. Defaults to USD.
+	ReportingCurrency string `json:"reporting_currency,omitempty"`
+
+	// FXDatePolicy selects the date dated FX rates are looked up at:
+	// settlement_date (the default) or authorization_date.
+	FXDatePolicy string `json:"fx_date_policy,omitempty"`
+
+	// CSVMappings describes the CSV settlement file layout per processor name.
+	// Processors without an entry use DefaultCSVMapping.
+	CSVMappings map[string]CSVMapping `json:"csv_mappings,omitempty"`
+
+	// FuzzyMatch controls pairing of leftover settlements and transactions whose references differ.
+	FuzzyMatch FuzzyMatchConfig `json:"fuzzy_match"`
+
+	// ReferenceRules normalize processor_txn_id and order_reference per processor name before
+	// matching. Rules run in order and apply to both transactions and settlement records.
+	ReferenceRules map[string][]ReferenceRule `json:"reference_rules,omitempty"`
+
+	// FeeSchedules are the contracted fees per processor name. Matched sales
+	// whose fee exceeds the schedule are flagged as fee overcharges.
+	FeeSchedules map[string][]FeeSchedule `json:"fee_schedules,omitempty"`
+}
+
+// FeeSchedule is a processor's fee for sales with the given payment method and
+// country; an empty field matches any value. The most specific schedule that
+// matches a sale applies, the earlier one on a tie.
+type FeeSchedule struct {
+	PaymentMethod string    `json:"payment_method,omitempty"`
+	Country       string    `json:"country,omitempty"`
+	Tiers         []FeeTier `json:"tiers"`
+}
+
+// FeeTier is a fee that applies once the processor's sale volume in the run,
+// in the settlement currency, reaches MinVolume. The fee is Percentage of the
+// settled gross amount plus Fixed, kept within Min and Max (zero: no bound).
+type FeeTier struct {
+	MinVolume  money.Amount `json:"min_volume"`
+	Percentage float64      `json:"percentage"` // e.g. 0.029 for 2.9%
+	Fixed      money.Amount `json:"fixed"`
+	Min        money.Amount `json:"min"`
+	Max        money.Amount `json:"max"`
+}
+
+// FX date policies.
+const (
+	FXDateSettlement    = "settlement_date"
+	FXDateAuthorization = "authorization_date"
+)
+
+// FXRate converts one unit of From into To. It applies from Date (a UTC day)
+// until the next dated rate for the pair.
+type FXRate struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Date time.Time `json:"date"`
+	Rate float64   `json:"rate"`
+}
+
+// Reference rule types.
+const (
+	RuleRegexExtract = "regex_extract" // keep the first capture group (or whole match) of Pattern
+	RuleStripPrefix  = "strip_prefix"  // remove Prefix if present
+	RuleCaseFold     = "case_fold"     // lower-case
+	RuleZeroPad      = "zero_pad"      // left-pad the trailing digits with zeros to Width
+	RuleTrim         = "trim"          // trim Chars (whitespace if empty) from both ends
+)
+
+// Reference fields a rule can be restricted to.
+const (
+	RefFieldProcessorTxnID = "processor_txn_id"
+	RefFieldOrderReference = "order_reference"
+)
+
+// ReferenceRule is one normalization step for processor references.
+type ReferenceRule struct {
+	Type    string `json:"type"`
+	Field   string `json:"field,omitempty"` // processor_txn_id or order_reference; empty means both
+	Pattern string `json:"pattern,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Width   int    `json:"width,omitempty"`
+	Chars   string `json:"chars,omitempty"`
+}
+
+// FuzzyMatchConfig configures the fuzzy matching phase. A leftover settlement
+// and transaction are candidates when they share a processor, the amounts agree
+// within VarianceTolerancePct after FX, and the settlement falls within
+// DateWindowDays of the authorization.
+type FuzzyMatchConfig struct {
+	Enabled        bool    `json:"enabled"`
+	DateWindowDays int     `json:"date_window_days"`
+	MinConfidence  float64 `json:"min_confidence"` // candidates scoring lower (0-1) are not paired
+}
+
+// CSVMapping describes how to read a processor's CSV settlement file.
+type CSVMapping struct {
+	// Columns maps SettlementRecord JSON field names (e.g. "gross_amount") to CSV header names.
+	Columns map[string]string `json:"columns"`
+
+	// Delimiter is the field separator. Defaults to ",".
+	Delimiter string `json:"delimiter,omitempty"`
+
+	// DecimalSeparator and ThousandsSeparator control number parsing.
+	// E.g. "," and "." for BRL files formatted as 1.234,56. Defaults to "." and none.
+	DecimalSeparator   string `json:"decimal_separator,omitempty"`
+	ThousandsSeparator string `json:"thousands_separator,omitempty"`
+
+	// DateLayout is a Go time layout for settled_at. Defaults to RFC 3339,
+	// falling back to "2006-01-02 15:04:05" and "2006-01-02".
+	DateLayout string `json:"date_layout,omitempty"`
+}
+
+// DefaultCSVMapping returns a mapping whose CSV headers equal the JSON field names.
+func DefaultCSVMapping() CSVMapping {
+	return CSVMapping{
+		Columns: map[string]string{
+			"id":                        "id",
+			"processor_name":            "processor_name",
+			"processor_txn_id":          "processor_txn_id",
+			"order_reference":           "order_reference",
+			"gross_amount":              "gross_amount",
+			"fee_amount":                "fee_amount",
+			"net_amount":                "net_amount",
+			"currency":                  "currency",
+			"settled_at":                "settled_at",
+			"settlement_batch_id":       "settlement_batch_id",
+			"record_type":               "record_type",
+			"original_processor_txn_id": "original_processor_txn_id",
+			"processor_txn_ids":         "processor_txn_ids",
+		},
+	}
 }
 
 // DefaultConfig returns sensible defaults for reconciliation.
@@ -130,12 +654,20 @@ func DefaultConfig() ReconciliationConfig {
 	return ReconciliationConfig{
 		VarianceTolerancePct:  0.0,
 		LateSettlementDays:    7,
-		HighPriorityThreshold: 1000.0,
+		HighPriorityThreshold: money.MustParse("1000"),
+		UnsettledPriorityDays: 14,
 		FXRates: map[string]map[string]float64{
 			"MXN": {"USD": 0.058},
 			"COP": {"USD": 0.00024},
 			"BRL": {"USD": 0.20},
 			"USD": {"USD": 1.0},
 		},
+		FXDatePolicy:      FXDateSettlement,
+		ReportingCurrency: "USD",
+		FuzzyMatch: FuzzyMatchConfig{
+			Enabled:        true,
+			DateWindowDays: 3,
+			MinConfidence:  0.5,
+		},
 	}
 }
@@ -0,0 +1,271 @@
+// Package money represents monetary amounts as exact fixed-point decimals.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of fractional digits an Amount carries. It is the largest
+// ISO 4217 minor-unit exponent, so the minor unit of every currency is exact.
+const Scale = 4
+
+const unitsPerWhole = 10000 // 10^Scale
+
+// Amount is a monetary value stored as an integer number of ten-thousandths.
+// The zero value is zero. Amounts carry no currency; callers pair them with
+// a currency code and use Round to apply that currency's precision.
+type Amount struct {
+	v int64
+}
+
+// FromFloat converts f to the nearest Amount. Use it only at boundaries where the
+// value already is a float (FX rates, generated test data); parse decimals with Parse.
+func FromFloat(f float64) Amount {
+	return Amount{v: int64(math.Round(f * unitsPerWhole))}
+}
+
+// FromMinor converts an integer count of the currency's minor units (e.g. cents) to an Amount.
+func FromMinor(minor int64, currency string) Amount {
+	return Amount{v: minor * pow10(Scale-Exponent(currency))}
+}
+
+// Parse reads a decimal string such as "1234.56", "-0.5" or "1e3". Digits beyond
+// Scale are rounded half away from zero.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Amount{}, errors.New("empty amount")
+	}
+	// big.Rat also accepts fractions and base prefixes; only allow plain decimals.
+	if strings.Trim(s, "0123456789+-.eE") != "" {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	// Bound the exponent so inputs like "1e999999999" cannot force huge allocations.
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(s[i+1:]); err != nil || exp < -32 || exp > 32 {
+			return Amount{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, big.NewRat(unitsPerWhole, 1))
+	// Round half away from zero: trunc((2n + sign*d) / 2d).
+	num, den := r.Num(), r.Denom()
+	twice := new(big.Int).Mul(num, big.NewInt(2))
+	if num.Sign() >= 0 {
+		twice.Add(twice, den)
+	} else {
+		twice.Sub(twice, den)
+	}
+	q := twice.Quo(twice, new(big.Int).Mul(den, big.NewInt(2)))
+	if !q.IsInt64() {
+		return Amount{}, fmt.Errorf("amount %q out of range", s)
+	}
+	return Amount{v: q.Int64()}, nil
+}
+
+// MustParse is like Parse but panics on error. It is intended for constants and tests.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Add(b Amount) Amount { return Amount{v: a.v + b.v} }
+func (a Amount) Sub(b Amount) Amount { return Amount{v: a.v - b.v} }
+func (a Amount) Neg() Amount         { return Amount{v: -a.v} }
+func (a Amount) IsZero() bool        { return a.v == 0 }
+
+// Abs returns the absolute value of a.
+func (a Amount) Abs() Amount {
+	if a.v < 0 {
+		return Amount{v: -a.v}
+	}
+	return a
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of a.
+func (a Amount) Sign() int {
+	switch {
+	case a.v < 0:
+		return -1
+	case a.v > 0:
+		return 1
+	}
+	return 0
+}
+
+// Cmp returns -1, 0 or +1 as a is less than, equal to or greater than b.
+func (a Amount) Cmp(b Amount) int {
+	return a.Sub(b).Sign()
+}
+
+// MulRate multiplies a by a rate or percentage (e.g. an FX rate or 0.02 for 2%),
+// rounding to the nearest ten-thousandth.
+func (a Amount) MulRate(rate float64) Amount {
+	return Amount{v: int64(math.Round(float64(a.v) * rate))}
+}
+
+// Round rounds a half away from zero to the minor unit of currency.
+func (a Amount) Round(currency string) Amount {
+	step := pow10(Scale - Exponent(currency))
+	if step == 1 {
+		return a
+	}
+	q, r := a.v/step, a.v%step
+	if 2*abs64(r) >= step {
+		if a.v < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Amount{v: q * step}
+}
+
+// Units returns a as the integer count of ten-thousandths it holds, for
+// storage that orders and compares amounts as integers.
+func (a Amount) Units() int64 { return a.v }
+
+// Minor returns a in minor units of currency (e.g. cents), rounded half away from zero.
+func (a Amount) Minor(currency string) int64 {
+	return a.Round(currency).v / pow10(Scale-Exponent(currency))
+}
+
+// Float64 returns a as a float, for ratios and display only.
+func (a Amount) Float64() float64 {
+	return float64(a.v) / unitsPerWhole
+}
+
+// String formats a as a plain decimal with at least two fractional digits,
+// e.g. "1234.50", "-0.0583", "150000.00".
+func (a Amount) String() string {
+	neg := a.v < 0
+	u := uint64(abs64(a.v))
+	whole, frac := u/unitsPerWhole, u%unitsPerWhole
+	fracStr := fmt.Sprintf("%04d", frac)
+	fracStr = strings.TrimRight(fracStr, "0")
+	for len(fracStr) < 2 {
+		fracStr += "0"
+	}
+	s := strconv.FormatUint(whole, 10) + "." + fracStr
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// StringIn formats a rounded to the minor unit of currency, with exactly as
+// many fractional digits as the currency has, e.g. "1234.50" in USD, "1235"
+// in JPY and "1234.568" in KWD.
+func (a Amount) StringIn(currency string) string {
+	e := Exponent(currency)
+	v := a.Round(currency).v
+	neg := v < 0
+	u := uint64(abs64(v))
+	s := strconv.FormatUint(u/unitsPerWhole, 10)
+	if e > 0 {
+		s += "." + fmt.Sprintf("%04d", u%unitsPerWhole)[:e]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON encodes a as a JSON number with exact decimal digits.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding a decimal, so payloads
+// written with float amounts keep parsing.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// exponents lists ISO 4217 currencies whose minor unit is not 1/100.
+var exponents = map[string]int{
+	// No minor unit.
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	// Thousandths.
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	// Ten-thousandths.
+	"CLF": 4, "UYW": 4,
+}
+
+// Exponent returns the ISO 4217 minor-unit exponent of currency (2 for MXN, COP,
+// BRL and USD). Unknown currencies default to 2.
+func Exponent(currency string) int {
+	if e, ok := exponents[strings.ToUpper(currency)]; ok {
+		return e
+	}
+	return 2
+}
+
+// currencies lists the active ISO 4217 codes of currencies in circulation and
+// their fund codes. Precious metals, SDRs and the testing codes are left out.
+var currencies = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "AOA": true, "ARS": true, "AUD": true, "AWG": true, "AZN": true, "BAM": true, "BBD": true, "BDT": true,
+	"BGN": true, "BHD": true, "BIF": true, "BMD": true, "BND": true, "BOB": true, "BOV": true, "BRL": true, "BSD": true, "BTN": true, "BWP": true, "BYN": true,
+	"BZD": true, "CAD": true, "CDF": true, "CHE": true, "CHF": true, "CHW": true, "CLF": true, "CLP": true, "CNY": true, "COP": true, "COU": true, "CRC": true,
+	"CUP": true, "CVE": true, "CZK": true, "DJF": true, "DKK": true, "DOP": true, "DZD": true, "EGP": true, "ERN": true, "ETB": true, "EUR": true, "FJD": true,
+	"FKP": true, "GBP": true, "GEL": true, "GHS": true, "GIP": true, "GMD": true, "GNF": true, "GTQ": true, "GYD": true, "HKD": true, "HNL": true, "HTG": true,
+	"HUF": true, "IDR": true, "ILS": true, "INR": true, "IQD": true, "IRR": true, "ISK": true, "JMD": true, "JOD": true, "JPY": true, "KES": true, "KGS": true,
+	"KHR": true, "KMF": true, "KPW": true, "KRW": true, "KWD": true, "KYD": true, "KZT": true, "LAK": true, "LBP": true, "LKR": true, "LRD": true, "LSL": true,
+	"LYD": true, "MAD": true, "MDL": true, "MGA": true, "MKD": true, "MMK": true, "MNT": true, "MOP": true, "MRU": true, "MUR": true, "MVR": true, "MWK": true,
+	"MXN": true, "MXV": true, "MYR": true, "MZN": true, "NAD": true, "NGN": true, "NIO": true, "NOK": true, "NPR": true, "NZD": true, "OMR": true, "PAB": true,
+	"PEN": true, "PGK": true, "PHP": true, "PKR": true, "PLN": true, "PYG": true, "QAR": true, "RON": true, "RSD": true, "RUB": true, "RWF": true, "SAR": true,
+	"SBD": true, "SCR": true, "SDG": true, "SEK": true, "SGD": true, "SHP": true, "SLE": true, "SOS": true, "SRD": true, "SSP": true, "STN": true, "SVC": true,
+	"SYP": true, "SZL": true, "THB": true, "TJS": true, "TMT": true, "TND": true, "TOP": true, "TRY": true, "TTD": true, "TWD": true, "TZS": true, "UAH": true,
+	"UGX": true, "USD": true, "USN": true, "UYI": true, "UYU": true, "UYW": true, "UZS": true, "VED": true, "VES": true, "VND": true, "VUV": true, "WST": true,
+	"XAF": true, "XCD": true, "XCG": true, "XOF": true, "XPF": true, "YER": true, "ZAR": true, "ZMW": true, "ZWG": true,
+}
+
+// ValidCurrency reports whether code is an active ISO 4217 currency code. Codes
+// must be upper case.
+func ValidCurrency(code string) bool {
+	return currencies[code]
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
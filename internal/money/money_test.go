@@ -0,0 +1,136 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"143.97", "143.97", false},
+		{"-15", "-15.00", false},
+		{"0.058", "0.058", false},
+		{"1e3", "1000.00", false},
+		{"155556.81000000003", "155556.81", false},
+		{"1.00005", "1.0001", false},
+		{"-1.00005", "-1.0001", false},
+		{"1/2", "", true},
+		{"0x10", "", true},
+		{"1e99999", "", true},
+		{"", "", true},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("Parse(%q): err = %v, wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if err == nil && got.String() != c.want {
+			t.Errorf("Parse(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRoundUsesCurrencyExponent(t *testing.T) {
+	a := MustParse("1234.5678")
+	cases := map[string]string{
+		"USD": "1234.57",
+		"COP": "1234.57",
+		"JPY": "1235.00",
+		"KWD": "1234.568",
+		"CLF": "1234.5678",
+	}
+	for cur, want := range cases {
+		if got := a.Round(cur).String(); got != want {
+			t.Errorf("Round(%s) = %s, want %s", cur, got, want)
+		}
+	}
+	if got := MustParse("-0.005").Round("USD").String(); got != "-0.01" {
+		t.Errorf("negative half should round away from zero, got %s", got)
+	}
+	if got := MustParse("12.34").Minor("USD"); got != 1234 {
+		t.Errorf("Minor = %d, want 1234", got)
+	}
+	if got := FromMinor(1234, "JPY").String(); got != "1234.00" {
+		t.Errorf("FromMinor JPY = %s, want 1234.00", got)
+	}
+}
+
+func TestStringIn(t *testing.T) {
+	cases := []struct{ amount, currency, want string }{
+		{"1234.5", "USD", "1234.50"},
+		{"-1234.5678", "USD", "-1234.57"},
+		{"4999.5", "JPY", "5000"},
+		{"12.3456", "KWD", "12.346"},
+		{"0.0001", "CLF", "0.0001"},
+		{"-0.004", "USD", "0.00"},
+		{"7", "", "7.00"},
+	}
+	for _, c := range cases {
+		if got := MustParse(c.amount).StringIn(c.currency); got != c.want {
+			t.Errorf("StringIn(%s, %q) = %s, want %s", c.amount, c.currency, got, c.want)
+		}
+	}
+}
+
+// Summing many COP amounts must not drift the way float64 totals do.
+func TestSumIsExact(t *testing.T) {
+	var total Amount
+	for i := 0; i < 50000; i++ {
+		total = total.Add(MustParse("1234.56"))
+	}
+	if total.String() != "61728000.00" {
+		t.Errorf("total = %s, want 61728000.00", total)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	var v struct {
+		A Amount `json:"a"`
+		B Amount `json:"b"`
+		C Amount `json:"c"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 143.97, "b": "0.10", "c": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != MustParse("143.97") || v.B != MustParse("0.1") || !v.C.IsZero() {
+		t.Errorf("unexpected values: %s %s %s", v.A, v.B, v.C)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"a":143.97,"b":0.10,"c":0.00}` {
+		t.Errorf("unexpected JSON: %s", out)
+	}
+	if err := json.Unmarshal([]byte(`{"a": "abc"}`), &v); err == nil {
+		t.Error("expected error for non-numeric string")
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	got := MustParse("1000").MulRate(0.058).Round("USD")
+	if got != MustParse("58") {
+		t.Errorf("1000 * 0.058 = %s, want 58.00", got)
+	}
+	if got := MustParse("100").MulRate(0.02); got != MustParse("2") {
+		t.Errorf("2%% of 100 = %s, want 2.00", got)
+	}
+}
+
+func TestValidCurrency(t *testing.T) {
+	for _, code := range []string{"MXN", "COP", "BRL", "USD", "CLF", "XOF"} {
+		if !ValidCurrency(code) {
+			t.Errorf("ValidCurrency(%q) = false, want true", code)
+		}
+	}
+	for _, code := range []string{"", "usd", "XXX", "XAU", "US", "ABC"} {
+		if ValidCurrency(code) {
+			t.Errorf("ValidCurrency(%q) = true, want false", code)
+		}
+	}
+}
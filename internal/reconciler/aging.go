@@ -0,0 +1,69 @@
+package reconciler
+
+import (
+	"math"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// asOfDate is the date unsettled transactions are aged to: the configured
+// one, else the latest settlement date of the run, else the latest
+// authorization. Deriving it from the inputs keeps reports reproducible.
+func asOfDate(configured *time.Time, in models.RunInputs) time.Time {
+	if configured != nil {
+		return configured.UTC()
+	}
+	var latest time.Time
+	for _, s := range in.Settlements {
+		if s.SettledAt.After(latest) {
+			latest = s.SettledAt
+		}
+	}
+	if !latest.IsZero() {
+		return latest.UTC()
+	}
+	for _, t := range in.Transactions {
+		if t.AuthorizedAt.After(latest) {
+			latest = t.AuthorizedAt
+		}
+	}
+	return latest.UTC()
+}
+
+// daysOutstanding is the number of whole days from authorizedAt to the as-of
+// date, and never negative.
+func (r *Reconciler) daysOutstanding(authorizedAt time.Time) int {
+	return max(int(math.Floor(r.asOf.Sub(authorizedAt).Hours()/24)), 0)
+}
+
+// agingBucket returns the aging bucket of days outstanding.
+func agingBucket(days int) string {
+	switch {
+	case days <= 3:
+		return models.Aging0To3
+	case days <= 7:
+		return models.Aging4To7
+	case days <= 14:
+		return models.Aging8To14
+	case days <= 30:
+		return models.Aging15To30
+	}
+	return models.AgingOver30
+}
+
+// addAging counts an aging bucket in b.
+func addAging(b *models.AgingBuckets, bucket string) {
+	switch bucket {
+	case models.Aging0To3:
+		b.Days0To3++
+	case models.Aging4To7:
+		b.Days4To7++
+	case models.Aging8To14:
+		b.Days8To14++
+	case models.Aging15To30:
+		b.Days15To30++
+	case models.AgingOver30:
+		b.Over30++
+	}
+}
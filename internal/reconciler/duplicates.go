@@ -0,0 +1,163 @@
+package reconciler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// fingerprint identifies a settlement line's content: gross amount, currency,
+// settled date and batch ID. Lines sharing a processor key and fingerprint are
+// copies of one another.
+func fingerprint(s models.SettlementRecord) string {
+	return fmt.Sprintf("%s|%s|%s|%s", s.GrossAmount, s.Currency, s.SettledAt.Format("2006-01-02"), s.SettlementBatchID)
+}
+
+// duplicateSet classifies the lines sharing one processor key.
+type duplicateSet struct {
+	counts map[string]int    // lines per fingerprint
+	first  map[string]string // first settlement ID per fingerprint
+}
+
+func newDuplicateSet(setts []models.SettlementRecord) duplicateSet {
+	d := duplicateSet{counts: make(map[string]int, len(setts)), first: make(map[string]string, len(setts))}
+	for _, s := range setts {
+		fp := fingerprint(s)
+		if d.counts[fp]++; d.counts[fp] == 1 {
+			d.first[fp] = s.ID
+		}
+	}
+	return d
+}
+
+// classify returns the duplicate kind of s and, if s is a copy, the earlier line it copies.
+func (d duplicateSet) classify(s models.SettlementRecord) (kind, of string) {
+	fp := fingerprint(s)
+	if d.counts[fp] < 2 {
+		return models.DuplicateContentMismatch, ""
+	}
+	if first := d.first[fp]; first != s.ID {
+		return models.DuplicateExactResend, first
+	}
+	return models.DuplicateExactResend, ""
+}
+
+func duplicateNote(s models.SettlementRecord, occurrences int, kind, of string) string {
+	note := fmt.Sprintf("Duplicate settlement for processor key %s (%d occurrences)", processorKey(s.ProcessorName, s.ProcessorTxnID), occurrences)
+	switch {
+	case of != "":
+		return note + fmt.Sprintf("; exact resend of %s", of)
+	case kind == models.DuplicateContentMismatch:
+		return note + "; content differs from the other lines"
+	}
+	return note
+}
+
+// overpayment returns how much more than was due the lines sharing a processor
+// key paid out, in the first line's currency. What was due is the transaction
+// amount when the transaction is known, and one line's amount otherwise.
+// Refund and chargeback lines are compared by absolute amount. Without an FX
+// rate for every amount the overpayment is unknown, and zero is returned.
+func (r *Reconciler) overpayment(setts []models.SettlementRecord, txn models.Transaction, txnFound bool) money.Amount {
+	currency := setts[0].Currency
+	var paid money.Amount
+	for _, s := range setts {
+		amount, err := r.convertAmount(s.GrossAmount.Abs(), s.Currency, currency, s.SettledAt)
+		if err != nil {
+			return money.Amount{}
+		}
+		paid = paid.Add(amount)
+	}
+	due := setts[0].GrossAmount.Abs()
+	if txnFound {
+		var err error
+		if due, err = r.convertAmount(txn.Captured().Abs(), txn.Currency, currency, r.fxDate(txn, setts[0])); err != nil {
+			return money.Amount{}
+		}
+	}
+	if over := paid.Sub(due); over.Sign() > 0 {
+		return over
+	}
+	return money.Amount{}
+}
+
+// overpayments accumulates overpaid amounts per processor and currency.
+type overpayments map[[2]string]*models.ProcessorOverpayment
+
+func (o overpayments) add(processor, currency string, amount money.Amount, lines int) {
+	key := [2]string{processor, currency}
+	p := o[key]
+	if p == nil {
+		p = &models.ProcessorOverpayment{ProcessorName: processor, Currency: currency}
+		o[key] = p
+	}
+	p.Amount = p.Amount.Add(amount)
+	p.DuplicateSettlements += lines
+}
+
+// duplicateAnalysis lists the batches that were re-delivered, judged by the
+// exact copies among results, and the overpayments per processor.
+func duplicateAnalysis(settlements []models.SettlementRecord, idx *txnIndex, results []models.ReconciliationResult, over overpayments) models.DuplicateAnalysis {
+	analysis := models.DuplicateAnalysis{
+		RedeliveredBatches:  []models.RedeliveredBatch{},
+		OverpaidByProcessor: []models.ProcessorOverpayment{},
+	}
+
+	byID := make(map[string]models.SettlementRecord, len(settlements))
+	copies := make(map[string]int, len(settlements)) // lines per processor key and fingerprint
+	for _, s := range settlements {
+		byID[s.ID] = s
+		if s.ProcessorTxnID != "" {
+			copies[idx.settlementKey(s)+"|"+fingerprint(s)]++
+		}
+	}
+
+	batches := make(map[[2]string]*models.RedeliveredBatch)
+	for _, res := range results {
+		if res.DuplicateOf == "" {
+			continue
+		}
+		s := byID[res.SettlementID]
+		if s.SettlementBatchID == "" {
+			continue
+		}
+		key := [2]string{s.ProcessorName, s.SettlementBatchID}
+		b := batches[key]
+		if b == nil {
+			b = &models.RedeliveredBatch{ProcessorName: s.ProcessorName, BatchID: s.SettlementBatchID, Currency: s.Currency, Complete: true}
+			batches[key] = b
+		}
+		b.ResentSettlements++
+		b.ResentAmount = b.ResentAmount.Add(s.GrossAmount)
+	}
+	for _, s := range settlements {
+		b := batches[[2]string{s.ProcessorName, s.SettlementBatchID}]
+		if b != nil && (s.ProcessorTxnID == "" || copies[idx.settlementKey(s)+"|"+fingerprint(s)] < 2) {
+			b.Complete = false
+		}
+	}
+
+	for _, b := range batches {
+		analysis.RedeliveredBatches = append(analysis.RedeliveredBatches, *b)
+	}
+	sort.Slice(analysis.RedeliveredBatches, func(i, j int) bool {
+		a, b := analysis.RedeliveredBatches[i], analysis.RedeliveredBatches[j]
+		if a.ProcessorName != b.ProcessorName {
+			return a.ProcessorName < b.ProcessorName
+		}
+		return a.BatchID < b.BatchID
+	})
+	for _, p := range over {
+		analysis.OverpaidByProcessor = append(analysis.OverpaidByProcessor, *p)
+	}
+	sort.Slice(analysis.OverpaidByProcessor, func(i, j int) bool {
+		a, b := analysis.OverpaidByProcessor[i], analysis.OverpaidByProcessor[j]
+		if a.ProcessorName != b.ProcessorName {
+			return a.ProcessorName < b.ProcessorName
+		}
+		return a.Currency < b.Currency
+	})
+	return analysis
+}
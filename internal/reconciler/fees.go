@@ -0,0 +1,160 @@
+package reconciler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// ValidateFeeSchedules checks every processor's fee schedules.
+func ValidateFeeSchedules(schedules map[string][]models.FeeSchedule) error {
+	for _, processor := range slices.Sorted(maps.Keys(schedules)) {
+		seen := make(map[[2]string]bool)
+		for i, fs := range schedules[processor] {
+			key := [2]string{fs.PaymentMethod, fs.Country}
+			if seen[key] {
+				return fmt.Errorf("fee schedules for %s: schedule %d: payment method %q and country %q already have a schedule", processor, i+1, fs.PaymentMethod, fs.Country)
+			}
+			seen[key] = true
+			if err := validateFeeTiers(fs.Tiers); err != nil {
+				return fmt.Errorf("fee schedules for %s: schedule %d: %w", processor, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateFeeTiers(tiers []models.FeeTier) error {
+	if len(tiers) == 0 {
+		return fmt.Errorf("needs at least one tier")
+	}
+	for i, t := range tiers {
+		switch {
+		case t.Percentage < 0 || t.Percentage >= 1:
+			return fmt.Errorf("tier %d: percentage must be at least 0 and below 1", i+1)
+		case t.MinVolume.Sign() < 0 || t.Fixed.Sign() < 0 || t.Min.Sign() < 0 || t.Max.Sign() < 0:
+			return fmt.Errorf("tier %d: amounts must not be negative", i+1)
+		case t.Max.Sign() > 0 && t.Max.Cmp(t.Min) < 0:
+			return fmt.Errorf("tier %d: max is below min", i+1)
+		case i > 0 && t.MinVolume.Cmp(tiers[i-1].MinVolume) <= 0:
+			return fmt.Errorf("tier %d: min_volume must be above the previous tier's", i+1)
+		}
+	}
+	return nil
+}
+
+// saleVolumes totals the gross amount of sale settlement lines per processor
+// and currency. It selects the volume tier of a processor's fee schedule.
+func saleVolumes(settlements []models.SettlementRecord) map[[2]string]money.Amount {
+	volumes := make(map[[2]string]money.Amount)
+	for _, s := range settlements {
+		if s.RecordType.Normalize() != models.RecordSale {
+			continue
+		}
+		key := [2]string{s.ProcessorName, s.Currency}
+		volumes[key] = volumes[key].Add(s.GrossAmount.Abs())
+	}
+	return volumes
+}
+
+// feeSchedule returns the processor's schedule for a sale: the matching one
+// that names the most of payment method and country.
+func (r *Reconciler) feeSchedule(processor string, txn models.Transaction) (models.FeeSchedule, bool) {
+	best, bestScore := models.FeeSchedule{}, -1
+	for _, fs := range r.config.FeeSchedules[processor] {
+		score := 0
+		if fs.PaymentMethod != "" {
+			if !strings.EqualFold(fs.PaymentMethod, txn.PaymentMethod) {
+				continue
+			}
+			score++
+		}
+		if fs.Country != "" {
+			if !strings.EqualFold(fs.Country, txn.Country) {
+				continue
+			}
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = fs, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// expectedFee is the fee the processor's schedule allows on a sale settled for
+// gross in currency. It reports false when no schedule applies.
+func (r *Reconciler) expectedFee(processor, currency string, txn models.Transaction, gross money.Amount) (money.Amount, bool) {
+	fs, ok := r.feeSchedule(processor, txn)
+	if !ok {
+		return money.Amount{}, false
+	}
+	volume := r.volumes[[2]string{processor, currency}]
+	tier := fs.Tiers[0]
+	for _, t := range fs.Tiers[1:] {
+		if volume.Cmp(t.MinVolume) >= 0 {
+			tier = t
+		}
+	}
+	fee := gross.Abs().MulRate(tier.Percentage).Add(tier.Fixed)
+	if tier.Min.Sign() > 0 && fee.Cmp(tier.Min) < 0 {
+		fee = tier.Min
+	}
+	if tier.Max.Sign() > 0 && fee.Cmp(tier.Max) > 0 {
+		fee = tier.Max
+	}
+	return fee.Round(currency), true
+}
+
+// checkFee records on res the fee expected for the sale and, if more was
+// charged, the overcharge.
+func (r *Reconciler) checkFee(res *models.ReconciliationResult, txn models.Transaction, gross money.Amount) {
+	if fee, ok := r.expectedFee(res.ProcessorName, res.Currency, txn, gross); ok {
+		recordFee(res, fee)
+	}
+}
+
+// recordFee records the expected fee on res and flags a fee charged beyond it.
+func recordFee(res *models.ReconciliationResult, expected money.Amount) {
+	res.ExpectedFee = &expected
+	over := res.FeeAmount.Sub(expected).Round(res.Currency)
+	if over.Sign() <= 0 {
+		return
+	}
+	res.FeeOvercharge = &over
+	note := fmt.Sprintf("Fee overcharge: charged %s, schedule allows %s (%s %s over)", res.FeeAmount, expected, over, res.Currency)
+	if res.Notes != "" {
+		note = res.Notes + "; " + note
+	}
+	res.Notes = note
+}
+
+// feeOvercharges totals overcharged results per processor and currency,
+// sorted by processor and currency.
+func feeOvercharges(results []models.ReconciliationResult) []models.ProcessorFeeOvercharge {
+	byKey := make(map[[2]string]*models.ProcessorFeeOvercharge)
+	for _, res := range results {
+		if res.FeeOvercharge == nil {
+			continue
+		}
+		key := [2]string{res.ProcessorName, res.Currency}
+		o := byKey[key]
+		if o == nil {
+			o = &models.ProcessorFeeOvercharge{ProcessorName: res.ProcessorName, Currency: res.Currency}
+			byKey[key] = o
+		}
+		o.Settlements++
+		o.ChargedFees = o.ChargedFees.Add(res.FeeAmount)
+		o.ExpectedFees = o.ExpectedFees.Add(*res.ExpectedFee)
+		o.Overcharged = o.Overcharged.Add(*res.FeeOvercharge)
+	}
+	out := make([]models.ProcessorFeeOvercharge, 0, len(byKey))
+	for _, key := range slices.SortedFunc(maps.Keys(byKey), func(a, b [2]string) int { return slices.Compare(a[:], b[:]) }) {
+		out = append(out, *byKey[key])
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package reconciler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestExpectedFeeBounds(t *testing.T) {
+	r := New(nil, models.ReconciliationConfig{FeeSchedules: map[string][]models.FeeSchedule{"P1": {{
+		Tiers: []models.FeeTier{{Percentage: 0.03, Fixed: money.MustParse("1.00"), Min: money.MustParse("4.00"), Max: money.MustParse("30.00")}},
+	}}}})
+	for _, tc := range []struct{ gross, want string }{
+		{"50.00", "4.00"},    // 2.50 raised to the minimum
+		{"500.00", "16.00"},  // 15.00 + 1.00
+		{"2000.00", "30.00"}, // 61.00 capped
+		{"-500.00", "16.00"}, // sign ignored
+		{"333.33", "11.00"},  // 10.9999 rounded to cents
+	} {
+		got, ok := r.expectedFee("P1", "MXN", models.Transaction{}, money.MustParse(tc.gross))
+		if !ok || got != money.MustParse(tc.want) {
+			t.Errorf("expectedFee(%s) = %s, %v; want %s", tc.gross, got, ok, tc.want)
+		}
+	}
+	if _, ok := r.expectedFee("P2", "MXN", models.Transaction{}, money.MustParse("100")); ok {
+		t.Error("expected no fee for a processor without a schedule")
+	}
+}
+
+func TestValidateFeeSchedulesRejectsInvalid(t *testing.T) {
+	tier := models.FeeTier{Percentage: 0.02}
+	for _, tc := range []struct {
+		name      string
+		schedules []models.FeeSchedule
+		want      string
+	}{
+		{"no tiers", []models.FeeSchedule{{}}, "at least one tier"},
+		{"percentage", []models.FeeSchedule{{Tiers: []models.FeeTier{{Percentage: 1.5}}}}, "percentage"},
+		{"negative", []models.FeeSchedule{{Tiers: []models.FeeTier{{Fixed: money.MustParse("-1")}}}}, "negative"},
+		{"max below min", []models.FeeSchedule{{Tiers: []models.FeeTier{{Min: money.MustParse("5"), Max: money.MustParse("2")}}}}, "max is below min"},
+		{"tier order", []models.FeeSchedule{{Tiers: []models.FeeTier{{MinVolume: money.MustParse("100")}, {MinVolume: money.MustParse("100")}}}}, "min_volume"},
+		{"duplicate", []models.FeeSchedule{{Country: "MX", Tiers: []models.FeeTier{tier}}, {Country: "MX", Tiers: []models.FeeTier{tier}}}, "already have a schedule"},
+	} {
+		err := ValidateFeeSchedules(map[string][]models.FeeSchedule{"P1": tc.schedules})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+}
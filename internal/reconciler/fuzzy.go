@@ -0,0 +1,157 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// Weights of the fuzzy confidence score components; they sum to 1.
+const (
+	fuzzyAmountWeight   = 0.5
+	fuzzyDateWeight     = 0.3
+	fuzzyCurrencyWeight = 0.2
+)
+
+// fuzzyCandidate is a possible pairing of an unexpected settlement with an unsettled sale.
+type fuzzyCandidate struct {
+	result     int // index of the settlement's unexpected_settlement result
+	settlement models.SettlementRecord
+	txn        models.Transaction
+	expected   money.Amount
+	days       int
+	confidence float64
+}
+
+// fuzzyMatch replaces unexpected_settlement results with matched_fuzzy ones
+// where a leftover sale of the same processor that is expected to settle fits
+// by amount, currency and date. Pairs are taken best score first; each settlement and transaction is
+// used at most once. Paired transactions are added to matchedTxnIDs.
+func (r *Reconciler) fuzzyMatch(ctx context.Context, results []models.ReconciliationResult, settlements []models.SettlementRecord, transactions []models.Transaction, matchedTxnIDs map[string]bool) error {
+	if !r.config.FuzzyMatch.Enabled {
+		return nil
+	}
+	openByProcessor := make(map[string][]models.Transaction)
+	for _, t := range transactions {
+		if !matchedTxnIDs[t.ID] && t.RecordType.Normalize() == models.RecordSale && t.ExpectsSettlement() {
+			openByProcessor[t.ProcessorName] = append(openByProcessor[t.ProcessorName], t)
+		}
+	}
+	settlementByID := make(map[string]models.SettlementRecord, len(settlements))
+	for _, s := range settlements {
+		settlementByID[s.ID] = s
+	}
+
+	var candidates []fuzzyCandidate
+	for i, res := range results {
+		if res.Status != models.StatusUnexpectedSettlement {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s := settlementByID[res.SettlementID]
+		for _, txn := range openByProcessor[s.ProcessorName] {
+			if c, ok := r.fuzzyScore(s, txn); ok {
+				c.result = i
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	// Candidates were built in result and transaction-ID order, so a stable sort keeps ties deterministic.
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].confidence > candidates[j].confidence })
+
+	alternatives := make(map[int]int) // candidates per settlement result, for the review note
+	for _, c := range candidates {
+		alternatives[c.result]++
+	}
+	paired := make(map[int]bool)
+	for _, c := range candidates {
+		if paired[c.result] || matchedTxnIDs[c.txn.ID] {
+			continue
+		}
+		paired[c.result] = true
+		matchedTxnIDs[c.txn.ID] = true
+		results[c.result] = fuzzyResult(results[c.result].ID, c, alternatives[c.result])
+		res := &results[c.result]
+		r.recordFX(res, c.txn.Currency, c.settlement.Currency, r.fxDate(c.txn, c.settlement))
+		res.VarianceBreakdown = r.varianceBreakdown([]models.Transaction{c.txn}, c.settlement, res.VarianceAmount)
+		r.checkFee(res, c.txn, c.settlement.GrossAmount)
+	}
+	return nil
+}
+
+// fuzzyScore checks whether txn is a plausible counterpart of s and scores it
+// from 0 to 1: amount closeness (relative to the tolerance), days between
+// authorization and settlement (relative to the window), and same currency.
+func (r *Reconciler) fuzzyScore(s models.SettlementRecord, txn models.Transaction) (fuzzyCandidate, bool) {
+	cfg := r.config.FuzzyMatch
+	days := int(math.Floor(s.SettledAt.Sub(txn.AuthorizedAt).Hours() / 24))
+	if days < 0 || days > cfg.DateWindowDays {
+		return fuzzyCandidate{}, false
+	}
+	expected, err := r.convertAmount(txn.Captured(), txn.Currency, s.Currency, r.fxDate(txn, s))
+	if err != nil {
+		return fuzzyCandidate{}, false
+	}
+	variance := s.GrossAmount.Sub(expected).Abs()
+	tolerance := expected.Abs().MulRate(r.config.VarianceTolerancePct)
+	var amountScore float64
+	switch {
+	case variance.Round(s.Currency).IsZero():
+		amountScore = 1
+	case variance.Cmp(tolerance) <= 0:
+		amountScore = 1 - variance.Float64()/tolerance.Float64()
+	default:
+		return fuzzyCandidate{}, false
+	}
+	dateScore := 1 - float64(days)/float64(cfg.DateWindowDays+1)
+	currencyScore := 0.0
+	if txn.Currency == s.Currency {
+		currencyScore = 1
+	}
+
+	confidence := fuzzyAmountWeight*amountScore + fuzzyDateWeight*dateScore + fuzzyCurrencyWeight*currencyScore
+	confidence = math.Round(confidence*100) / 100
+	if confidence < cfg.MinConfidence {
+		return fuzzyCandidate{}, false
+	}
+	return fuzzyCandidate{settlement: s, txn: txn, expected: expected, days: days, confidence: confidence}, true
+}
+
+func fuzzyResult(id string, c fuzzyCandidate, alternatives int) models.ReconciliationResult {
+	s, txn := c.settlement, c.txn
+	authAt := txn.AuthorizedAt
+	settledAt := s.SettledAt
+	days := c.days
+	confidence := c.confidence
+	notes := fmt.Sprintf("Fuzzy match (confidence %.2f): references differ (settlement %s / %s, transaction %s / %s); amount, processor and date agree",
+		confidence, s.ProcessorTxnID, s.OrderReference, txn.ProcessorTxnID, txn.OrderID)
+	if alternatives > 1 {
+		notes += fmt.Sprintf("; %d candidate transactions, best one taken", alternatives)
+	}
+	return models.ReconciliationResult{
+		ID:                 id,
+		TransactionID:      txn.ID,
+		SettlementID:       s.ID,
+		ProcessorName:      txn.ProcessorName,
+		Status:             models.StatusMatchedFuzzy,
+		RecordType:         models.RecordSale,
+		ExpectedAmount:     c.expected,
+		SettledGrossAmount: s.GrossAmount,
+		SettledNetAmount:   s.NetAmount,
+		FeeAmount:          s.FeeAmount,
+		VarianceAmount:     s.GrossAmount.Sub(c.expected),
+		Currency:           s.Currency,
+		Country:            txn.Country,
+		AuthorizedAt:       &authAt,
+		SettledAt:          &settledAt,
+		DaysToSettle:       &days,
+		MatchConfidence:    &confidence,
+		Notes:              notes,
+	}
+}
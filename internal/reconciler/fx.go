@@ -0,0 +1,137 @@
+package reconciler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// fxTable holds dated FX rates per currency pair, sorted by date.
+type fxTable map[[2]string][]models.FXRate
+
+func newFXTable(rates []models.FXRate) fxTable {
+	t := make(fxTable)
+	for _, r := range rates {
+		pair := [2]string{r.From, r.To}
+		t[pair] = append(t[pair], r)
+	}
+	for _, rs := range t {
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].Date.Before(rs[j].Date) })
+	}
+	return t
+}
+
+// at returns the rate for a pair on day, or failing that the nearest earlier one.
+func (t fxTable) at(from, to string, day time.Time) (models.FXRate, bool) {
+	rs := t[[2]string{from, to}]
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].Date.After(day) })
+	if i == 0 {
+		return models.FXRate{}, false
+	}
+	return rs[i-1], true
+}
+
+// fxQuote is a rate applied to a conversion. date is the date of the dated
+// rate used, and zero when a static config rate was used.
+type fxQuote struct {
+	rate float64
+	date time.Time
+}
+
+// fxDate is the date a transaction's amount is converted at for settlement s,
+// according to the configured FX date policy.
+func (r *Reconciler) fxDate(txn models.Transaction, s models.SettlementRecord) time.Time {
+	if r.config.FXDatePolicy == models.FXDateAuthorization {
+		return txn.AuthorizedAt
+	}
+	return s.SettledAt
+}
+
+// convertAmount applies FX conversion at the given date if the currencies
+// differ, rounding the result to the target currency's minor unit. It fails
+// when there is no rate for the pair.
+func (r *Reconciler) convertAmount(amount money.Amount, from, to string, at time.Time) (money.Amount, error) {
+	if from == to {
+		return amount, nil
+	}
+	q, ok := r.fxRate(from, to, at)
+	if !ok {
+		return money.Amount{}, fmt.Errorf("no FX rate from %s to %s for %s", from, to, at.UTC().Format(time.DateOnly))
+	}
+	return amount.MulRate(q.rate).Round(to), nil
+}
+
+// fxRate returns the rate from one currency to another at the given date.
+// Dated rates come first: the pair's rate on that day or the nearest earlier
+// one, directly, inverted, or via USD. Without one, the static config rates
+// are used the same way.
+func (r *Reconciler) fxRate(from, to string, at time.Time) (fxQuote, bool) {
+	if from == to {
+		return fxQuote{rate: 1}, true
+	}
+	day := at.UTC().Truncate(24 * time.Hour)
+	dated := func(from, to string) (fxQuote, bool) {
+		if rate, ok := r.rates.at(from, to, day); ok {
+			return fxQuote{rate: rate.Rate, date: rate.Date}, true
+		}
+		if rate, ok := r.rates.at(to, from, day); ok && rate.Rate != 0 {
+			return fxQuote{rate: 1 / rate.Rate, date: rate.Date}, true
+		}
+		return fxQuote{}, false
+	}
+	static := func(from, to string) (fxQuote, bool) {
+		if rate, ok := r.config.FXRates[from][to]; ok {
+			return fxQuote{rate: rate}, true
+		}
+		if rate, ok := r.config.FXRates[to][from]; ok && rate != 0 {
+			return fxQuote{rate: 1 / rate}, true
+		}
+		return fxQuote{}, false
+	}
+	for _, lookup := range []func(from, to string) (fxQuote, bool){dated, static} {
+		if q, ok := lookup(from, to); ok {
+			return q, true
+		}
+		fromUSD, okFrom := viaUSD(lookup, from)
+		toUSD, okTo := viaUSD(lookup, to)
+		if okFrom && okTo && toUSD.rate != 0 {
+			return fxQuote{rate: fromUSD.rate / toUSD.rate, date: earlier(fromUSD.date, toUSD.date)}, true
+		}
+	}
+	return fxQuote{}, false
+}
+
+// viaUSD returns the rate from a currency to USD, which is 1 for USD itself.
+func viaUSD(lookup func(from, to string) (fxQuote, bool), currency string) (fxQuote, bool) {
+	if currency == "USD" {
+		return fxQuote{rate: 1}, true
+	}
+	return lookup(currency, "USD")
+}
+
+// earlier returns the earlier of two rate dates, ignoring a zero date.
+func earlier(a, b time.Time) time.Time {
+	if a.IsZero() || !b.IsZero() && b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// recordFX records on res the rate used to convert from one currency to
+// another at the given date, if a conversion took place.
+func (r *Reconciler) recordFX(res *models.ReconciliationResult, from, to string, at time.Time) {
+	if from == to {
+		return
+	}
+	q, ok := r.fxRate(from, to, at)
+	if !ok {
+		return
+	}
+	res.FXRate = &q.rate
+	if !q.date.IsZero() {
+		res.FXRateDate = &q.date
+	}
+}
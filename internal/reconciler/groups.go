@@ -0,0 +1,301 @@
+package reconciler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// groupID identifies a match group by its type and the record it is anchored
+// on: the transaction for a split, the settlement line for an aggregate.
+func groupID(typ, anchorID string) string {
+	return typ + ":" + anchorID
+}
+
+// splitSettlement reports whether sale lines sharing a processor key are the
+// parts of one transaction: lines with distinct content, in one currency, whose
+// gross amounts add up to the transaction amount (within tolerance, or off by
+// the fees). Exact copies of a part are returned separately as duplicates.
+func (r *Reconciler) splitSettlement(txn models.Transaction, setts []models.SettlementRecord) (parts, dups []models.SettlementRecord, ok bool) {
+	if setts[0].RecordType.Normalize() != models.RecordSale {
+		return nil, setts, false
+	}
+	seen := make(map[string]bool, len(setts))
+	for _, s := range setts {
+		if k := fingerprint(s); !seen[k] {
+			seen[k] = true
+			parts = append(parts, s)
+		} else {
+			dups = append(dups, s)
+		}
+	}
+	if len(parts) < 2 {
+		return nil, setts, false
+	}
+	for _, s := range parts[1:] {
+		if s.Currency != parts[0].Currency {
+			return nil, setts, false
+		}
+	}
+	total := combined(parts)
+	expected, err := r.convertAmount(txn.Captured(), txn.Currency, total.Currency, r.fxDate(txn, total))
+	if err != nil {
+		return nil, setts, false
+	}
+	if ok, _ := r.assessVariance([]models.Transaction{txn}, total, total.GrossAmount, expected); !ok {
+		return nil, setts, false
+	}
+	return parts, dups, true
+}
+
+// combined sums settlement lines of one currency into a single record,
+// settled when the last of them was.
+func combined(setts []models.SettlementRecord) models.SettlementRecord {
+	total := models.SettlementRecord{ProcessorName: setts[0].ProcessorName, Currency: setts[0].Currency}
+	for _, s := range setts {
+		if s.SettledAt.After(total.SettledAt) {
+			total.SettledAt = s.SettledAt
+		}
+		total.GrossAmount = total.GrossAmount.Add(s.GrossAmount)
+		total.FeeAmount = total.FeeAmount.Add(s.FeeAmount)
+		total.NetAmount = total.NetAmount.Add(s.NetAmount)
+	}
+	return total
+}
+
+// splitResults reports the parts of a split settlement, one result per line.
+// Each part is expected to cover its own gross amount except the last, which
+// is expected to cover the remainder, so any variance of the group shows up
+// once, on the last part.
+func (r *Reconciler) splitResults(nextID func() string, txn models.Transaction, parts []models.SettlementRecord) []models.ReconciliationResult {
+	total := combined(parts)
+	fxAt := r.fxDate(txn, total)
+	expected, _ := r.convertAmount(txn.Captured(), txn.Currency, total.Currency, fxAt) // splitSettlement converted it
+	status := models.StatusMatched
+	ok, varianceNote := r.assessVariance([]models.Transaction{txn}, total, total.GrossAmount, expected)
+	if !ok {
+		status = models.StatusMatchedWithVariance
+	}
+
+	id := groupID(models.GroupSplit, txn.ID)
+	authAt := txn.AuthorizedAt
+	remaining := expected
+	results := make([]models.ReconciliationResult, 0, len(parts))
+	for i, s := range parts {
+		partExpected := s.GrossAmount
+		notes := fmt.Sprintf("Split settlement: part %d of %d for %s (settled %s of %s %s)", i+1, len(parts), txn.ID, total.GrossAmount, expected, total.Currency)
+		if i == len(parts)-1 {
+			partExpected = remaining
+			if varianceNote != "" {
+				notes += "; " + varianceNote
+			}
+		}
+		remaining = remaining.Sub(partExpected)
+
+		settledAt := s.SettledAt
+		days := int(settledAt.Sub(authAt).Hours() / 24)
+		res := models.ReconciliationResult{
+			ID:                 nextID(),
+			TransactionID:      txn.ID,
+			SettlementID:       s.ID,
+			ProcessorName:      txn.ProcessorName,
+			Status:             status,
+			RecordType:         models.RecordSale,
+			ExpectedAmount:     partExpected,
+			SettledGrossAmount: s.GrossAmount,
+			SettledNetAmount:   s.NetAmount,
+			FeeAmount:          s.FeeAmount,
+			VarianceAmount:     s.GrossAmount.Sub(partExpected),
+			Currency:           s.Currency,
+			Country:            txn.Country,
+			AuthorizedAt:       &authAt,
+			SettledAt:          &settledAt,
+			DaysToSettle:       &days,
+			MatchGroup:         id,
+			Notes:              r.lateNote(notes, days),
+		}
+		r.recordFX(&res, txn.Currency, s.Currency, fxAt)
+		r.checkFee(&res, txn, s.GrossAmount)
+		if i == len(parts)-1 {
+			res.VarianceBreakdown = r.varianceBreakdown([]models.Transaction{txn}, total, res.VarianceAmount)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// matchAggregate matches a settlement line that nets several transactions,
+// listed in its ProcessorTxnIDs, reporting one result per transaction. Each
+// transaction is taken to have settled its expected amount except the last,
+// which gets the remainder of the line's gross and net amounts and all of its
+// fee, so any variance of the group shows up once, on the last result. The
+// line is assessed against the group as a whole, and its fee is checked
+// against the schedule fees of all the transactions. Transactions another
+// line already settled are left out of the group and named in its notes; a
+// line listing nothing else is reported as unexpected. It reports false if
+// none of the listed transactions are known.
+func (r *Reconciler) matchAggregate(nextID func() string, s models.SettlementRecord, idx *txnIndex, matchedTxnIDs map[string]bool) ([]models.ReconciliationResult, bool) {
+	var txns []models.Transaction
+	var missing, settled []string
+	found := make(map[string]bool, len(s.ProcessorTxnIDs))
+	for _, ref := range s.ProcessorTxnIDs {
+		txn, ok := idx.find(models.RecordSale, s.ProcessorName, ref, "")
+		switch {
+		case !ok:
+			missing = append(missing, ref)
+		case found[txn.ID]:
+		case matchedTxnIDs[txn.ID]:
+			found[txn.ID] = true
+			settled = append(settled, txn.ID)
+		default:
+			found[txn.ID] = true
+			txns = append(txns, txn)
+		}
+	}
+	switch {
+	case len(txns) == 0 && len(settled) == 0:
+		return nil, false
+	case len(txns) == 0:
+		settledAt := s.SettledAt
+		return []models.ReconciliationResult{{
+			ID:                 nextID(),
+			SettlementID:       s.ID,
+			ProcessorName:      s.ProcessorName,
+			Status:             models.StatusUnexpectedSettlement,
+			RecordType:         models.RecordSale,
+			SettledGrossAmount: s.GrossAmount,
+			SettledNetAmount:   s.NetAmount,
+			FeeAmount:          s.FeeAmount,
+			VarianceAmount:     s.GrossAmount,
+			Currency:           s.Currency,
+			SettledAt:          &settledAt,
+			Notes:              fmt.Sprintf("Aggregated settlement %s lists only transactions already settled: %s", s.ID, strings.Join(settled, ", ")),
+		}}, true
+	}
+
+	expected := make([]money.Amount, len(txns))
+	var totalExpected money.Amount
+	var convErr error // the first conversion without an FX rate
+	for i, txn := range txns {
+		var err error
+		expected[i], err = r.convertAmount(txn.Captured(), txn.Currency, s.Currency, r.fxDate(txn, s))
+		if convErr == nil {
+			convErr = err
+		}
+		totalExpected = totalExpected.Add(expected[i])
+	}
+	status := models.StatusMatched
+	ok, varianceNote := r.assessConverted(txns, s, s.GrossAmount, totalExpected, convErr)
+	if !ok {
+		status = models.StatusMatchedWithVariance
+	}
+	summary := fmt.Sprintf("Aggregated settlement %s covers %d transactions (settled %s of %s %s)", s.ID, len(txns), s.GrossAmount, totalExpected, s.Currency)
+	if len(missing) > 0 {
+		summary += fmt.Sprintf("; unknown references: %s", strings.Join(missing, ", "))
+	}
+	if len(settled) > 0 {
+		summary += fmt.Sprintf("; already settled, not counted: %s", strings.Join(settled, ", "))
+	}
+
+	id := groupID(models.GroupAggregate, s.ID)
+	settledAt := s.SettledAt
+	remainingGross, remainingNet := s.GrossAmount, s.NetAmount
+	var fees money.Amount // schedule fee of the whole line, if every transaction has a schedule
+	feesOK := true
+	results := make([]models.ReconciliationResult, 0, len(txns))
+	for i, txn := range txns {
+		matchedTxnIDs[txn.ID] = true
+		gross, net, fee := expected[i], expected[i], money.Amount{}
+		notes := summary
+		if i == len(txns)-1 {
+			gross, net, fee = remainingGross, remainingNet, s.FeeAmount
+			if varianceNote != "" {
+				notes += "; " + varianceNote
+			}
+		}
+		remainingGross = remainingGross.Sub(gross)
+		remainingNet = remainingNet.Sub(net)
+		scheduled, ok := r.expectedFee(s.ProcessorName, s.Currency, txn, gross)
+		fees, feesOK = fees.Add(scheduled), feesOK && ok
+
+		authAt := txn.AuthorizedAt
+		days := int(settledAt.Sub(authAt).Hours() / 24)
+		res := models.ReconciliationResult{
+			ID:                 nextID(),
+			TransactionID:      txn.ID,
+			SettlementID:       s.ID,
+			ProcessorName:      s.ProcessorName,
+			Status:             status,
+			RecordType:         models.RecordSale,
+			ExpectedAmount:     expected[i],
+			SettledGrossAmount: gross,
+			SettledNetAmount:   net,
+			FeeAmount:          fee,
+			VarianceAmount:     gross.Sub(expected[i]),
+			Currency:           s.Currency,
+			Country:            txn.Country,
+			AuthorizedAt:       &authAt,
+			SettledAt:          &settledAt,
+			DaysToSettle:       &days,
+			MatchGroup:         id,
+			Notes:              r.lateNote(notes, days),
+		}
+		r.recordFX(&res, txn.Currency, s.Currency, r.fxDate(txn, s))
+		if i == len(txns)-1 {
+			res.VarianceBreakdown = r.varianceBreakdown(txns, s, res.VarianceAmount)
+			if feesOK {
+				recordFee(&res, fees)
+			}
+		}
+		results = append(results, res)
+	}
+	return results, true
+}
+
+// addGroupToSummary counts a match group in s.
+func addGroupToSummary(s *models.ReportSummary, group string) {
+	switch typ, _, _ := strings.Cut(group, ":"); typ {
+	case models.GroupSplit:
+		s.SplitGroups++
+	case models.GroupAggregate:
+		s.AggregatedGroups++
+	}
+}
+
+// matchGroups collects the match groups of results, in order of first appearance.
+func matchGroups(results []models.ReconciliationResult) []models.MatchGroup {
+	groups := []models.MatchGroup{}
+	pos := make(map[string]int)
+	for _, res := range results {
+		if res.MatchGroup == "" {
+			continue
+		}
+		i, ok := pos[res.MatchGroup]
+		if !ok {
+			typ, _, _ := strings.Cut(res.MatchGroup, ":")
+			i = len(groups)
+			pos[res.MatchGroup] = i
+			groups = append(groups, models.MatchGroup{
+				ID:             res.MatchGroup,
+				Type:           typ,
+				Status:         res.Status,
+				TransactionIDs: []string{},
+				SettlementIDs:  []string{},
+				Currency:       res.Currency,
+			})
+		}
+		g := &groups[i]
+		if len(g.TransactionIDs) == 0 || g.TransactionIDs[len(g.TransactionIDs)-1] != res.TransactionID {
+			g.TransactionIDs = append(g.TransactionIDs, res.TransactionID)
+		}
+		if len(g.SettlementIDs) == 0 || g.SettlementIDs[len(g.SettlementIDs)-1] != res.SettlementID {
+			g.SettlementIDs = append(g.SettlementIDs, res.SettlementID)
+		}
+		g.ExpectedAmount = g.ExpectedAmount.Add(res.ExpectedAmount)
+		g.SettledGrossAmount = g.SettledGrossAmount.Add(res.SettledGrossAmount)
+		g.VarianceAmount = g.VarianceAmount.Add(res.VarianceAmount)
+	}
+	return groups
+}
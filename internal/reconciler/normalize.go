@@ -0,0 +1,134 @@
+package reconciler
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// ReferenceRules is a validated, ordered list of reference normalization rules.
+type ReferenceRules []referenceRule
+
+type referenceRule struct {
+	models.ReferenceRule
+	re *regexp.Regexp
+}
+
+// CompileReferenceRules validates rules and compiles their patterns.
+func CompileReferenceRules(rules []models.ReferenceRule) (ReferenceRules, error) {
+	out := make(ReferenceRules, 0, len(rules))
+	for i, rule := range rules {
+		cr := referenceRule{ReferenceRule: rule}
+		switch rule.Field {
+		case "", models.RefFieldProcessorTxnID, models.RefFieldOrderReference:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown field %q", i+1, rule.Field)
+		}
+		switch rule.Type {
+		case models.RuleRegexExtract:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %w", i+1, err)
+			}
+			cr.re = re
+		case models.RuleStripPrefix:
+			if rule.Prefix == "" {
+				return nil, fmt.Errorf("rule %d: strip_prefix needs a prefix", i+1)
+			}
+		case models.RuleZeroPad:
+			if rule.Width <= 0 {
+				return nil, fmt.Errorf("rule %d: zero_pad needs a positive width", i+1)
+			}
+		case models.RuleCaseFold, models.RuleTrim:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown rule type %q", i+1, rule.Type)
+		}
+		out = append(out, cr)
+	}
+	return out, nil
+}
+
+// Apply returns ref with every rule that applies to field run in order.
+func (rs ReferenceRules) Apply(field, ref string) string {
+	for _, rule := range rs {
+		ref = rule.apply(field, ref)
+	}
+	return ref
+}
+
+// Trace is Apply but returns the reference after each rule, for dry runs.
+func (rs ReferenceRules) Trace(field, ref string) []string {
+	steps := make([]string, 0, len(rs))
+	for _, rule := range rs {
+		ref = rule.apply(field, ref)
+		steps = append(steps, ref)
+	}
+	return steps
+}
+
+func (r referenceRule) apply(field, ref string) string {
+	if r.Field != "" && r.Field != field {
+		return ref
+	}
+	switch r.Type {
+	case models.RuleRegexExtract:
+		m := r.re.FindStringSubmatch(ref)
+		switch {
+		case m == nil:
+			return ref
+		case len(m) > 1:
+			return m[1]
+		default:
+			return m[0]
+		}
+	case models.RuleStripPrefix:
+		return strings.TrimPrefix(ref, r.Prefix)
+	case models.RuleCaseFold:
+		return strings.ToLower(ref)
+	case models.RuleZeroPad:
+		digits := len(ref) - len(strings.TrimRight(ref, "0123456789"))
+		if digits == 0 || digits >= r.Width {
+			return ref
+		}
+		return ref[:len(ref)-digits] + strings.Repeat("0", r.Width-digits) + ref[len(ref)-digits:]
+	case models.RuleTrim:
+		if r.Chars == "" {
+			return strings.TrimSpace(ref)
+		}
+		return strings.Trim(ref, r.Chars)
+	}
+	return ref
+}
+
+// ValidateReferenceRules checks every processor's reference rules.
+func ValidateReferenceRules(rules map[string][]models.ReferenceRule) error {
+	_, err := newNormalizer(rules)
+	return err
+}
+
+// normalizer applies each processor's reference rules.
+type normalizer map[string]ReferenceRules
+
+func newNormalizer(rules map[string][]models.ReferenceRule) (normalizer, error) {
+	n := make(normalizer, len(rules))
+	for _, processor := range slices.Sorted(maps.Keys(rules)) {
+		compiled, err := CompileReferenceRules(rules[processor])
+		if err != nil {
+			return nil, fmt.Errorf("reference rules for %s: %w", processor, err)
+		}
+		n[processor] = compiled
+	}
+	return n, nil
+}
+
+func (n normalizer) txnID(processor, ref string) string {
+	return n[processor].Apply(models.RefFieldProcessorTxnID, ref)
+}
+
+func (n normalizer) orderRef(processor, ref string) string {
+	return n[processor].Apply(models.RefFieldOrderReference, ref)
+}
@@ -0,0 +1,66 @@
+package reconciler
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+func TestReferenceRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []models.ReferenceRule
+		field string
+		in    string
+		want  string
+	}{
+		{"trim whitespace", []models.ReferenceRule{{Type: models.RuleTrim}}, models.RefFieldProcessorTxnID, "  PSM-1 \t", "PSM-1"},
+		{"trim chars", []models.ReferenceRule{{Type: models.RuleTrim, Chars: "#*"}}, models.RefFieldProcessorTxnID, "#PSM-1*", "PSM-1"},
+		{"strip prefix", []models.ReferenceRule{{Type: models.RuleStripPrefix, Prefix: "REF:"}}, models.RefFieldProcessorTxnID, "REF:123", "123"},
+		{"case fold", []models.ReferenceRule{{Type: models.RuleCaseFold}}, models.RefFieldProcessorTxnID, "PsM-Ab", "psm-ab"},
+		{"zero pad", []models.ReferenceRule{{Type: models.RuleZeroPad, Width: 6}}, models.RefFieldProcessorTxnID, "PSM-42", "PSM-000042"},
+		{"zero pad already wide", []models.ReferenceRule{{Type: models.RuleZeroPad, Width: 2}}, models.RefFieldProcessorTxnID, "PSM-420", "PSM-420"},
+		{"zero pad no digits", []models.ReferenceRule{{Type: models.RuleZeroPad, Width: 6}}, models.RefFieldProcessorTxnID, "PSM-X", "PSM-X"},
+		{"regex capture group", []models.ReferenceRule{{Type: models.RuleRegexExtract, Pattern: `ID=(\w+)`}}, models.RefFieldProcessorTxnID, "batch 7; ID=abc123; ok", "abc123"},
+		{"regex whole match", []models.ReferenceRule{{Type: models.RuleRegexExtract, Pattern: `\d+`}}, models.RefFieldProcessorTxnID, "TX-0099-B", "0099"},
+		{"regex no match", []models.ReferenceRule{{Type: models.RuleRegexExtract, Pattern: `\d+`}}, models.RefFieldProcessorTxnID, "none", "none"},
+		{"field restricted", []models.ReferenceRule{{Type: models.RuleCaseFold, Field: models.RefFieldOrderReference}}, models.RefFieldProcessorTxnID, "ABC", "ABC"},
+		{"chain", []models.ReferenceRule{
+			{Type: models.RuleTrim},
+			{Type: models.RuleCaseFold},
+			{Type: models.RuleStripPrefix, Prefix: "psm-"},
+			{Type: models.RuleZeroPad, Width: 4},
+		}, models.RefFieldProcessorTxnID, " PSM-7 ", "0007"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := CompileReferenceRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rules.Apply(tt.field, tt.in); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	rules, _ := CompileReferenceRules([]models.ReferenceRule{{Type: models.RuleTrim}, {Type: models.RuleCaseFold}})
+	if got, want := rules.Trace(models.RefFieldOrderReference, " AB "), []string{"AB", "ab"}; !slices.Equal(got, want) {
+		t.Errorf("Trace = %q, want %q", got, want)
+	}
+}
+
+func TestCompileReferenceRulesRejectsInvalid(t *testing.T) {
+	for _, rule := range []models.ReferenceRule{
+		{Type: "uppercase"},
+		{Type: models.RuleRegexExtract, Pattern: "("},
+		{Type: models.RuleStripPrefix},
+		{Type: models.RuleZeroPad},
+		{Type: models.RuleTrim, Field: "order_id"},
+	} {
+		if _, err := CompileReferenceRules([]models.ReferenceRule{rule}); err == nil {
+			t.Errorf("expected an error for %+v", rule)
+		}
+	}
+}
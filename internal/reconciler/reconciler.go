@@ -1,50 +1,130 @@
 package reconciler
 
 import (
+	"context"
 	"fmt"
-	"math"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
 	"github.com/denys-rosario/settlement-reconciler/internal/store"
 )
 
 // Reconciler performs the core matching logic between internal transactions
 // and processor settlement records.
 type Reconciler struct {
-	store  *store.Store
-	config models.ReconciliationConfig
+	store   store.Store
+	config  models.ReconciliationConfig
+	rates   fxTable                    // dated FX rates of the run in progress
+	volumes map[[2]string]money.Amount // sale volume per processor and currency of the run in progress
+	asOf    time.Time                  // date the run in progress ages unsettled transactions to
 }
 
-func New(s *store.Store, cfg models.ReconciliationConfig) *Reconciler {
+func New(s store.Store, cfg models.ReconciliationConfig) *Reconciler {
 	return &Reconciler{store: s, config: cfg}
 }
 
+// forRun returns a copy of r holding the state derived from one run's inputs,
+// so that concurrent runs sharing r each use their own.
+func (r *Reconciler) forRun(in models.RunInputs) *Reconciler {
+	cp := *r
+	cp.rates = newFXTable(in.FXRates)
+	cp.volumes = saleVolumes(in.Settlements)
+	cp.asOf = asOfDate(r.config.AsOf, in)
+	return &cp
+}
+
 // Run executes a full reconciliation pass and returns a report.
-func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
-	transactions := r.store.ListTransactions()
-	settlements := r.store.ListSettlements()
+func (r *Reconciler) Run(runID string) (*models.ReconciliationReport, error) {
+	return r.RunContext(context.Background(), runID, nil)
+}
+
+// RunContext is Run with cancellation and progress reporting. It stops and
+// returns ctx.Err() once ctx is done. If progress is non-nil it is called with
+// the percentage complete (0-100) each time that value changes.
+func (r *Reconciler) RunContext(ctx context.Context, runID string, progress func(pct int)) (*models.ReconciliationReport, error) {
+	in, err := r.LoadInputs()
+	if err != nil {
+		return nil, err
+	}
+	return r.Reconcile(ctx, runID, in, progress)
+}
+
+// Config returns the configuration the reconciler was created with.
+func (r *Reconciler) Config() models.ReconciliationConfig {
+	return r.config
+}
+
+// LoadInputs reads the current transactions, settlements and dated FX rates
+// from the store, sorted so that reconciling them is deterministic.
+func (r *Reconciler) LoadInputs() (models.RunInputs, error) {
+	transactions, err := r.store.ListTransactions()
+	if err != nil {
+		return models.RunInputs{}, fmt.Errorf("loading transactions: %w", err)
+	}
+	settlements, err := r.store.ListSettlements()
+	if err != nil {
+		return models.RunInputs{}, fmt.Errorf("loading settlements: %w", err)
+	}
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].ID < transactions[j].ID })
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	rates, err := r.store.ListFXRates()
+	if err != nil {
+		return models.RunInputs{}, fmt.Errorf("loading FX rates: %w", err)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		a, b := rates[i], rates[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Date.Before(b.Date)
+	})
+	return models.RunInputs{Transactions: transactions, Settlements: settlements, FXRates: rates}, nil
+}
+
+// Reconcile reconciles the given inputs, without reading the store. The same
+// inputs and config always produce the same report apart from GeneratedAt.
+// Cancellation and progress work as in RunContext.
+func (r *Reconciler) Reconcile(ctx context.Context, runID string, in models.RunInputs, progress func(pct int)) (*models.ReconciliationReport, error) {
+	transactions, settlements := in.Transactions, in.Settlements
+	r = r.forRun(in)
+
+	// Progress covers phases 2 and 4, which visit every settlement and transaction once.
+	tracker := &progressTracker{ctx: ctx, total: len(settlements) + len(transactions), report: progress, last: -1}
+	if err := tracker.step(0); err != nil {
+		return nil, err
+	}
 
 	// Build lookup indexes for matching.
 	// Primary key: processor_name:processor_txn_id
 	// Fallback key: order_id / order_reference
-	txnByProcessorKey := make(map[string]models.Transaction, len(transactions))
-	txnByOrderID := make(map[string]models.Transaction, len(transactions))
-	for _, t := range transactions {
-		pk := processorKey(t.ProcessorName, t.ProcessorTxnID)
-		txnByProcessorKey[pk] = t
-		txnByOrderID[t.OrderID] = t
+	// Both are per record type, so a refund never matches its sale's settlement line,
+	// and both are normalized with the processor's reference rules.
+	norm, err := newNormalizer(r.config.ReferenceRules)
+	if err != nil {
+		return nil, err
 	}
+	idx := newTxnIndex(transactions, norm)
 
 	// Track which transactions and settlements have been matched.
 	matchedTxnIDs := make(map[string]bool)
 	matchedSettlementIDs := make(map[string]bool)
 
-	// Track settlement processor keys to detect duplicates.
+	// Track settlement processor keys to detect duplicates and split settlements.
+	// Lines without a processor transaction ID (order-reference-only and
+	// aggregated lines) have no key to repeat.
 	settlementsByKey := make(map[string][]models.SettlementRecord)
 	for _, s := range settlements {
-		pk := processorKey(s.ProcessorName, s.ProcessorTxnID)
+		if s.ProcessorTxnID == "" {
+			continue
+		}
+		pk := idx.settlementKey(s)
 		settlementsByKey[pk] = append(settlementsByKey[pk], s)
 	}
 
@@ -55,31 +135,56 @@ func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
 		return fmt.Sprintf("RR-%s-%04d", runID, resultID)
 	}
 
-	// Phase 1: Detect duplicates — settlements with the same processor key appearing more than once.
+	// Phase 1: Settlements with the same processor key appearing more than once.
+	// Lines with distinct content that add up to their transaction are a split
+	// settlement; anything else sharing a key is a duplicate, classified by content.
+	// Keys are visited in settlement order so result IDs do not depend on map iteration.
 	duplicateKeys := make(map[string]bool)
-	for key, setts := range settlementsByKey {
-		if len(setts) > 1 {
+	overpaid := make(overpayments)
+	for _, first := range settlements {
+		key := idx.settlementKey(first)
+		if setts := settlementsByKey[key]; len(setts) > 1 && !duplicateKeys[key] {
 			duplicateKeys[key] = true
-			txn, txnFound := findTransaction(key, setts[0].OrderReference, txnByProcessorKey, txnByOrderID)
-			for _, s := range setts {
+			txn, txnFound := idx.find(first.RecordType, first.ProcessorName, first.ProcessorTxnID, setts[0].OrderReference)
+			dups := setts
+			extra := len(setts) - 1 // lines beyond the one that was due
+			if txnFound {
+				if parts, rest, ok := r.splitSettlement(txn, setts); ok {
+					matchedTxnIDs[txn.ID] = true
+					for _, s := range parts {
+						matchedSettlementIDs[s.ID] = true
+					}
+					results = append(results, r.splitResults(nextID, txn, parts)...)
+					dups, extra = rest, len(rest)
+				}
+			}
+			if over := r.overpayment(setts, txn, txnFound); over.Sign() > 0 {
+				overpaid.add(first.ProcessorName, first.Currency, over, extra)
+			}
+			set := newDuplicateSet(setts)
+			for _, s := range dups {
+				kind, of := set.classify(s)
 				res := models.ReconciliationResult{
 					ID:                 nextID(),
 					SettlementID:       s.ID,
 					ProcessorName:      s.ProcessorName,
 					Status:             models.StatusDuplicate,
+					RecordType:         s.RecordType.Normalize(),
 					SettledGrossAmount: s.GrossAmount,
 					SettledNetAmount:   s.NetAmount,
 					FeeAmount:          s.FeeAmount,
 					Currency:           s.Currency,
-					Notes:              fmt.Sprintf("Duplicate settlement for processor key %s (%d occurrences)", key, len(setts)),
+					DuplicateKind:      kind,
+					DuplicateOf:        of,
+					Notes:              duplicateNote(s, len(setts), kind, of),
 				}
 				settledAt := s.SettledAt
 				res.SettledAt = &settledAt
 				if txnFound {
 					res.TransactionID = txn.ID
-					res.ExpectedAmount = txn.Amount
+					res.ExpectedAmount = txn.Captured()
 					res.Country = txn.Country
-					res.VarianceAmount = s.GrossAmount - txn.Amount
+					res.VarianceAmount = s.GrossAmount.Sub(txn.Captured())
 					authAt := txn.AuthorizedAt
 					res.AuthorizedAt = &authAt
 					days := int(s.SettledAt.Sub(txn.AuthorizedAt).Hours() / 24)
@@ -94,15 +199,30 @@ func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
 
 	// Phase 2: Match settlements to transactions (skip duplicates already handled).
 	for _, s := range settlements {
+		if err := tracker.step(1); err != nil {
+			return nil, err
+		}
 		if matchedSettlementIDs[s.ID] {
 			continue
 		}
-		pk := processorKey(s.ProcessorName, s.ProcessorTxnID)
+		pk := idx.settlementKey(s)
 		if duplicateKeys[pk] {
 			continue
 		}
+		matchedSettlementIDs[s.ID] = true
 
-		txn, found := findTransaction(pk, s.OrderReference, txnByProcessorKey, txnByOrderID)
+		if s.RecordType.Normalize() != models.RecordSale {
+			results = append(results, r.matchNonSale(nextID(), s, idx, matchedTxnIDs))
+			continue
+		}
+		if len(s.ProcessorTxnIDs) > 0 {
+			if group, ok := r.matchAggregate(nextID, s, idx, matchedTxnIDs); ok {
+				results = append(results, group...)
+				continue
+			}
+		}
+
+		txn, found := idx.find(s.RecordType, s.ProcessorName, s.ProcessorTxnID, s.OrderReference)
 		if !found {
 			// Unexpected settlement — no internal transaction found.
 			settledAt := s.SettledAt
@@ -111,6 +231,7 @@ func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
 				SettlementID:       s.ID,
 				ProcessorName:      s.ProcessorName,
 				Status:             models.StatusUnexpectedSettlement,
+				RecordType:         models.RecordSale,
 				SettledGrossAmount: s.GrossAmount,
 				SettledNetAmount:   s.NetAmount,
 				FeeAmount:          s.FeeAmount,
@@ -119,58 +240,34 @@ func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
 				SettledAt:          &settledAt,
 				Notes:              "Settlement record has no matching internal transaction",
 			})
-			matchedSettlementIDs[s.ID] = true
 			continue
 		}
 
 		// We have a match — determine if amounts align.
 		matchedTxnIDs[txn.ID] = true
-		matchedSettlementIDs[s.ID] = true
 
-		expectedAmount := r.convertAmount(txn.Amount, txn.Currency, s.Currency)
-		variance := s.GrossAmount - expectedAmount
+		fxAt := r.fxDate(txn, s)
+		expectedAmount, err := r.convertAmount(txn.Captured(), txn.Currency, s.Currency, fxAt)
+		variance := s.GrossAmount.Sub(expectedAmount)
 
 		status := models.StatusMatched
-		notes := ""
-
-		if math.Abs(variance) > 0.01 {
-			// Check tolerance
-			toleranceAmt := expectedAmount * r.config.VarianceTolerancePct
-			if math.Abs(variance) <= toleranceAmt {
-				status = models.StatusMatched
-				notes = fmt.Sprintf("Variance of %.2f %s within tolerance (%.1f%%)", variance, s.Currency, r.config.VarianceTolerancePct*100)
-			} else {
-				status = models.StatusMatchedWithVariance
-				if txn.Currency != s.Currency {
-					notes = fmt.Sprintf("Cross-currency: authorized %.2f %s, settled %.2f %s (expected ~%.2f %s after FX)",
-						txn.Amount, txn.Currency, s.GrossAmount, s.Currency, expectedAmount, s.Currency)
-				} else if s.FeeAmount > 0 && math.Abs(variance+s.FeeAmount) < 0.01 {
-					notes = fmt.Sprintf("Variance of %.2f %s matches fee deduction of %.2f", variance, s.Currency, s.FeeAmount)
-					status = models.StatusMatched // fee-explained variance
-				} else {
-					notes = fmt.Sprintf("Amount variance: expected %.2f, settled gross %.2f (diff: %.2f %s)",
-						expectedAmount, s.GrossAmount, variance, s.Currency)
-				}
-			}
+		ok, notes := r.assessConverted([]models.Transaction{txn}, s, s.GrossAmount, expectedAmount, err)
+		if !ok {
+			status = models.StatusMatchedWithVariance
 		}
 
 		authAt := txn.AuthorizedAt
 		settledAt := s.SettledAt
 		days := int(settledAt.Sub(authAt).Hours() / 24)
+		notes = r.lateNote(notes, days)
 
-		if days > r.config.LateSettlementDays {
-			if notes != "" {
-				notes += "; "
-			}
-			notes += fmt.Sprintf("Late settlement: %d days (threshold: %d)", days, r.config.LateSettlementDays)
-		}
-
-		results = append(results, models.ReconciliationResult{
+		res := models.ReconciliationResult{
 			ID:                 nextID(),
 			TransactionID:      txn.ID,
 			SettlementID:       s.ID,
 			ProcessorName:      txn.ProcessorName,
 			Status:             status,
+			RecordType:         models.RecordSale,
 			ExpectedAmount:     expectedAmount,
 			SettledGrossAmount: s.GrossAmount,
 			SettledNetAmount:   s.NetAmount,
@@ -182,71 +279,368 @@ func (r *Reconciler) Run(runID string) *models.ReconciliationReport {
 			SettledAt:          &settledAt,
 			DaysToSettle:       &days,
 			Notes:              notes,
-		})
+			VarianceBreakdown:  r.varianceBreakdown([]models.Transaction{txn}, s, variance),
+		}
+		r.recordFX(&res, txn.Currency, s.Currency, fxAt)
+		r.checkFee(&res, txn, s.GrossAmount)
+		results = append(results, res)
 	}
 
-	// Phase 3: Unsettled — internal transactions with no settlement match.
+	// Phase 3: Fuzzy — pair leftover unexpected settlements with leftover sales.
+	if err := r.fuzzyMatch(ctx, results, settlements, transactions, matchedTxnIDs); err != nil {
+		return nil, err
+	}
+
+	// Settlements matched to failed transactions are flagged rather than matched.
+	flagFailedSettlements(results, transactions)
+
+	// Phase 4: Unsettled — internal transactions with no settlement match.
+	// Failed and never-captured transactions are not expected to settle; they
+	// are reported separately, with nothing expected.
 	for _, txn := range transactions {
+		if err := tracker.step(1); err != nil {
+			return nil, err
+		}
 		if matchedTxnIDs[txn.ID] {
 			continue
 		}
+		rt := txn.RecordType.Normalize()
+		expected := txn.Captured()
+		if rt != models.RecordSale {
+			expected = signed(expected, rt.Direction())
+		}
+		status, notes := models.StatusUnsettled, "No settlement record found for this transaction"
+		switch {
+		case txn.Status == models.TxnFailed:
+			status, notes = models.StatusFailed, fmt.Sprintf("Transaction failed; no settlement expected for %s %s", txn.Amount, txn.Currency)
+			expected = money.Amount{}
+		case !txn.ExpectsSettlement():
+			status, notes = models.StatusNotCaptured, fmt.Sprintf("Authorized for %s %s but never captured; no settlement expected", txn.Amount, txn.Currency)
+			expected = money.Amount{}
+		}
 		authAt := txn.AuthorizedAt
-		results = append(results, models.ReconciliationResult{
-			ID:             nextID(),
-			TransactionID:  txn.ID,
-			ProcessorName:  txn.ProcessorName,
-			Status:         models.StatusUnsettled,
-			ExpectedAmount: txn.Amount,
-			Currency:       txn.Currency,
-			Country:        txn.Country,
-			AuthorizedAt:   &authAt,
-			Notes:          "No settlement record found for this transaction",
-		})
+		res := models.ReconciliationResult{
+			ID:                    nextID(),
+			TransactionID:         txn.ID,
+			ProcessorName:         txn.ProcessorName,
+			Status:                status,
+			RecordType:            rt,
+			OriginalTransactionID: txn.OriginalTransactionID,
+			ExpectedAmount:        expected,
+			Currency:              txn.Currency,
+			Country:               txn.Country,
+			AuthorizedAt:          &authAt,
+			Notes:                 notes,
+		}
+		if status == models.StatusUnsettled {
+			days := r.daysOutstanding(authAt)
+			res.DaysOutstanding = &days
+			res.AgingBucket = agingBucket(days)
+			res.Notes += fmt.Sprintf(" (outstanding %d days as of %s)", days, r.asOf.Format("2006-01-02"))
+		}
+		results = append(results, res)
 	}
 
 	// Build the report.
 	report := r.buildReport(runID, transactions, settlements, results)
-	return report
+	report.DuplicateAnalysis = duplicateAnalysis(settlements, idx, results, overpaid)
+
+	// Validation: data-quality findings, reported alongside the matching results.
+	report.DataQuality = dataQuality(transactions, settlements, results)
+	report.Summary.DataQualityFindings = len(report.DataQuality.Findings)
+	tracker.finish()
+	return report, nil
+}
+
+// assessVariance reports whether the gross amount settled for a group of
+// transactions, usually just one, agrees with the amount expected for all of
+// them (exactly, within tolerance, or off by exactly the fee) and explains any
+// difference.
+func (r *Reconciler) assessVariance(txns []models.Transaction, s models.SettlementRecord, gross, expected money.Amount) (bool, string) {
+	variance := gross.Sub(expected)
+	// Amounts that agree to the settlement currency's minor unit are equal.
+	if variance.Round(s.Currency).IsZero() {
+		return true, ""
+	}
+	toleranceAmt := expected.Abs().MulRate(r.config.VarianceTolerancePct)
+	if variance.Abs().Cmp(toleranceAmt) <= 0 {
+		return true, fmt.Sprintf("Variance of %s %s within tolerance (%.1f%%)", variance, s.Currency, r.config.VarianceTolerancePct*100)
+	}
+	if slices.ContainsFunc(txns, func(txn models.Transaction) bool { return txn.Currency != s.Currency }) {
+		return false, fmt.Sprintf("Cross-currency: captured %s, settled %s %s (expected ~%s %s after FX)",
+			capturedTotals(txns), gross, s.Currency, expected, s.Currency)
+	}
+	if s.FeeAmount.Sign() > 0 && variance.Add(s.FeeAmount).Round(s.Currency).IsZero() {
+		return true, fmt.Sprintf("Variance of %s %s matches fee deduction of %s", variance, s.Currency, s.FeeAmount) // fee-explained variance
+	}
+	return false, fmt.Sprintf("Amount variance: expected %s, settled gross %s (diff: %s %s)",
+		expected, gross, variance, s.Currency)
+}
+
+// assessConverted is assessVariance for an expected amount converted to the
+// settlement currency with error err. Without an FX rate there is no expected
+// amount, which is reported as zero: the amounts do not agree, and the note
+// says why.
+func (r *Reconciler) assessConverted(txns []models.Transaction, s models.SettlementRecord, gross, expected money.Amount, err error) (bool, string) {
+	if err != nil {
+		return false, fmt.Sprintf("Expected amount unknown: %v", err)
+	}
+	return r.assessVariance(txns, s, gross, expected)
+}
+
+// capturedTotals describes what transactions captured, per currency in order
+// of first appearance, e.g. "100.00 BRL + 40.00 MXN".
+func capturedTotals(txns []models.Transaction) string {
+	var currencies []string
+	totals := make(map[string]money.Amount)
+	for _, txn := range txns {
+		if _, ok := totals[txn.Currency]; !ok {
+			currencies = append(currencies, txn.Currency)
+		}
+		totals[txn.Currency] = totals[txn.Currency].Add(txn.Captured())
+	}
+	parts := make([]string, len(currencies))
+	for i, c := range currencies {
+		parts[i] = fmt.Sprintf("%s %s", totals[c], c)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// lateNote appends a late-settlement note to notes when days exceeds the threshold.
+func (r *Reconciler) lateNote(notes string, days int) string {
+	if days <= r.config.LateSettlementDays {
+		return notes
+	}
+	if notes != "" {
+		notes += "; "
+	}
+	return notes + fmt.Sprintf("Late settlement: %d days (threshold: %d)", days, r.config.LateSettlementDays)
+}
+
+// matchNonSale reconciles a refund, chargeback, chargeback reversal or
+// adjustment line. It is matched to an internal record of the same type if
+// there is one, and otherwise linked to the original sale, whose full amount
+// is then expected. Amounts are signed by the record type's direction, so a
+// refund settles as a negative gross amount whichever sign the file used.
+func (r *Reconciler) matchNonSale(id string, s models.SettlementRecord, idx *txnIndex, matchedTxnIDs map[string]bool) models.ReconciliationResult {
+	rt := s.RecordType.Normalize()
+	dir := rt.Direction()
+	gross := signed(s.GrossAmount, dir)
+	settledAt := s.SettledAt
+	res := models.ReconciliationResult{
+		ID:                 id,
+		SettlementID:       s.ID,
+		ProcessorName:      s.ProcessorName,
+		RecordType:         rt,
+		SettledGrossAmount: gross,
+		SettledNetAmount:   signed(s.NetAmount, dir),
+		FeeAmount:          s.FeeAmount,
+		Currency:           s.Currency,
+		SettledAt:          &settledAt,
+	}
+
+	notes := ""
+	txn, found := idx.find(rt, s.ProcessorName, s.ProcessorTxnID, s.OrderReference)
+	if found {
+		matchedTxnIDs[txn.ID] = true
+		res.TransactionID = txn.ID
+		res.OriginalTransactionID = txn.OriginalTransactionID
+		authAt := txn.AuthorizedAt
+		days := int(settledAt.Sub(authAt).Hours() / 24)
+		res.AuthorizedAt = &authAt
+		res.DaysToSettle = &days
+	} else if rt != models.RecordAdjustment {
+		// The sale itself stays open for its own settlement line, so it is not marked matched.
+		txn, found = idx.sale(s.ProcessorName, s.OriginalProcessorTxnID, s.OrderReference)
+		if found {
+			res.OriginalTransactionID = txn.ID
+			notes = fmt.Sprintf("No internal %s record; linked to original transaction %s", rt, txn.ID)
+		}
+	}
+	if !found {
+		res.VarianceAmount = gross
+		if rt == models.RecordAdjustment {
+			res.Status = models.StatusAdjustment
+			res.Notes = "Processor adjustment with no matching internal record"
+		} else {
+			res.Status = models.StatusUnlinked
+			res.Notes = fmt.Sprintf("No internal %s record and original transaction %q not found", rt, s.OriginalProcessorTxnID)
+		}
+		return res
+	}
+
+	res.ProcessorName = txn.ProcessorName
+	res.Country = txn.Country
+	fxAt := r.fxDate(txn, s)
+	expected, err := r.convertAmount(txn.Captured(), txn.Currency, s.Currency, fxAt)
+	res.ExpectedAmount = signed(expected, dir)
+	r.recordFX(&res, txn.Currency, s.Currency, fxAt)
+	res.VarianceAmount = gross.Sub(res.ExpectedAmount)
+	ok, varianceNotes := r.assessConverted([]models.Transaction{txn}, s, gross, res.ExpectedAmount, err)
+	res.Status = models.StatusMatchedWithVariance
+	if ok {
+		res.Status = matchedStatus[rt]
+	}
+	if varianceNotes != "" {
+		if notes != "" {
+			notes += "; "
+		}
+		notes += varianceNotes
+	}
+	if res.DaysToSettle != nil {
+		notes = r.lateNote(notes, *res.DaysToSettle)
+	}
+	res.Notes = notes
+	return res
+}
+
+// flagFailedSettlements marks every settlement line matched to a failed
+// transaction, directly, as part of a group, fuzzily or as a duplicate, as
+// failed_transaction_settled: nothing was due, so the whole settled amount is
+// a variance, and no fee was due on it either.
+func flagFailedSettlements(results []models.ReconciliationResult, transactions []models.Transaction) {
+	failed := make(map[string]models.Transaction)
+	for _, txn := range transactions {
+		if txn.Status == models.TxnFailed {
+			failed[txn.ID] = txn
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	for i := range results {
+		res := &results[i]
+		txn, ok := failed[res.TransactionID]
+		if !ok || res.SettlementID == "" {
+			continue
+		}
+		notes := fmt.Sprintf("Settlement received for failed transaction %s (%s %s); the customer may have been charged", txn.ID, txn.Amount, txn.Currency)
+		if res.Status == models.StatusDuplicate {
+			notes += "; " + res.Notes
+		}
+		res.Status = models.StatusFailedSettled
+		res.ExpectedAmount = money.Amount{}
+		res.VarianceAmount = res.SettledGrossAmount
+		res.VarianceBreakdown = nil
+		res.ExpectedFee, res.FeeOvercharge = nil, nil
+		res.Notes = notes
+	}
+}
+
+// matchedStatus is the status of a non-sale record whose amount agrees with what was expected.
+var matchedStatus = map[models.RecordType]models.ReconciliationStatus{
+	models.RecordRefund:             models.StatusRefunded,
+	models.RecordChargeback:         models.StatusChargeback,
+	models.RecordChargebackReversal: models.StatusChargebackReversed,
+	models.RecordAdjustment:         models.StatusMatched,
+}
+
+// signed returns a with the sign given by a record type's direction; a zero
+// direction leaves a unchanged.
+func signed(a money.Amount, direction int) money.Amount {
+	switch {
+	case direction < 0:
+		return a.Abs().Neg()
+	case direction > 0:
+		return a.Abs()
+	}
+	return a
+}
+
+// progressTracker checks for cancellation and reports percent complete as
+// records are processed. 100% is only reported once the report is built.
+type progressTracker struct {
+	ctx    context.Context
+	total  int
+	done   int
+	last   int
+	report func(pct int)
+}
+
+func (p *progressTracker) step(n int) error {
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.done += n
+	pct := 99
+	if p.total > 0 {
+		pct = min(p.done*99/p.total, 99)
+	}
+	p.emit(pct)
+	return nil
+}
+
+func (p *progressTracker) finish() {
+	p.emit(100)
+}
+
+func (p *progressTracker) emit(pct int) {
+	if p.report != nil && pct != p.last {
+		p.last = pct
+		p.report(pct)
+	}
 }
 
 // buildReport computes summary statistics and breakdowns from the results.
 func (r *Reconciler) buildReport(runID string, txns []models.Transaction, setts []models.SettlementRecord, results []models.ReconciliationResult) *models.ReconciliationReport {
 	report := &models.ReconciliationReport{
-		RunID:       runID,
-		GeneratedAt: time.Now().UTC(),
-		ByCurrency:  make(map[string]models.ReportSummary),
-		ByCountry:   make(map[string]models.ReportSummary),
-		ByProcessor: make(map[string]models.ReportSummary),
-		Results:     results,
+		RunID:          runID,
+		GeneratedAt:    time.Now().UTC(),
+		AsOf:           r.asOf,
+		ByCurrency:     make(map[string]models.ReportSummary),
+		ByCountry:      make(map[string]models.ReportSummary),
+		ByProcessor:    make(map[string]models.ReportSummary),
+		ByRecordType:   make(map[string]models.ReportSummary),
+		Results:        results,
+		MatchGroups:    matchGroups(results),
+		FeeOvercharges: feeOvercharges(results),
 	}
 
 	report.Summary.TotalTransactions = len(txns)
 	report.Summary.TotalSettlements = len(setts)
 
+	// A group is counted with its first result.
+	countedGroups := make(map[string]bool, len(report.MatchGroups))
 	for _, res := range results {
-		addToSummary(&report.Summary, res)
+		newGroup := res.MatchGroup != "" && !countedGroups[res.MatchGroup]
+		countedGroups[res.MatchGroup] = true
+		add := func(s *models.ReportSummary) {
+			addToSummary(s, res)
+			if newGroup {
+				addGroupToSummary(s, res.MatchGroup)
+			}
+		}
+
+		add(&report.Summary)
 
 		if res.Currency != "" {
 			s := report.ByCurrency[res.Currency]
-			addToSummary(&s, res)
+			add(&s)
 			report.ByCurrency[res.Currency] = s
 		}
 		if res.Country != "" {
 			s := report.ByCountry[res.Country]
-			addToSummary(&s, res)
+			add(&s)
 			report.ByCountry[res.Country] = s
 		}
 		if res.ProcessorName != "" {
 			s := report.ByProcessor[res.ProcessorName]
-			addToSummary(&s, res)
+			add(&s)
 			report.ByProcessor[res.ProcessorName] = s
 		}
-
-		// Flag high-priority discrepancies.
-		if res.Status != models.StatusMatched && math.Abs(res.VarianceAmount) >= r.config.HighPriorityThreshold {
+		rt := string(res.RecordType.Normalize())
+		byType := report.ByRecordType[rt]
+		add(&byType)
+		report.ByRecordType[rt] = byType
+
+		// Flag high-priority discrepancies. A failed transaction that settled always is one.
+		if res.Status == models.StatusFailedSettled ||
+			res.Status != models.StatusMatched && r.reportingVariance(res).Cmp(r.config.HighPriorityThreshold) >= 0 {
 			report.HighPriority = append(report.HighPriority, res)
 		}
-		if res.DaysToSettle != nil && *res.DaysToSettle > r.config.LateSettlementDays {
+		late := res.DaysToSettle != nil && *res.DaysToSettle > r.config.LateSettlementDays
+		stale := res.DaysOutstanding != nil && r.config.UnsettledPriorityDays > 0 && *res.DaysOutstanding > r.config.UnsettledPriorityDays
+		if late || stale {
 			// Only add if not already high-priority.
 			alreadyAdded := false
 			for _, hp := range report.HighPriority {
@@ -262,15 +656,21 @@ func (r *Reconciler) buildReport(runID string, txns []models.Transaction, setts
 	}
 
 	// Compute reconciliation rate.
-	total := report.Summary.Matched + report.Summary.MatchedWithVariance +
-		report.Summary.Unsettled + report.Summary.UnexpectedSettlements + report.Summary.Duplicates
-	if total > 0 {
-		report.Summary.ReconciliationRate = float64(report.Summary.Matched+report.Summary.MatchedWithVariance) / float64(total) * 100
+	report.Summary.ReconciliationRate = reconciliationRate(report.Summary)
+
+	// Convert the totals to the reporting currency, and rate each breakdown.
+	r.setReportingTotals(&report.Summary)
+	for _, breakdown := range []map[string]models.ReportSummary{report.ByCurrency, report.ByCountry, report.ByProcessor, report.ByRecordType} {
+		for k, s := range breakdown {
+			r.setReportingTotals(&s)
+			s.ReconciliationRate = reconciliationRate(s)
+			breakdown[k] = s
+		}
 	}
 
-	// Sort high-priority by absolute variance descending.
-	sort.Slice(report.HighPriority, func(i, j int) bool {
-		return math.Abs(report.HighPriority[i].VarianceAmount) > math.Abs(report.HighPriority[j].VarianceAmount)
+	// Sort high-priority by absolute variance in the reporting currency, descending.
+	sort.SliceStable(report.HighPriority, func(i, j int) bool {
+		return r.reportingVariance(report.HighPriority[i]).Cmp(r.reportingVariance(report.HighPriority[j])) > 0
 	})
 
 	return report
@@ -288,50 +688,107 @@ func addToSummary(s *models.ReportSummary, res models.ReconciliationResult) {
 		s.UnexpectedSettlements++
 	case models.StatusDuplicate:
 		s.Duplicates++
+		switch res.DuplicateKind {
+		case models.DuplicateExactResend:
+			s.ExactResends++
+		case models.DuplicateContentMismatch:
+			s.ContentMismatches++
+		}
+	case models.StatusRefunded:
+		s.Refunded++
+	case models.StatusChargeback:
+		s.Chargebacks++
+	case models.StatusChargebackReversed:
+		s.ChargebackReversals++
+	case models.StatusAdjustment:
+		s.Adjustments++
+	case models.StatusUnlinked:
+		s.Unlinked++
+	case models.StatusMatchedFuzzy:
+		s.MatchedFuzzy++
+	case models.StatusNotCaptured:
+		s.NotCaptured++
+	case models.StatusFailed:
+		s.Failed++
+	case models.StatusFailedSettled:
+		s.FailedSettled++
+	}
+	addAging(&s.UnsettledAging, res.AgingBucket)
+	addNativeTotals(s, res)
+	if res.FeeOvercharge != nil {
+		s.FeeOvercharges++
 	}
-	s.TotalExpectedAmount += res.ExpectedAmount
-	s.TotalSettledGross += res.SettledGrossAmount
-	s.TotalSettledNet += res.SettledNetAmount
-	s.TotalVarianceAmount += res.VarianceAmount
-	s.TotalFees += res.FeeAmount
 }
 
-// convertAmount applies FX conversion if the currencies differ.
-func (r *Reconciler) convertAmount(amount float64, from, to string) float64 {
-	if from == to {
-		return amount
+// reconciliationRate is the percentage of results that were matched to a
+// counterpart: matched sales (with or without variance, or fuzzily), and
+// refunds, chargebacks and reversals linked to their transaction. Failed and
+// never-captured transactions that did not settle are left out.
+func reconciliationRate(s models.ReportSummary) float64 {
+	reconciled := s.Matched + s.MatchedWithVariance + s.MatchedFuzzy + s.Refunded + s.Chargebacks + s.ChargebackReversals
+	total := reconciled + s.Unsettled + s.UnexpectedSettlements + s.Duplicates + s.Adjustments + s.Unlinked + s.FailedSettled
+	if total == 0 {
+		return 0
 	}
-	if rates, ok := r.config.FXRates[from]; ok {
-		if rate, ok := rates[to]; ok {
-			return amount * rate
-		}
-	}
-	// If no rate found, try via USD as intermediate.
-	if fromUSD, ok := r.config.FXRates[from]; ok {
-		if toUSD, ok := r.config.FXRates[to]; ok {
-			if rateFromToUSD, ok := fromUSD["USD"]; ok {
-				if rateToToUSD, ok := toUSD["USD"]; ok {
-					return amount * rateFromToUSD / rateToToUSD
-				}
-			}
-		}
-	}
-	return amount // fallback: no conversion
+	return float64(reconciled) / float64(total) * 100
 }
 
 func processorKey(processorName, processorTxnID string) string {
 	return fmt.Sprintf("%s:%s", processorName, processorTxnID)
 }
 
-// findTransaction tries primary match on processor key, then fallback on order reference.
-func findTransaction(pk, orderRef string, byPK map[string]models.Transaction, byOrder map[string]models.Transaction) (models.Transaction, bool) {
-	if txn, ok := byPK[pk]; ok {
+// txnIndex looks transactions up by processor key and by order ID, per record type.
+// References are normalized before they are keyed or looked up.
+type txnIndex struct {
+	byProcessorKey map[string]models.Transaction
+	byOrderID      map[string]models.Transaction
+	norm           normalizer
+}
+
+func newTxnIndex(txns []models.Transaction, norm normalizer) *txnIndex {
+	idx := &txnIndex{
+		byProcessorKey: make(map[string]models.Transaction, len(txns)),
+		byOrderID:      make(map[string]models.Transaction, len(txns)),
+		norm:           norm,
+	}
+	for _, t := range txns {
+		idx.byProcessorKey[typedKey(t.RecordType, processorKey(t.ProcessorName, norm.txnID(t.ProcessorName, t.ProcessorTxnID)))] = t
+		idx.byOrderID[typedKey(t.RecordType, norm.orderRef(t.ProcessorName, t.OrderID))] = t
+	}
+	return idx
+}
+
+// settlementKey is the normalized, typed processor key of a settlement record.
+func (idx *txnIndex) settlementKey(s models.SettlementRecord) string {
+	return typedKey(s.RecordType, processorKey(s.ProcessorName, idx.norm.txnID(s.ProcessorName, s.ProcessorTxnID)))
+}
+
+// find tries primary match on processor key, then fallback on order reference,
+// among transactions of record type rt.
+func (idx *txnIndex) find(rt models.RecordType, processor, processorTxnID, orderRef string) (models.Transaction, bool) {
+	if txn, ok := idx.byProcessorKey[typedKey(rt, processorKey(processor, idx.norm.txnID(processor, processorTxnID)))]; ok {
 		return txn, true
 	}
 	if orderRef != "" {
-		if txn, ok := byOrder[orderRef]; ok {
+		if txn, ok := idx.byOrderID[typedKey(rt, idx.norm.orderRef(processor, orderRef))]; ok {
 			return txn, true
 		}
 	}
 	return models.Transaction{}, false
 }
+
+// sale finds the sale a refund, chargeback or reversal line refers to.
+func (idx *txnIndex) sale(processor, originalProcessorTxnID, orderRef string) (models.Transaction, bool) {
+	if originalProcessorTxnID == "" && orderRef == "" {
+		return models.Transaction{}, false
+	}
+	return idx.find(models.RecordSale, processor, originalProcessorTxnID, orderRef)
+}
+
+// typedKey scopes a lookup key to a record type. Sales keep the bare key.
+func typedKey(rt models.RecordType, key string) string {
+	if rt = rt.Normalize(); rt == models.RecordSale {
+		return key
+	}
+	return string(rt) + "|" + key
+}
@@ -1,10 +1,17 @@
 package reconciler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
 	"github.com/denys-rosario/settlement-reconciler/internal/store"
 )
 
@@ -12,6 +19,15 @@ func baseTime() time.Time {
 	return time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
 }
 
+func run(t *testing.T, r *Reconciler, runID string) *models.ReconciliationReport {
+	t.Helper()
+	report, err := r.Run(runID)
+	if err != nil {
+		t.Fatalf("Run(%s): %v", runID, err)
+	}
+	return report
+}
+
 func TestPerfectMatch(t *testing.T) {
 	s := store.New()
 	cfg := models.DefaultConfig()
@@ -23,16 +39,16 @@ func TestPerfectMatch(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 100.00, Currency: "MXN",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("100.00"), Currency: "MXN",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt,
 	}})
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "PaySureMX", ProcessorTxnID: "PSM-001",
-		OrderReference: "ORD-001", GrossAmount: 100.00, FeeAmount: 0,
-		NetAmount: 100.00, Currency: "MXN", SettledAt: settleAt,
+		OrderReference: "ORD-001", GrossAmount: money.MustParse("100.00"), FeeAmount: money.MustParse("0"),
+		NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-001")
+	report := run(t, r, "TEST-001")
 
 	if report.Summary.Matched != 1 {
 		t.Errorf("expected 1 matched, got %d", report.Summary.Matched)
@@ -43,8 +59,8 @@ func TestPerfectMatch(t *testing.T) {
 	if report.Results[0].Status != models.StatusMatched {
 		t.Errorf("expected status matched, got %s", report.Results[0].Status)
 	}
-	if report.Results[0].VarianceAmount != 0 {
-		t.Errorf("expected 0 variance, got %f", report.Results[0].VarianceAmount)
+	if !report.Results[0].VarianceAmount.IsZero() {
+		t.Errorf("expected 0 variance, got %s", report.Results[0].VarianceAmount)
 	}
 }
 
@@ -59,22 +75,22 @@ func TestMatchedWithVariance(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 100.00, Currency: "MXN",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("100.00"), Currency: "MXN",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt,
 	}})
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "PaySureMX", ProcessorTxnID: "PSM-001",
-		OrderReference: "ORD-001", GrossAmount: 85.00, FeeAmount: 3.00,
-		NetAmount: 82.00, Currency: "MXN", SettledAt: settleAt,
+		OrderReference: "ORD-001", GrossAmount: money.MustParse("85.00"), FeeAmount: money.MustParse("3.00"),
+		NetAmount: money.MustParse("82.00"), Currency: "MXN", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-002")
+	report := run(t, r, "TEST-002")
 
 	if report.Summary.MatchedWithVariance != 1 {
 		t.Errorf("expected 1 matched_with_variance, got %d", report.Summary.MatchedWithVariance)
 	}
-	if report.Results[0].VarianceAmount != -15.00 {
-		t.Errorf("expected -15.00 variance, got %f", report.Results[0].VarianceAmount)
+	if report.Results[0].VarianceAmount != money.MustParse("-15.00") {
+		t.Errorf("expected -15.00 variance, got %s", report.Results[0].VarianceAmount)
 	}
 }
 
@@ -90,17 +106,17 @@ func TestVarianceTolerance(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 100.00, Currency: "MXN",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("100.00"), Currency: "MXN",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt,
 	}})
 	// 1.5% variance — should be within 2% tolerance → matched
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "PaySureMX", ProcessorTxnID: "PSM-001",
-		OrderReference: "ORD-001", GrossAmount: 98.50, FeeAmount: 0,
-		NetAmount: 98.50, Currency: "MXN", SettledAt: settleAt,
+		OrderReference: "ORD-001", GrossAmount: money.MustParse("98.50"), FeeAmount: money.MustParse("0"),
+		NetAmount: money.MustParse("98.50"), Currency: "MXN", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-003")
+	report := run(t, r, "TEST-003")
 
 	if report.Summary.Matched != 1 {
 		t.Errorf("expected 1 matched (within tolerance), got %d matched, %d variance",
@@ -117,12 +133,12 @@ func TestUnsettled(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 250.00, Currency: "BRL",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("250.00"), Currency: "BRL",
 		Country: "BR", Status: "captured", AuthorizedAt: authAt,
 	}})
 	// No settlements added.
 
-	report := r.Run("TEST-004")
+	report := run(t, r, "TEST-004")
 
 	if report.Summary.Unsettled != 1 {
 		t.Errorf("expected 1 unsettled, got %d", report.Summary.Unsettled)
@@ -142,11 +158,11 @@ func TestUnexpectedSettlement(t *testing.T) {
 	// No transactions added.
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "GlobalTransact", ProcessorTxnID: "GT-UNKNOWN-001",
-		OrderReference: "EXT-ORD-001", GrossAmount: 500.00, FeeAmount: 12.50,
-		NetAmount: 487.50, Currency: "COP", SettledAt: settleAt,
+		OrderReference: "EXT-ORD-001", GrossAmount: money.MustParse("500.00"), FeeAmount: money.MustParse("12.50"),
+		NetAmount: money.MustParse("487.50"), Currency: "COP", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-005")
+	report := run(t, r, "TEST-005")
 
 	if report.Summary.UnexpectedSettlements != 1 {
 		t.Errorf("expected 1 unexpected settlement, got %d", report.Summary.UnexpectedSettlements)
@@ -165,29 +181,89 @@ func TestDuplicateSettlement(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "LatamPay",
-		ProcessorTxnID: "LP-001", Amount: 300.00, Currency: "USD",
+		ProcessorTxnID: "LP-001", Amount: money.MustParse("300.00"), Currency: "USD",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt,
 	}})
 	s.AddSettlements([]models.SettlementRecord{
 		{
 			ID: "STL-001", ProcessorName: "LatamPay", ProcessorTxnID: "LP-001",
-			OrderReference: "ORD-001", GrossAmount: 300.00, FeeAmount: 0,
-			NetAmount: 300.00, Currency: "USD", SettledAt: settleAt1,
+			OrderReference: "ORD-001", GrossAmount: money.MustParse("300.00"), FeeAmount: money.MustParse("0"),
+			NetAmount: money.MustParse("300.00"), Currency: "USD", SettledAt: settleAt1,
 		},
 		{
 			ID: "STL-002", ProcessorName: "LatamPay", ProcessorTxnID: "LP-001",
-			OrderReference: "ORD-001", GrossAmount: 300.00, FeeAmount: 0,
-			NetAmount: 300.00, Currency: "USD", SettledAt: settleAt2,
+			OrderReference: "ORD-001", GrossAmount: money.MustParse("300.00"), FeeAmount: money.MustParse("0"),
+			NetAmount: money.MustParse("300.00"), Currency: "USD", SettledAt: settleAt2,
 		},
 	})
 
-	report := r.Run("TEST-006")
+	report := run(t, r, "TEST-006")
 
 	if report.Summary.Duplicates != 2 {
 		t.Errorf("expected 2 duplicate entries, got %d", report.Summary.Duplicates)
 	}
 }
 
+func TestDuplicateClassification(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	day1, day2 := authAt.Add(24*time.Hour), authAt.Add(48*time.Hour)
+	txn := func(id, ptid, amount string) models.Transaction {
+		return models.Transaction{ID: id, OrderID: "ORD-" + id, ProcessorName: "P1", ProcessorTxnID: ptid, Amount: money.MustParse(amount), Currency: "MXN", AuthorizedAt: authAt}
+	}
+	line := func(id, ptid, amount string, at time.Time, batch string) models.SettlementRecord {
+		return models.SettlementRecord{ID: id, ProcessorName: "P1", ProcessorTxnID: ptid, GrossAmount: money.MustParse(amount), NetAmount: money.MustParse(amount), Currency: "MXN", SettledAt: at, SettlementBatchID: batch}
+	}
+	s.AddTransactions([]models.Transaction{
+		txn("T1", "PT1", "100.00"), txn("T2", "PT2", "200.00"), txn("T3", "PT3", "50.00"),
+		txn("T4", "PT4", "70.00"), txn("T5", "PT5", "100.00"),
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		// Batch B1 delivered twice in full.
+		line("S01", "PT1", "100.00", day1, "B1"), line("S02", "PT2", "200.00", day1, "B1"),
+		line("S03", "PT1", "100.00", day1, "B1"), line("S04", "PT2", "200.00", day1, "B1"),
+		// Only one line of batch B2 delivered again.
+		line("S05", "PT3", "50.00", day1, "B2"), line("S06", "PT4", "70.00", day1, "B2"),
+		line("S07", "PT3", "50.00", day1, "B2"),
+		// Same key, different content.
+		line("S08", "PT5", "100.00", day1, "B4"), line("S09", "PT5", "120.00", day2, "B4"),
+		// Resent line for an unknown transaction.
+		line("S10", "PT9", "30.00", day2, "B3"), line("S11", "PT9", "30.00", day2, "B3"),
+	})
+
+	report := run(t, r, "TEST-DUPS")
+
+	if report.Summary.Duplicates != 10 || report.Summary.ExactResends != 8 || report.Summary.ContentMismatches != 2 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	for _, res := range report.Results {
+		if res.SettlementID == "S03" && (res.DuplicateKind != models.DuplicateExactResend || res.DuplicateOf != "S01") {
+			t.Errorf("expected S03 to be an exact resend of S01, got %+v", res)
+		}
+		if res.SettlementID == "S09" && (res.DuplicateKind != models.DuplicateContentMismatch || res.DuplicateOf != "") {
+			t.Errorf("expected S09 to be a content mismatch, got %+v", res)
+		}
+	}
+
+	want := []models.RedeliveredBatch{
+		{ProcessorName: "P1", BatchID: "B1", ResentSettlements: 2, ResentAmount: money.MustParse("300.00"), Currency: "MXN", Complete: true},
+		{ProcessorName: "P1", BatchID: "B2", ResentSettlements: 1, ResentAmount: money.MustParse("50.00"), Currency: "MXN", Complete: false},
+		{ProcessorName: "P1", BatchID: "B3", ResentSettlements: 1, ResentAmount: money.MustParse("30.00"), Currency: "MXN", Complete: true},
+	}
+	if got := report.DuplicateAnalysis.RedeliveredBatches; !slices.Equal(got, want) {
+		t.Errorf("redelivered batches:\n got %+v\nwant %+v", got, want)
+	}
+	// 100 + 200 + 50 paid twice, 120 paid on top of T5's 100, and 30 for an unknown transaction.
+	wantOver := []models.ProcessorOverpayment{{ProcessorName: "P1", Currency: "MXN", Amount: money.MustParse("500.00"), DuplicateSettlements: 5}}
+	if got := report.DuplicateAnalysis.OverpaidByProcessor; !slices.Equal(got, wantOver) {
+		t.Errorf("overpaid: got %+v, want %+v", got, wantOver)
+	}
+}
+
 func TestLateSettlementFlagging(t *testing.T) {
 	s := store.New()
 	cfg := models.DefaultConfig()
@@ -200,16 +276,16 @@ func TestLateSettlementFlagging(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 100.00, Currency: "MXN",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("100.00"), Currency: "MXN",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt,
 	}})
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "PaySureMX", ProcessorTxnID: "PSM-001",
-		OrderReference: "ORD-001", GrossAmount: 100.00, FeeAmount: 0,
-		NetAmount: 100.00, Currency: "MXN", SettledAt: settleAt,
+		OrderReference: "ORD-001", GrossAmount: money.MustParse("100.00"), FeeAmount: money.MustParse("0"),
+		NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-007")
+	report := run(t, r, "TEST-007")
 
 	if len(report.HighPriority) == 0 {
 		t.Error("expected late settlement to be flagged as high priority")
@@ -229,17 +305,17 @@ func TestFallbackMatchByOrderID(t *testing.T) {
 
 	s.AddTransactions([]models.Transaction{{
 		ID: "TXN-001", OrderID: "ORD-001", ProcessorName: "PaySureMX",
-		ProcessorTxnID: "PSM-001", Amount: 100.00, Currency: "MXN",
+		ProcessorTxnID: "PSM-001", Amount: money.MustParse("100.00"), Currency: "MXN",
 		Country: "MX", Status: "captured", AuthorizedAt: authAt,
 	}})
 	// Different processor txn ID but same order reference → should still match
 	s.AddSettlements([]models.SettlementRecord{{
 		ID: "STL-001", ProcessorName: "PaySureMX", ProcessorTxnID: "PSM-DIFFERENT",
-		OrderReference: "ORD-001", GrossAmount: 100.00, FeeAmount: 0,
-		NetAmount: 100.00, Currency: "MXN", SettledAt: settleAt,
+		OrderReference: "ORD-001", GrossAmount: money.MustParse("100.00"), FeeAmount: money.MustParse("0"),
+		NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: settleAt,
 	}})
 
-	report := r.Run("TEST-008")
+	report := run(t, r, "TEST-008")
 
 	if report.Summary.Matched != 1 {
 		t.Errorf("expected fallback match, got matched=%d, unexpected=%d",
@@ -262,27 +338,27 @@ func TestFullDatasetReconciliation(t *testing.T) {
 
 	// 3 matched, 1 variance, 1 unsettled, 1 unexpected, 1 duplicate pair
 	txns := []models.Transaction{
-		{ID: "T1", OrderID: "O1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: 100, Currency: "USD", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
-		{ID: "T2", OrderID: "O2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: 200, Currency: "MXN", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
-		{ID: "T3", OrderID: "O3", ProcessorName: "P2", ProcessorTxnID: "PT3", Amount: 300, Currency: "BRL", Country: "BR", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
-		{ID: "T4", OrderID: "O4", ProcessorName: "P2", ProcessorTxnID: "PT4", Amount: 400, Currency: "COP", Country: "CO", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
-		{ID: "T5", OrderID: "O5", ProcessorName: "P1", ProcessorTxnID: "PT5", Amount: 500, Currency: "USD", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
+		{ID: "T1", OrderID: "O1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100"), Currency: "USD", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
+		{ID: "T2", OrderID: "O2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("200"), Currency: "MXN", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
+		{ID: "T3", OrderID: "O3", ProcessorName: "P2", ProcessorTxnID: "PT3", Amount: money.MustParse("300"), Currency: "BRL", Country: "BR", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
+		{ID: "T4", OrderID: "O4", ProcessorName: "P2", ProcessorTxnID: "PT4", Amount: money.MustParse("400"), Currency: "COP", Country: "CO", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
+		{ID: "T5", OrderID: "O5", ProcessorName: "P1", ProcessorTxnID: "PT5", Amount: money.MustParse("500"), Currency: "USD", Country: "MX", Status: "captured", AuthorizedAt: authAt, CapturedAt: &captureAt},
 	}
 	setts := []models.SettlementRecord{
-		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", OrderReference: "O1", GrossAmount: 100, NetAmount: 100, Currency: "USD", SettledAt: settleAt},
-		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", OrderReference: "O2", GrossAmount: 200, NetAmount: 200, Currency: "MXN", SettledAt: settleAt},
-		{ID: "S3", ProcessorName: "P2", ProcessorTxnID: "PT3", OrderReference: "O3", GrossAmount: 300, NetAmount: 300, Currency: "BRL", SettledAt: settleAt},
-		{ID: "S4", ProcessorName: "P2", ProcessorTxnID: "PT4", OrderReference: "O4", GrossAmount: 350, FeeAmount: 10, NetAmount: 340, Currency: "COP", SettledAt: settleAt}, // variance
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", OrderReference: "O1", GrossAmount: money.MustParse("100"), NetAmount: money.MustParse("100"), Currency: "USD", SettledAt: settleAt},
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", OrderReference: "O2", GrossAmount: money.MustParse("200"), NetAmount: money.MustParse("200"), Currency: "MXN", SettledAt: settleAt},
+		{ID: "S3", ProcessorName: "P2", ProcessorTxnID: "PT3", OrderReference: "O3", GrossAmount: money.MustParse("300"), NetAmount: money.MustParse("300"), Currency: "BRL", SettledAt: settleAt},
+		{ID: "S4", ProcessorName: "P2", ProcessorTxnID: "PT4", OrderReference: "O4", GrossAmount: money.MustParse("350"), FeeAmount: money.MustParse("10"), NetAmount: money.MustParse("340"), Currency: "COP", SettledAt: settleAt}, // variance
 		// T5 has no settlement (unsettled)
-		{ID: "S6", ProcessorName: "P3", ProcessorTxnID: "PT-X", OrderReference: "O-X", GrossAmount: 999, NetAmount: 999, Currency: "USD", SettledAt: settleAt}, // unexpected
+		{ID: "S6", ProcessorName: "P3", ProcessorTxnID: "PT-X", OrderReference: "O-X", GrossAmount: money.MustParse("999"), NetAmount: money.MustParse("999"), Currency: "USD", SettledAt: settleAt}, // unexpected
 		// Duplicate for T1
-		{ID: "S7", ProcessorName: "P1", ProcessorTxnID: "PT1", OrderReference: "O1", GrossAmount: 100, NetAmount: 100, Currency: "USD", SettledAt: settleAt},
+		{ID: "S7", ProcessorName: "P1", ProcessorTxnID: "PT1", OrderReference: "O1", GrossAmount: money.MustParse("100"), NetAmount: money.MustParse("100"), Currency: "USD", SettledAt: settleAt},
 	}
 
 	s.AddTransactions(txns)
 	s.AddSettlements(setts)
 
-	report := r.Run("FULL-TEST")
+	report := run(t, r, "FULL-TEST")
 
 	// T1 is part of a duplicate pair (S1 + S7 → 2 duplicates)
 	// T2, T3 → matched
@@ -314,3 +390,927 @@ func TestFullDatasetReconciliation(t *testing.T) {
 		t.Error("expected processor breakdown")
 	}
 }
+
+func TestReportTotalsAreExact(t *testing.T) {
+	s := store.New()
+	r := New(s, models.DefaultConfig())
+
+	authAt := baseTime()
+	settleAt := authAt.Add(48 * time.Hour)
+
+	// 1,000 settlements of 0.10 COP each: float64 totals would drift off 100.00.
+	var txns []models.Transaction
+	var setts []models.SettlementRecord
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("%04d", i)
+		txns = append(txns, models.Transaction{
+			ID: "T" + id, OrderID: "O" + id, ProcessorName: "AndesPago", ProcessorTxnID: "AP" + id,
+			Amount: money.MustParse("0.10"), Currency: "COP", Country: "CO", Status: "captured", AuthorizedAt: authAt,
+		})
+		setts = append(setts, models.SettlementRecord{
+			ID: "S" + id, ProcessorName: "AndesPago", ProcessorTxnID: "AP" + id, OrderReference: "O" + id,
+			GrossAmount: money.MustParse("0.10"), NetAmount: money.MustParse("0.10"), Currency: "COP", SettledAt: settleAt,
+		})
+	}
+	s.AddTransactions(txns)
+	s.AddSettlements(setts)
+
+	report := run(t, r, "TEST-EXACT")
+
+	if report.Summary.Matched != 1000 {
+		t.Fatalf("expected 1000 matched, got %d", report.Summary.Matched)
+	}
+	if got := report.Summary.NativeTotals["COP"].SettledGross; got != money.MustParse("100.00") {
+		t.Errorf("expected total settled gross 100.00, got %s", got)
+	}
+	if got := report.ByCurrency["COP"].NativeTotals["COP"].ExpectedAmount; got != money.MustParse("100.00") {
+		t.Errorf("expected COP expected total 100.00, got %s", got)
+	}
+}
+
+func TestRefundsChargebacksAndAdjustments(t *testing.T) {
+	s := store.New()
+	r := New(s, models.DefaultConfig())
+
+	authAt := baseTime()
+	settleAt := authAt.Add(48 * time.Hour)
+	sale := func(id, ptx, order, amount string) models.Transaction {
+		return models.Transaction{
+			ID: id, OrderID: order, ProcessorName: "PaySureMX", ProcessorTxnID: ptx,
+			Amount: money.MustParse(amount), Currency: "MXN", Country: "MX", Status: "captured", AuthorizedAt: authAt,
+		}
+	}
+	line := func(id, ptx, rt, original, gross string) models.SettlementRecord {
+		return models.SettlementRecord{
+			ID: id, ProcessorName: "PaySureMX", ProcessorTxnID: ptx, RecordType: models.RecordType(rt),
+			OriginalProcessorTxnID: original, GrossAmount: money.MustParse(gross), NetAmount: money.MustParse(gross),
+			Currency: "MXN", SettledAt: settleAt,
+		}
+	}
+
+	refund := sale("TXN-RF1", "PSM-RF1", "ORD-001", "40.00")
+	refund.RecordType = models.RecordRefund
+	refund.OriginalTransactionID = "TXN-001"
+	s.AddTransactions([]models.Transaction{
+		sale("TXN-001", "PSM-001", "ORD-001", "100.00"),
+		refund,
+		sale("TXN-002", "PSM-002", "ORD-002", "250.00"),
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		line("STL-001", "PSM-001", "", "", "100.00"),
+		line("STL-002", "PSM-RF1", "refund", "PSM-001", "40.00"),       // positive in file, settles as -40
+		line("STL-003", "PSM-CB2", "chargeback", "PSM-002", "-250.00"), // linked to the sale
+		line("STL-004", "PSM-CBR2", "chargeback_reversal", "PSM-002", "250.00"),
+		line("STL-005", "PSM-RF9", "refund", "PSM-999", "-10.00"), // unknown original
+		line("STL-006", "ADJ-1", "adjustment", "", "-5.00"),
+		line("STL-007", "PSM-002", "", "", "250.00"),
+	})
+
+	report := run(t, r, "TEST-TYPES")
+
+	byID := make(map[string]models.ReconciliationResult)
+	for _, res := range report.Results {
+		if res.SettlementID != "" {
+			byID[res.SettlementID] = res
+		}
+	}
+	want := map[string]models.ReconciliationStatus{
+		"STL-001": models.StatusMatched,
+		"STL-002": models.StatusRefunded,
+		"STL-003": models.StatusChargeback,
+		"STL-004": models.StatusChargebackReversed,
+		"STL-005": models.StatusUnlinked,
+		"STL-006": models.StatusAdjustment,
+		"STL-007": models.StatusMatched,
+	}
+	for id, status := range want {
+		if got := byID[id].Status; got != status {
+			t.Errorf("%s: expected status %s, got %s (%s)", id, status, got, byID[id].Notes)
+		}
+	}
+	if res := byID["STL-002"]; res.TransactionID != "TXN-RF1" || res.OriginalTransactionID != "TXN-001" || res.SettledGrossAmount != money.MustParse("-40") {
+		t.Errorf("refund not linked as expected: %+v", res)
+	}
+	if res := byID["STL-003"]; res.TransactionID != "" || res.OriginalTransactionID != "TXN-002" || res.ExpectedAmount != money.MustParse("-250") {
+		t.Errorf("chargeback not linked as expected: %+v", res)
+	}
+	if report.Summary.Unsettled != 0 || report.Summary.MatchedWithVariance != 0 {
+		t.Errorf("expected no unsettled or variance results, got %+v", report.Summary)
+	}
+	if got := report.ByRecordType["refund"]; got.Refunded != 1 || got.Unlinked != 1 {
+		t.Errorf("unexpected refund breakdown: %+v", got)
+	}
+	if got := report.ByRecordType["sale"].Matched; got != 2 {
+		t.Errorf("expected 2 matched sales, got %d", got)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("120.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("120.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P1", ProcessorTxnID: "PT3", Amount: money.MustParse("75.00"), Currency: "MXN", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		// Mangled references; T1 and T2 fit equally well, so the first by ID is taken.
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "pt-1?", OrderReference: "ord1", GrossAmount: money.MustParse("120.00"), NetAmount: money.MustParse("120.00"), Currency: "MXN", SettledAt: authAt.Add(25 * time.Hour)},
+		// Same amount as T3 but outside the 3-day window.
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnID: "???", GrossAmount: money.MustParse("75.00"), NetAmount: money.MustParse("75.00"), Currency: "MXN", SettledAt: authAt.Add(5 * 24 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-FUZZY")
+
+	if report.Summary.MatchedFuzzy != 1 || report.Summary.Unsettled != 2 || report.Summary.UnexpectedSettlements != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	for _, res := range report.Results {
+		if res.Status != models.StatusMatchedFuzzy {
+			continue
+		}
+		if res.SettlementID != "S1" || res.TransactionID != "T1" {
+			t.Errorf("expected S1 paired with T1, got %s with %s", res.SettlementID, res.TransactionID)
+		}
+		// amount 1.0*0.5 + date (1 - 1/4)*0.3 + currency 0.2 = 0.925 → 0.93
+		if res.MatchConfidence == nil || *res.MatchConfidence != 0.93 {
+			t.Errorf("unexpected confidence: %v", res.MatchConfidence)
+		}
+	}
+
+	cfg.FuzzyMatch.Enabled = false
+	report = run(t, New(s, cfg), "TEST-FUZZY-OFF")
+	if report.Summary.MatchedFuzzy != 0 || report.Summary.UnexpectedSettlements != 2 {
+		t.Errorf("expected no fuzzy matches when disabled, got %+v", report.Summary)
+	}
+}
+
+func TestSplitSettlement(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("300.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("50.00"), Currency: "MXN", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		// Three installments of T1, the second one delivered twice.
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("97.00"), FeeAmount: money.MustParse("3.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("97.00"), FeeAmount: money.MustParse("3.00"), Currency: "MXN", SettledAt: authAt.Add(31 * 24 * time.Hour)},
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("97.00"), FeeAmount: money.MustParse("3.00"), Currency: "MXN", SettledAt: authAt.Add(31 * 24 * time.Hour)},
+		{ID: "S4", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("97.00"), FeeAmount: money.MustParse("3.00"), Currency: "MXN", SettledAt: authAt.Add(61 * 24 * time.Hour)},
+		// Two full settlements of T2 on different days do not add up: duplicates.
+		{ID: "S5", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("50.00"), NetAmount: money.MustParse("50.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S6", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("50.00"), NetAmount: money.MustParse("50.00"), Currency: "MXN", SettledAt: authAt.Add(48 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-SPLIT")
+
+	if report.Summary.Matched != 3 || report.Summary.Duplicates != 3 || report.Summary.SplitGroups != 1 || report.Summary.Unsettled != 0 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	if len(report.MatchGroups) != 1 {
+		t.Fatalf("expected 1 match group, got %d", len(report.MatchGroups))
+	}
+	g := report.MatchGroups[0]
+	if g.ID != "split:T1" || g.Type != models.GroupSplit || g.Status != models.StatusMatched ||
+		!slices.Equal(g.TransactionIDs, []string{"T1"}) || !slices.Equal(g.SettlementIDs, []string{"S1", "S2", "S4"}) ||
+		g.ExpectedAmount != money.MustParse("300.00") || g.SettledGrossAmount != money.MustParse("300.00") || !g.VarianceAmount.IsZero() {
+		t.Errorf("unexpected group: %+v", g)
+	}
+	for _, res := range report.Results {
+		if res.SettlementID == "S3" && (res.Status != models.StatusDuplicate || res.MatchGroup != "" || res.DuplicateOf != "S2") {
+			t.Errorf("expected the resent installment S3 to be a duplicate, got %+v", res)
+		}
+	}
+}
+
+func TestAggregatedSettlement(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "MXN", Country: "MX", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("250.00"), Currency: "MXN", Country: "MX", AuthorizedAt: authAt},
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P1", ProcessorTxnID: "PT3", Amount: money.MustParse("40.00"), Currency: "MXN", Country: "MX", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnIDs: []string{"PT1", "PT2"}, GrossAmount: money.MustParse("350.00"), FeeAmount: money.MustParse("10.50"), NetAmount: money.MustParse("339.50"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		// Short by 5.00 and lists a reference nobody knows.
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnIDs: []string{"PT3", "PT9"}, GrossAmount: money.MustParse("35.00"), NetAmount: money.MustParse("35.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-AGG")
+
+	if report.Summary.Matched != 2 || report.Summary.MatchedWithVariance != 1 || report.Summary.AggregatedGroups != 2 || report.Summary.Unsettled != 0 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	// Line totals are preserved across the group's results.
+	mxn := report.Summary.NativeTotals["MXN"]
+	if mxn.SettledGross != money.MustParse("385.00") || mxn.Fees != money.MustParse("10.50") ||
+		mxn.SettledNet != money.MustParse("374.50") || mxn.VarianceAmount != money.MustParse("-5.00") {
+		t.Errorf("unexpected totals: %+v", mxn)
+	}
+	if got := report.ByCountry["MX"].AggregatedGroups; got != 2 {
+		t.Errorf("expected 2 aggregated groups for MX, got %d", got)
+	}
+	g := report.MatchGroups[0]
+	if g.ID != "aggregate:S1" || !slices.Equal(g.TransactionIDs, []string{"T1", "T2"}) || !slices.Equal(g.SettlementIDs, []string{"S1"}) {
+		t.Errorf("unexpected group: %+v", g)
+	}
+	last := report.Results[len(report.Results)-1]
+	if last.MatchGroup != "aggregate:S2" || last.VarianceAmount != money.MustParse("-5.00") || !strings.Contains(last.Notes, "unknown references: PT9") {
+		t.Errorf("unexpected result for S2: %+v", last)
+	}
+}
+
+func TestAggregatedSettlementGroup(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	authAt := baseTime()
+	settledAt := authAt.Add(24 * time.Hour)
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "USD", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("50.00"), Currency: "USD", AuthorizedAt: authAt},
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P1", ProcessorTxnID: "PT3", Amount: money.MustParse("20.00"), Currency: "USD", AuthorizedAt: authAt},
+		{ID: "T4", OrderID: "ORD-4", ProcessorName: "P1", ProcessorTxnID: "PT4", Amount: money.MustParse("100.00"), Currency: "BRL", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("100.00"), Currency: "USD", SettledAt: settledAt},
+		// T1 settled on its own line above: only T2 is counted.
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnIDs: []string{"PT1", "PT2"}, GrossAmount: money.MustParse("50.00"), NetAmount: money.MustParse("50.00"), Currency: "USD", SettledAt: settledAt},
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnIDs: []string{"PT1", "PT2"}, GrossAmount: money.MustParse("150.00"), NetAmount: money.MustParse("150.00"), Currency: "USD", SettledAt: settledAt},
+		// The first transaction is in the line's currency, the second is not:
+		// the group is cross-currency, so the shortfall is not put down to the fee.
+		{ID: "S4", ProcessorName: "P1", ProcessorTxnIDs: []string{"PT3", "PT4"}, GrossAmount: money.MustParse("38.00"), FeeAmount: money.MustParse("2.00"), NetAmount: money.MustParse("36.00"), Currency: "USD", SettledAt: settledAt},
+	})
+	report := run(t, New(s, cfg), "TEST-AGG-GROUP")
+
+	bySettlement := make(map[string][]models.ReconciliationResult)
+	for _, res := range report.Results {
+		bySettlement[res.SettlementID] = append(bySettlement[res.SettlementID], res)
+	}
+	if rs := bySettlement["S2"]; len(rs) != 1 || rs[0].TransactionID != "T2" || rs[0].Status != models.StatusMatched ||
+		!strings.Contains(rs[0].Notes, "already settled, not counted: T1") {
+		t.Errorf("expected S2 to settle T2 only, got %+v", rs)
+	}
+	if rs := bySettlement["S3"]; len(rs) != 1 || rs[0].Status != models.StatusUnexpectedSettlement || rs[0].TransactionID != "" ||
+		!strings.Contains(rs[0].Notes, "lists only transactions already settled: T1, T2") {
+		t.Errorf("expected S3 to be unexpected, got %+v", rs)
+	}
+	if rs := bySettlement["S4"]; len(rs) != 2 || rs[1].Status != models.StatusMatchedWithVariance ||
+		!strings.Contains(rs[1].Notes, "Cross-currency: captured 20.00 USD + 100.00 BRL, settled 38.00 USD (expected ~40.00 USD after FX)") {
+		t.Errorf("expected S4 assessed as a cross-currency group, got %+v", rs)
+	}
+	if report.Summary.Unsettled != 0 {
+		t.Errorf("expected every transaction settled, got %+v", report.Summary)
+	}
+}
+
+func TestReferenceRulesNormalizeBothSides(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	cfg.ReferenceRules = map[string][]models.ReferenceRule{
+		"P1": {
+			{Type: models.RuleTrim},
+			{Type: models.RuleCaseFold},
+			{Type: models.RuleStripPrefix, Prefix: "p1-", Field: models.RefFieldProcessorTxnID},
+			{Type: models.RuleZeroPad, Width: 6, Field: models.RefFieldProcessorTxnID},
+		},
+	}
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "000042", Amount: money.MustParse("10.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "000043", Amount: money.MustParse("20.00"), Currency: "MXN", AuthorizedAt: authAt},
+		// Rules are per processor; P2 references are taken as they are.
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P2", ProcessorTxnID: "abc", Amount: money.MustParse("30.00"), Currency: "MXN", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: " P1-42 ", GrossAmount: money.MustParse("10.00"), NetAmount: money.MustParse("10.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		// Matched by order reference after case folding.
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "unknown", OrderReference: "ord-2", GrossAmount: money.MustParse("20.00"), NetAmount: money.MustParse("20.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S3", ProcessorName: "P2", ProcessorTxnID: "ABC", GrossAmount: money.MustParse("30.00"), NetAmount: money.MustParse("30.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+	})
+
+	report := run(t, New(s, cfg), "TEST-REFS")
+	if report.Summary.Matched != 2 || report.Summary.Unsettled != 1 || report.Summary.UnexpectedSettlements != 1 {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+
+	// Two spellings of the same reference are duplicates once normalized.
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S4", ProcessorName: "P1", ProcessorTxnID: "p1-000042", GrossAmount: money.MustParse("10.00"), NetAmount: money.MustParse("10.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+	})
+	report = run(t, New(s, cfg), "TEST-REFS-DUP")
+	if report.Summary.Duplicates != 2 {
+		t.Errorf("expected S1 and S4 to be duplicates, got %+v", report.Summary)
+	}
+
+	cfg.ReferenceRules["P1"] = []models.ReferenceRule{{Type: models.RuleRegexExtract, Pattern: "("}}
+	if _, err := New(s, cfg).Run("TEST-REFS-BAD"); err == nil {
+		t.Error("expected an error for an invalid rule")
+	}
+}
+
+func TestRunContextProgressAndCancel(t *testing.T) {
+	s := store.New()
+	r := New(s, models.DefaultConfig())
+	var txns []models.Transaction
+	for i := range 10 {
+		txns = append(txns, models.Transaction{
+			ID: fmt.Sprintf("TXN-%03d", i), OrderID: fmt.Sprintf("ORD-%03d", i), ProcessorName: "PaySureMX",
+			ProcessorTxnID: fmt.Sprintf("PSM-%03d", i), Amount: money.MustParse("10"), Currency: "MXN", AuthorizedAt: baseTime(),
+		})
+	}
+	s.AddTransactions(txns)
+
+	var seen []int
+	if _, err := r.RunContext(context.Background(), "TEST-PROGRESS", func(pct int) { seen = append(seen, pct) }); err != nil {
+		t.Fatalf("RunContext: %v", err)
+	}
+	if len(seen) == 0 || seen[0] != 0 || seen[len(seen)-1] != 100 {
+		t.Fatalf("expected progress from 0 to 100, got %v", seen)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] <= seen[i-1] {
+			t.Fatalf("progress not strictly increasing: %v", seen)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	report, err := r.RunContext(ctx, "TEST-CANCEL", func(pct int) {
+		if pct >= 50 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || report != nil {
+		t.Fatalf("expected context.Canceled and no report, got %v, %v", report, err)
+	}
+}
+
+func TestDatedFXRates(t *testing.T) {
+	authAt := baseTime()
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	setup := func(policy string) *Reconciler {
+		s := store.New()
+		cfg := models.DefaultConfig()
+		cfg.FuzzyMatch.Enabled = false
+		cfg.FXDatePolicy = policy
+		cfg.FXRates = map[string]map[string]float64{"BRL": {"USD": 0.20}}
+		s.AddTransactions([]models.Transaction{
+			{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "BRL", AuthorizedAt: authAt},
+			{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("100.00"), Currency: "BRL", AuthorizedAt: authAt.Add(-5 * 24 * time.Hour)},
+		})
+		s.AddSettlements([]models.SettlementRecord{
+			{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("18.00"), NetAmount: money.MustParse("18.00"), Currency: "USD", SettledAt: day(18).Add(9 * time.Hour)},
+			{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("20.00"), NetAmount: money.MustParse("20.00"), Currency: "USD", SettledAt: day(12)},
+		})
+		s.AddFXRates([]models.FXRate{
+			{From: "BRL", To: "USD", Date: day(17), Rate: 0.18},
+			{From: "BRL", To: "USD", Date: day(15), Rate: 0.16},
+		})
+		return New(s, cfg)
+	}
+	byTxn := func(report *models.ReconciliationReport) map[string]models.ReconciliationResult {
+		m := make(map[string]models.ReconciliationResult)
+		for _, res := range report.Results {
+			m[res.TransactionID] = res
+		}
+		return m
+	}
+
+	// Settled on the 18th: the nearest earlier rate, from the 17th, applies.
+	// T2 settled before any dated rate and falls back to the static rate.
+	results := byTxn(run(t, setup(models.FXDateSettlement), "TEST-FX-SETTLE"))
+	if res := results["T1"]; res.Status != models.StatusMatched || res.ExpectedAmount != money.MustParse("18.00") ||
+		res.FXRate == nil || *res.FXRate != 0.18 || res.FXRateDate == nil || !res.FXRateDate.Equal(day(17)) {
+		t.Errorf("expected T1 converted at the rate of the 17th, got %+v", res)
+	}
+	if res := results["T2"]; res.Status != models.StatusMatched || res.ExpectedAmount != money.MustParse("20.00") ||
+		res.FXRate == nil || *res.FXRate != 0.20 || res.FXRateDate != nil {
+		t.Errorf("expected T2 converted at the static rate, got %+v", res)
+	}
+
+	// Authorized on the 15th: that day's rate applies.
+	results = byTxn(run(t, setup(models.FXDateAuthorization), "TEST-FX-AUTH"))
+	if res := results["T1"]; res.Status != models.StatusMatchedWithVariance || res.ExpectedAmount != money.MustParse("16.00") ||
+		res.FXRate == nil || *res.FXRate != 0.16 || res.FXRateDate == nil || !res.FXRateDate.Equal(day(15)) {
+		t.Errorf("expected T1 converted at the rate of the 15th, got %+v", res)
+	}
+}
+
+func TestFXRateLookup(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	cfg := models.DefaultConfig()
+	cfg.FXRates = map[string]map[string]float64{"USD": {"CLP": 950}, "COP": {"USD": 0.00025}}
+	r := New(store.New(), cfg)
+	r.rates = newFXTable([]models.FXRate{
+		{From: "MXN", To: "USD", Date: day(10), Rate: 0.05},
+		{From: "USD", To: "JPY", Date: day(12), Rate: 150},
+		{From: "EUR", To: "USD", Date: day(11), Rate: 1.1},
+	})
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     float64
+		wantDate time.Time
+	}{
+		{"dated pair", "MXN", "USD", 0.05, day(10)},
+		{"inverse dated pair", "USD", "MXN", 20, day(10)},
+		{"via USD, inverse leg", "MXN", "JPY", 0.05 * 150, day(10)},
+		{"via USD, both legs dated", "EUR", "JPY", 1.1 * 150, day(11)},
+		{"static pair", "USD", "CLP", 950, time.Time{}},
+		{"inverse static pair", "CLP", "USD", 1.0 / 950, time.Time{}},
+		{"static via USD", "COP", "CLP", 0.00025 * 950, time.Time{}},
+	}
+	for _, tt := range tests {
+		q, ok := r.fxRate(tt.from, tt.to, day(15))
+		if !ok || math.Abs(q.rate-tt.want) > 1e-9 || !q.date.Equal(tt.wantDate) {
+			t.Errorf("%s: got %v (%v, %v), want %v on %v", tt.name, q.rate, ok, q.date, tt.want, tt.wantDate)
+		}
+	}
+	if q, ok := r.fxRate("JPY", "USD", day(11)); ok {
+		t.Errorf("expected no rate before the first dated one, got %v", q)
+	}
+	if _, err := r.convertAmount(money.MustParse("10"), "ARS", "USD", day(15)); err == nil || err.Error() != "no FX rate from ARS to USD for 2025-01-15" {
+		t.Errorf("expected a missing-rate error, got %v", err)
+	}
+}
+
+func TestMissingFXRateIsReported(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("10000"), Currency: "ARS", AuthorizedAt: baseTime()},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("10.00"), NetAmount: money.MustParse("10.00"), Currency: "USD", SettledAt: baseTime().Add(48 * time.Hour)},
+	})
+	report := run(t, New(s, cfg), "TEST-FX-MISSING")
+	res := report.Results[0]
+	if res.Status != models.StatusMatchedWithVariance || !res.ExpectedAmount.IsZero() || res.FXRate != nil ||
+		!strings.Contains(res.Notes, "Expected amount unknown: no FX rate from ARS to USD for 2025-01-17") {
+		t.Errorf("expected the missing rate to be reported, got %+v", res)
+	}
+}
+
+func TestVarianceBreakdown(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	settleAt := time.Date(2025, 1, 18, 9, 0, 0, 0, time.UTC)
+	hotel := money.MustParse("350.00")
+	captures := []models.Capture{
+		{Amount: money.MustParse("80.00"), CapturedAt: authAt.Add(time.Hour)},
+		{Amount: money.MustParse("20.00"), CapturedAt: settleAt.Add(24 * time.Hour)},
+	}
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Captures: captures, Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("100.00"), Currency: "BRL", AuthorizedAt: authAt},
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P1", ProcessorTxnID: "PT3", Amount: money.MustParse("100.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T4", OrderID: "ORD-4", ProcessorName: "P1", ProcessorTxnID: "PT4", Amount: money.MustParse("500.00"), CapturedAmount: &hotel, Currency: "MXN", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		// Covers the first capture of 80 but not the second, made the next day, and
+		// is reported net of a 2.00 fee.
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("78.00"), FeeAmount: money.MustParse("2.00"), NetAmount: money.MustParse("78.00"), Currency: "MXN", SettledAt: settleAt},
+		// Converted at the authorization-day rate (16.00), less a 0.30 fee and 0.20 unexplained.
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("15.50"), FeeAmount: money.MustParse("0.30"), NetAmount: money.MustParse("15.20"), Currency: "USD", SettledAt: settleAt},
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnID: "PT3", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: settleAt},
+		// Settles the 500 authorized although only 350 was captured, and 10 more.
+		{ID: "S4", ProcessorName: "P1", ProcessorTxnID: "PT4", GrossAmount: money.MustParse("510.00"), NetAmount: money.MustParse("510.00"), Currency: "MXN", SettledAt: settleAt},
+	})
+	s.AddFXRates([]models.FXRate{
+		{From: "BRL", To: "USD", Date: time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), Rate: 0.16},
+		{From: "BRL", To: "USD", Date: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC), Rate: 0.18},
+	})
+
+	report := run(t, r, "TEST-VARIANCE")
+
+	want := map[string]*models.VarianceBreakdown{
+		"T1": {Fee: money.MustParse("-2.00"), PartialCapture: money.MustParse("-20.00")},
+		"T2": {Fee: money.MustParse("-0.30"), FX: money.MustParse("-2.00"), Residual: money.MustParse("-0.20")},
+		"T3": nil,
+		"T4": {PartialCapture: money.MustParse("150.00"), Residual: money.MustParse("10.00")},
+	}
+	for _, res := range report.Results {
+		got, w := res.VarianceBreakdown, want[res.TransactionID]
+		if (got == nil) != (w == nil) || got != nil && *got != *w {
+			t.Errorf("%s: expected breakdown %+v, got %+v", res.TransactionID, w, got)
+		}
+	}
+	// The parts are totalled per currency, and in USD at the static rate of 0.058 MXN.
+	mxn, usd := report.Summary.NativeTotals["MXN"], report.Summary.NativeTotals["USD"]
+	if mxn.FeeVariance != money.MustParse("-2.00") || mxn.PartialCaptureVariance != money.MustParse("130.00") || !mxn.FXVariance.IsZero() {
+		t.Errorf("unexpected MXN variance totals: %+v", mxn)
+	}
+	if usd.FeeVariance != money.MustParse("-0.30") || usd.FXVariance != money.MustParse("-2.00") || usd.ResidualVariance != money.MustParse("-0.20") {
+		t.Errorf("unexpected USD variance totals: %+v", usd)
+	}
+	if rep := report.Summary.ReportingTotals; rep.FeeVariance != money.MustParse("-0.42") || rep.PartialCaptureVariance != money.MustParse("7.54") {
+		t.Errorf("unexpected reporting variance totals: %+v", rep)
+	}
+	if p1 := report.ByProcessor["P1"]; p1.NativeTotals["MXN"] != mxn || p1.NativeTotals["USD"] != usd {
+		t.Errorf("unexpected P1 variance totals: %+v", p1.NativeTotals)
+	}
+}
+
+func TestFeeScheduleOvercharges(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	cfg.FeeSchedules = map[string][]models.FeeSchedule{"P1": {
+		{Tiers: []models.FeeTier{
+			{Percentage: 0.03, Fixed: money.MustParse("1.00"), Min: money.MustParse("4.00")},
+			{MinVolume: money.MustParse("1000"), Percentage: 0.02, Fixed: money.MustParse("1.00")},
+		}},
+		{PaymentMethod: "credit_card", Country: "MX", Tiers: []models.FeeTier{{Percentage: 0.01}}},
+	}}
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	txn := func(id, method, country, amount string) models.Transaction {
+		return models.Transaction{ID: id, OrderID: "ORD-" + id, ProcessorName: "P1", ProcessorTxnID: "P" + id, Amount: money.MustParse(amount), Currency: "MXN", Country: country, PaymentMethod: method, AuthorizedAt: authAt}
+	}
+	line := func(id, ptid, gross, fee string) models.SettlementRecord {
+		return models.SettlementRecord{ID: id, ProcessorName: "P1", ProcessorTxnID: ptid, GrossAmount: money.MustParse(gross), FeeAmount: money.MustParse(fee), NetAmount: money.MustParse(gross).Sub(money.MustParse(fee)), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)}
+	}
+	s.AddTransactions([]models.Transaction{
+		txn("T1", "credit_card", "MX", "100.00"),
+		txn("T2", "oxxo", "MX", "100.00"),
+		txn("T3", "credit_card", "CO", "1000.00"),
+	})
+	// 1200 MXN of volume puts the default schedule in its second tier.
+	s.AddSettlements([]models.SettlementRecord{
+		line("S1", "PT1", "100.00", "1.00"),
+		line("S2", "PT2", "100.00", "3.50"),
+		line("S3", "PT3", "1000.00", "25.00"),
+	})
+
+	report := run(t, r, "TEST-FEES")
+
+	want := map[string][2]string{"T1": {"1.00", ""}, "T2": {"3.00", "0.50"}, "T3": {"21.00", "4.00"}}
+	for _, res := range report.Results {
+		w := want[res.TransactionID]
+		if res.ExpectedFee == nil || *res.ExpectedFee != money.MustParse(w[0]) {
+			t.Errorf("%s: expected fee %s, got %v", res.TransactionID, w[0], res.ExpectedFee)
+		}
+		if w[1] == "" && res.FeeOvercharge != nil || w[1] != "" && (res.FeeOvercharge == nil || *res.FeeOvercharge != money.MustParse(w[1])) {
+			t.Errorf("%s: expected overcharge %q, got %v", res.TransactionID, w[1], res.FeeOvercharge)
+		}
+		if res.Status != models.StatusMatched {
+			t.Errorf("%s: an overcharge should not change the status, got %s", res.TransactionID, res.Status)
+		}
+	}
+	if report.Summary.FeeOvercharges != 2 || report.Summary.NativeTotals["MXN"].FeeOvercharge != money.MustParse("4.50") {
+		t.Errorf("unexpected summary: %+v", report.Summary)
+	}
+	wantByProcessor := []models.ProcessorFeeOvercharge{{
+		ProcessorName: "P1", Currency: "MXN", Settlements: 2,
+		ChargedFees: money.MustParse("28.50"), ExpectedFees: money.MustParse("24.00"), Overcharged: money.MustParse("4.50"),
+	}}
+	if !slices.Equal(report.FeeOvercharges, wantByProcessor) {
+		t.Errorf("expected fee overcharges %+v, got %+v", wantByProcessor, report.FeeOvercharges)
+	}
+}
+
+func TestDataQualityFindings(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "MXN", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("-10.00"), Currency: "MXP", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		// Settled the day before authorization, and the net is off by a cent.
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("100.00"), FeeAmount: money.MustParse("2.50"), NetAmount: money.MustParse("97.51"), Currency: "MXN", SettledAt: authAt.Add(-24 * time.Hour)},
+		// No references at all.
+		{ID: "S2", ProcessorName: "P1", GrossAmount: money.MustParse("5.00"), NetAmount: money.MustParse("5.00"), Currency: "MXN", SettledAt: authAt},
+		// A refund reported as a positive amount with the fee added is consistent.
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnID: "RF1", GrossAmount: money.MustParse("20.00"), FeeAmount: money.MustParse("1.00"), NetAmount: money.MustParse("21.00"), Currency: "MXN", SettledAt: authAt, RecordType: models.RecordRefund, OriginalProcessorTxnID: "PT1"},
+	})
+
+	report := run(t, r, "TEST-DQ")
+
+	type finding struct{ kind, txn, settlement, field string }
+	var got []finding
+	for _, f := range report.DataQuality.Findings {
+		got = append(got, finding{f.Kind, f.TransactionID, f.SettlementID, f.Field})
+	}
+	want := []finding{
+		{models.FindingInvalidCurrency, "T2", "", "currency"},
+		{models.FindingNegativeAmount, "T2", "", "amount"},
+		{models.FindingArithmeticMismatch, "", "S1", "net_amount"},
+		{models.FindingMissingReference, "", "S2", "processor_txn_id"},
+		{models.FindingSettledBeforeAuth, "T1", "S1", "settled_at"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected findings %v, got %v", want, got)
+	}
+	if report.Summary.DataQualityFindings != 5 || report.DataQuality.ByKind[models.FindingNegativeAmount] != 1 {
+		t.Errorf("unexpected counts: summary %d, by kind %v", report.Summary.DataQualityFindings, report.DataQuality.ByKind)
+	}
+	// Findings do not block matching.
+	if report.Summary.Matched != 1 {
+		t.Errorf("expected T1 to still match, got %+v", report.Summary)
+	}
+}
+
+func TestTransactionStatusExpectations(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	capturedAt := authAt.Add(time.Hour)
+	txn := func(id, status string, captured *time.Time) models.Transaction {
+		return models.Transaction{ID: id, OrderID: "ORD-" + id, ProcessorName: "P1", ProcessorTxnID: "P" + id, Amount: money.MustParse("100.00"), Currency: "MXN", Status: status, AuthorizedAt: authAt, CapturedAt: captured}
+	}
+	s.AddTransactions([]models.Transaction{
+		txn("T1", models.TxnCaptured, &capturedAt),   // unsettled
+		txn("T2", models.TxnAuthorized, nil),         // never captured
+		txn("T3", models.TxnFailed, nil),             // failed, nothing arrived
+		txn("T4", models.TxnFailed, nil),             // failed, but settled
+		txn("T5", models.TxnAuthorized, &capturedAt), // captured after all: unsettled
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S4", ProcessorName: "P1", ProcessorTxnID: "PT4", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-STATUS")
+
+	want := map[string]models.ReconciliationStatus{
+		"T1": models.StatusUnsettled,
+		"T2": models.StatusNotCaptured,
+		"T3": models.StatusFailed,
+		"T4": models.StatusFailedSettled,
+		"T5": models.StatusUnsettled,
+	}
+	for _, res := range report.Results {
+		if res.Status != want[res.TransactionID] {
+			t.Errorf("%s: expected %s, got %s", res.TransactionID, want[res.TransactionID], res.Status)
+		}
+		if res.Status != models.StatusUnsettled && !res.ExpectedAmount.IsZero() {
+			t.Errorf("%s: expected nothing to be due, got %s", res.TransactionID, res.ExpectedAmount)
+		}
+	}
+	sum := report.Summary
+	if sum.Unsettled != 2 || sum.NotCaptured != 1 || sum.Failed != 1 || sum.FailedSettled != 1 || sum.NativeTotals["MXN"].ExpectedAmount != money.MustParse("200.00") {
+		t.Errorf("unexpected summary: %+v", sum)
+	}
+	// Only the two unsettled transactions and the settled failed one count.
+	if sum.ReconciliationRate != 0 {
+		t.Errorf("expected a reconciliation rate of 0, got %v", sum.ReconciliationRate)
+	}
+	if len(report.HighPriority) != 1 || report.HighPriority[0].TransactionID != "T4" {
+		t.Errorf("expected the settled failed transaction to be high priority, got %+v", report.HighPriority)
+	}
+}
+
+func TestFailedTransactionSettledInParts(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	cfg.FeeSchedules = map[string][]models.FeeSchedule{"P1": {{Tiers: []models.FeeTier{{Percentage: 0.01}}}}}
+	authAt := baseTime()
+	settledAt := authAt.Add(24 * time.Hour)
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("100.00"), Currency: "MXN", Status: models.TxnFailed, AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("100.00"), Currency: "MXN", Status: models.TxnFailed, AuthorizedAt: authAt},
+	})
+	line := func(id, ptid, gross, fee string) models.SettlementRecord {
+		return models.SettlementRecord{ID: id, ProcessorName: "P1", ProcessorTxnID: ptid, GrossAmount: money.MustParse(gross), FeeAmount: money.MustParse(fee), NetAmount: money.MustParse(gross).Sub(money.MustParse(fee)), Currency: "MXN", SettledAt: settledAt}
+	}
+	s.AddSettlements([]models.SettlementRecord{
+		// T1 settled twice, T2 in two parts with a fee above the schedule.
+		line("S1", "PT1", "100.00", "1.00"), line("S2", "PT1", "100.00", "1.00"),
+		line("S3", "PT2", "60.00", "3.00"), line("S4", "PT2", "40.00", "0.40"),
+	})
+	report := run(t, New(s, cfg), "TEST-FAILED-PARTS")
+
+	if len(report.Results) != 4 {
+		t.Fatalf("expected 4 results, got %+v", report.Results)
+	}
+	for _, res := range report.Results {
+		if res.Status != models.StatusFailedSettled || !res.ExpectedAmount.IsZero() || res.VarianceAmount != res.SettledGrossAmount ||
+			res.ExpectedFee != nil || res.FeeOvercharge != nil || !strings.HasPrefix(res.Notes, "Settlement received for failed transaction "+res.TransactionID) {
+			t.Errorf("%s: expected failed_transaction_settled with nothing due, got %+v", res.SettlementID, res)
+		}
+	}
+	if !strings.Contains(report.Results[1].Notes, "exact resend of S1") {
+		t.Errorf("expected the duplicate note to be kept, got %q", report.Results[1].Notes)
+	}
+	if sum := report.Summary; sum.FailedSettled != 4 || sum.Duplicates != 0 || sum.FeeOvercharges != 0 || len(report.FeeOvercharges) != 0 {
+		t.Errorf("unexpected summary: %+v", sum)
+	}
+}
+
+func TestPartialAndMultipleCaptures(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	hotel := money.MustParse("350.00")
+	s.AddTransactions([]models.Transaction{
+		// A hotel authorization of 500 of which only 350 was captured.
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("500.00"), CapturedAmount: &hotel, Currency: "MXN", AuthorizedAt: authAt},
+		// Still only authorized, but shipped and captured in two parts.
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("300.00"), Currency: "MXN", Status: models.TxnAuthorized, AuthorizedAt: authAt, Captures: []models.Capture{
+			{ID: "C1", Amount: money.MustParse("200.00"), CapturedAt: authAt.Add(time.Hour)},
+			{ID: "C2", Amount: money.MustParse("100.00"), CapturedAt: authAt.Add(48 * time.Hour)},
+		}},
+		// Captured beyond its authorization.
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P1", ProcessorTxnID: "PT3", Amount: money.MustParse("100.00"), Currency: "MXN", AuthorizedAt: authAt, Captures: []models.Capture{
+			{Amount: money.MustParse("80.00"), CapturedAt: authAt},
+			{Amount: money.MustParse("30.00"), CapturedAt: authAt},
+		}},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("350.00"), NetAmount: money.MustParse("350.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("200.00"), NetAmount: money.MustParse("200.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S3", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("100.00"), NetAmount: money.MustParse("100.00"), Currency: "MXN", SettledAt: authAt.Add(72 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-CAPTURES")
+
+	for _, res := range report.Results {
+		switch res.TransactionID {
+		case "T1":
+			if res.Status != models.StatusMatched || res.ExpectedAmount != hotel || !res.VarianceAmount.IsZero() {
+				t.Errorf("expected the captured 350 to match, got %+v", res)
+			}
+		case "T2":
+			if res.Status != models.StatusMatched || res.MatchGroup != "split:T2" {
+				t.Errorf("expected the two captures to match as a split, got %+v", res)
+			}
+		case "T3":
+			if res.Status != models.StatusUnsettled || res.ExpectedAmount != money.MustParse("110.00") {
+				t.Errorf("expected the 110 captured to be due, got %+v", res)
+			}
+		}
+	}
+	if report.Summary.Matched != 3 || report.Summary.SplitGroups != 1 || report.Summary.NotCaptured != 0 {
+		t.Errorf("unexpected summary: %+v", report.Summary)
+	}
+	if len(report.DataQuality.Findings) != 1 || report.DataQuality.Findings[0].Kind != models.FindingCaptureExceedsAuth || report.DataQuality.Findings[0].TransactionID != "T3" {
+		t.Errorf("expected the over-capture to be a finding, got %+v", report.DataQuality.Findings)
+	}
+}
+
+func TestUnsettledAging(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	asOf := baseTime().Add(40 * 24 * time.Hour)
+	txn := func(id string, age int) models.Transaction {
+		return models.Transaction{ID: id, OrderID: "ORD-" + id, ProcessorName: "P1", ProcessorTxnID: "P" + id, Amount: money.MustParse("100.00"), Currency: "MXN", AuthorizedAt: asOf.Add(-time.Duration(age)*24*time.Hour - time.Hour)}
+	}
+	s.AddTransactions([]models.Transaction{
+		txn("T1", 0), txn("T2", 3), txn("T3", 4), txn("T4", 14), txn("T5", 15), txn("T6", 31),
+		{ID: "T7", OrderID: "ORD-T7", ProcessorName: "P2", ProcessorTxnID: "PT7", Amount: money.MustParse("50.00"), Currency: "MXN", AuthorizedAt: asOf.Add(-24 * time.Hour)},
+	})
+	// The latest settlement sets the as-of date.
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S7", ProcessorName: "P2", ProcessorTxnID: "PT7", GrossAmount: money.MustParse("50.00"), NetAmount: money.MustParse("50.00"), Currency: "MXN", SettledAt: asOf},
+	})
+
+	report := run(t, r, "TEST-AGING")
+
+	if !report.AsOf.Equal(asOf) {
+		t.Errorf("expected as-of %s, got %s", asOf, report.AsOf)
+	}
+	wantBucket := map[string]string{"T1": "0-3", "T2": "0-3", "T3": "4-7", "T4": "8-14", "T5": "15-30", "T6": "30+"}
+	for _, res := range report.Results {
+		if res.Status != models.StatusUnsettled {
+			if res.DaysOutstanding != nil || res.AgingBucket != "" {
+				t.Errorf("%s: expected no aging on a %s result", res.TransactionID, res.Status)
+			}
+			continue
+		}
+		if res.AgingBucket != wantBucket[res.TransactionID] {
+			t.Errorf("%s: expected bucket %s, got %s", res.TransactionID, wantBucket[res.TransactionID], res.AgingBucket)
+		}
+	}
+	want := models.AgingBuckets{Days0To3: 2, Days4To7: 1, Days8To14: 1, Days15To30: 1, Over30: 1}
+	if report.Summary.UnsettledAging != want || report.ByProcessor["P1"].UnsettledAging != want || report.ByCurrency["MXN"].UnsettledAging != want {
+		t.Errorf("expected aging %+v, got %+v", want, report.Summary.UnsettledAging)
+	}
+	// Only the two outstanding longer than 14 days are promoted.
+	var promoted []string
+	for _, hp := range report.HighPriority {
+		promoted = append(promoted, hp.TransactionID)
+	}
+	if !slices.Equal(promoted, []string{"T5", "T6"}) {
+		t.Errorf("expected T5 and T6 to be high priority, got %v", promoted)
+	}
+
+	// A configured as-of date ages from there instead.
+	earlier := asOf.Add(-10 * 24 * time.Hour)
+	cfg.AsOf = &earlier
+	report = run(t, New(s, cfg), "TEST-AGING-ASOF")
+	if report.Summary.UnsettledAging != (models.AgingBuckets{Days0To3: 3, Days4To7: 2, Days15To30: 1}) {
+		t.Errorf("unexpected aging as of %s: %+v", earlier, report.Summary.UnsettledAging)
+	}
+}
+
+func TestReportingCurrencyTotals(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	s.AddTransactions([]models.Transaction{
+		{ID: "T1", OrderID: "ORD-1", ProcessorName: "P1", ProcessorTxnID: "PT1", Amount: money.MustParse("1000.00"), Currency: "MXN", Country: "MX", AuthorizedAt: authAt},
+		{ID: "T2", OrderID: "ORD-2", ProcessorName: "P1", ProcessorTxnID: "PT2", Amount: money.MustParse("100.00"), Currency: "BRL", Country: "BR", AuthorizedAt: authAt},
+		{ID: "T3", OrderID: "ORD-3", ProcessorName: "P2", ProcessorTxnID: "PT3", Amount: money.MustParse("5000"), Currency: "JPY", Country: "JP", AuthorizedAt: authAt},
+	})
+	s.AddSettlements([]models.SettlementRecord{
+		{ID: "S1", ProcessorName: "P1", ProcessorTxnID: "PT1", GrossAmount: money.MustParse("1000.00"), FeeAmount: money.MustParse("30.00"), NetAmount: money.MustParse("970.00"), Currency: "MXN", SettledAt: authAt.Add(24 * time.Hour)},
+		{ID: "S2", ProcessorName: "P1", ProcessorTxnID: "PT2", GrossAmount: money.MustParse("90.00"), NetAmount: money.MustParse("90.00"), Currency: "BRL", SettledAt: authAt.Add(24 * time.Hour)},
+	})
+
+	report := run(t, r, "TEST-REPORTING")
+
+	sum := report.Summary
+	if sum.ReportingCurrency != "USD" || !slices.Equal(sum.UnconvertedCurrencies, []string{"JPY"}) {
+		t.Fatalf("unexpected reporting currency %q, unconverted %v", sum.ReportingCurrency, sum.UnconvertedCurrencies)
+	}
+	// 1000 MXN at 0.058 and 100 BRL at 0.20; the yen have no rate.
+	want := models.AmountTotals{
+		ExpectedAmount: money.MustParse("78.00"),
+		SettledGross:   money.MustParse("76.00"),
+		SettledNet:     money.MustParse("74.26"),
+		VarianceAmount: money.MustParse("-2.00"),
+		Fees:           money.MustParse("1.74"),
+		// The BRL shortfall is unexplained.
+		ResidualVariance: money.MustParse("-2.00"),
+	}
+	if sum.ReportingTotals != want {
+		t.Errorf("expected reporting totals %+v, got %+v", want, sum.ReportingTotals)
+	}
+	if got := sum.NativeTotals["JPY"].ExpectedAmount; got != money.MustParse("5000") {
+		t.Errorf("expected 5000 JPY native, got %s", got)
+	}
+	if p1 := report.ByProcessor["P1"]; p1.ReportingTotals != want || len(p1.UnconvertedCurrencies) != 0 {
+		t.Errorf("unexpected P1 reporting totals %+v", p1.ReportingTotals)
+	}
+	if br := report.ByCountry["BR"]; br.ReportingTotals.VarianceAmount != money.MustParse("-2.00") {
+		t.Errorf("unexpected BR reporting totals %+v", br.ReportingTotals)
+	}
+}
+
+func TestHighPriorityInReportingCurrency(t *testing.T) {
+	s := store.New()
+	cfg := models.DefaultConfig()
+	cfg.FuzzyMatch.Enabled = false
+	cfg.HighPriorityThreshold = money.MustParse("40")
+	cfg.FXRates["JPY"] = map[string]float64{"USD": 0.0067}
+	r := New(s, cfg)
+
+	authAt := baseTime()
+	txn := func(id, amount, currency string) models.Transaction {
+		return models.Transaction{ID: id, OrderID: "ORD-" + id, ProcessorName: "P1", ProcessorTxnID: "P" + id, Amount: money.MustParse(amount), Currency: currency, AuthorizedAt: authAt}
+	}
+	sett := func(id, ptid, gross, currency string) models.SettlementRecord {
+		return models.SettlementRecord{ID: id, ProcessorName: "P1", ProcessorTxnID: ptid, GrossAmount: money.MustParse(gross), NetAmount: money.MustParse(gross), Currency: currency, SettledAt: authAt.Add(24 * time.Hour)}
+	}
+	s.AddTransactions([]models.Transaction{txn("T1", "100.00", "USD"), txn("T2", "10000", "JPY"), txn("T3", "20000", "JPY")})
+	s.AddSettlements([]models.SettlementRecord{sett("S1", "PT1", "50.00", "USD"), sett("S2", "PT2", "5000", "JPY"), sett("S3", "PT3", "10000", "JPY")})
+
+	report := run(t, r, "TEST-PRIORITY-FX")
+
+	// 10000 JPY is 67.00 USD and outranks 50 USD; 5000 JPY is 33.50 USD, under the threshold.
+	var got []string
+	for _, hp := range report.HighPriority {
+		got = append(got, hp.TransactionID)
+	}
+	if !slices.Equal(got, []string{"T3", "T1"}) {
+		t.Errorf("expected T3 then T1, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package reconciler
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// reportingCurrency is the configured reporting currency, USD when unset.
+func (r *Reconciler) reportingCurrency() string {
+	if r.config.ReportingCurrency == "" {
+		return "USD"
+	}
+	return r.config.ReportingCurrency
+}
+
+// addNativeTotals adds a result's amounts to the totals of its currency in s.
+func addNativeTotals(s *models.ReportSummary, res models.ReconciliationResult) {
+	if res.Currency == "" {
+		return
+	}
+	if s.NativeTotals == nil {
+		s.NativeTotals = make(map[string]models.AmountTotals)
+	}
+	t := s.NativeTotals[res.Currency]
+	t.ExpectedAmount = t.ExpectedAmount.Add(res.ExpectedAmount)
+	t.SettledGross = t.SettledGross.Add(res.SettledGrossAmount)
+	t.SettledNet = t.SettledNet.Add(res.SettledNetAmount)
+	t.VarianceAmount = t.VarianceAmount.Add(res.VarianceAmount)
+	t.Fees = t.Fees.Add(res.FeeAmount)
+	if res.FeeOvercharge != nil {
+		t.FeeOvercharge = t.FeeOvercharge.Add(*res.FeeOvercharge)
+	}
+	addVarianceToTotals(&t, res.VarianceBreakdown)
+	s.NativeTotals[res.Currency] = t
+}
+
+// setReportingTotals converts the native totals of s to the reporting currency
+// at the as-of date, one currency at a time in sorted order.
+func (r *Reconciler) setReportingTotals(s *models.ReportSummary) {
+	to := r.reportingCurrency()
+	s.ReportingCurrency = to
+	s.ReportingTotals = models.AmountTotals{}
+	s.UnconvertedCurrencies = nil
+	if s.NativeTotals == nil {
+		s.NativeTotals = make(map[string]models.AmountTotals)
+	}
+	for _, from := range slices.Sorted(maps.Keys(s.NativeTotals)) {
+		if _, ok := r.fxRate(from, to, r.asOf); !ok {
+			s.UnconvertedCurrencies = append(s.UnconvertedCurrencies, from)
+			continue
+		}
+		convert := func(a money.Amount) money.Amount {
+			converted, _ := r.convertAmount(a, from, to, r.asOf) // the rate exists
+			return converted
+		}
+		n := s.NativeTotals[from]
+		t := &s.ReportingTotals
+		t.ExpectedAmount = t.ExpectedAmount.Add(convert(n.ExpectedAmount))
+		t.SettledGross = t.SettledGross.Add(convert(n.SettledGross))
+		t.SettledNet = t.SettledNet.Add(convert(n.SettledNet))
+		t.VarianceAmount = t.VarianceAmount.Add(convert(n.VarianceAmount))
+		t.Fees = t.Fees.Add(convert(n.Fees))
+		t.FeeOvercharge = t.FeeOvercharge.Add(convert(n.FeeOvercharge))
+		t.FeeVariance = t.FeeVariance.Add(convert(n.FeeVariance))
+		t.FXVariance = t.FXVariance.Add(convert(n.FXVariance))
+		t.PartialCaptureVariance = t.PartialCaptureVariance.Add(convert(n.PartialCaptureVariance))
+		t.ResidualVariance = t.ResidualVariance.Add(convert(n.ResidualVariance))
+	}
+}
+
+// reportingVariance is the absolute variance of a result converted to the
+// reporting currency at the as-of date, so variances in different currencies
+// can be compared. A variance with no rate to the reporting currency is taken
+// as it is.
+func (r *Reconciler) reportingVariance(res models.ReconciliationResult) money.Amount {
+	v, err := r.convertAmount(res.VarianceAmount.Abs(), res.Currency, r.reportingCurrency(), r.asOf)
+	if err != nil {
+		return res.VarianceAmount.Abs()
+	}
+	return v
+}
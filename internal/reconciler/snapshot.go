@@ -0,0 +1,71 @@
+package reconciler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// NewSnapshot describes a run over in with the given config.
+func NewSnapshot(cfg models.ReconciliationConfig, in models.RunInputs) (*models.RunSnapshot, error) {
+	hash, err := InputHash(in)
+	if err != nil {
+		return nil, err
+	}
+	snap := &models.RunSnapshot{
+		Config:         cfg,
+		TransactionIDs: make([]string, 0, len(in.Transactions)),
+		SettlementIDs:  make([]string, 0, len(in.Settlements)),
+		InputHash:      hash,
+	}
+	for _, t := range in.Transactions {
+		snap.TransactionIDs = append(snap.TransactionIDs, t.ID)
+	}
+	for _, s := range in.Settlements {
+		snap.SettlementIDs = append(snap.SettlementIDs, s.ID)
+	}
+	return snap, nil
+}
+
+// InputHash returns the hex SHA-256 of the JSON encoding of in.
+func InputHash(in models.RunInputs) (string, error) {
+	return hashJSON(in)
+}
+
+// ReportHash returns the hex SHA-256 of a report's content. The run ID and
+// generation time are left out, and result IDs are taken relative to the run,
+// so a faithful replay hashes the same as the original run.
+func ReportHash(report *models.ReconciliationReport) (string, error) {
+	prefix := "RR-" + report.RunID + "-"
+	cp := *report
+	cp.RunID = ""
+	cp.GeneratedAt = time.Time{}
+	cp.Results = relativeIDs(report.Results, prefix)
+	cp.HighPriority = relativeIDs(report.HighPriority, prefix)
+	return hashJSON(cp)
+}
+
+func relativeIDs(results []models.ReconciliationResult, prefix string) []models.ReconciliationResult {
+	if results == nil {
+		return nil
+	}
+	out := make([]models.ReconciliationResult, len(results))
+	for i, res := range results {
+		res.ID = strings.TrimPrefix(res.ID, prefix)
+		out[i] = res
+	}
+	return out
+}
+
+func hashJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
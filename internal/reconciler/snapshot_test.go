@@ -0,0 +1,54 @@
+package reconciler
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/generator"
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/store"
+)
+
+func TestReconcileIsReproducible(t *testing.T) {
+	s := store.New()
+	txns, setts := generator.GenerateTestData(42)
+	s.AddTransactions(txns)
+	s.AddSettlements(setts)
+	r := New(s, models.DefaultConfig())
+
+	in, err := r.LoadInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := NewSnapshot(r.Config(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.TransactionIDs) != len(txns) || !slices.IsSorted(snap.TransactionIDs) {
+		t.Errorf("expected %d sorted transaction IDs in snapshot", len(txns))
+	}
+
+	// The in-memory store lists in random order; inputs must still come back identical.
+	again, err := r.LoadInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := InputHash(again); h != snap.InputHash {
+		t.Errorf("input hash changed between loads: %s vs %s", h, snap.InputHash)
+	}
+
+	original, err := r.Reconcile(context.Background(), "RUN-0001", in, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := New(store.New(), snap.Config).Reconcile(context.Background(), "RUN-0002", again, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1, _ := ReportHash(original)
+	h2, _ := ReportHash(replay)
+	if h1 != h2 {
+		t.Errorf("replay report hash %s differs from original %s", h2, h1)
+	}
+}
@@ -0,0 +1,93 @@
+package reconciler
+
+import (
+	"fmt"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// dataQuality checks the input records for problems that do not stop matching
+// but make its results less trustworthy: fee arithmetic that does not add up,
+// unknown currencies, negative amounts, captures beyond the authorized amount,
+// records with nothing to match them by, and settlements dated before the
+// authorization they were matched to.
+// Findings come in input order: transactions, then settlement lines, then
+// matched pairs in result order.
+func dataQuality(txns []models.Transaction, setts []models.SettlementRecord, results []models.ReconciliationResult) models.DataQuality {
+	dq := models.DataQuality{Findings: []models.DataQualityFinding{}, ByKind: make(map[string]int)}
+	add := func(kind, txnID, settlementID, field, format string, args ...any) {
+		dq.ByKind[kind]++
+		dq.Findings = append(dq.Findings, models.DataQualityFinding{
+			Kind:          kind,
+			TransactionID: txnID,
+			SettlementID:  settlementID,
+			Field:         field,
+			Message:       fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, t := range txns {
+		if !money.ValidCurrency(t.Currency) {
+			add(models.FindingInvalidCurrency, t.ID, "", "currency", "Currency %q is not an ISO 4217 code", t.Currency)
+		}
+		if t.RecordType.Normalize() == models.RecordSale && t.Amount.Sign() < 0 {
+			add(models.FindingNegativeAmount, t.ID, "", "amount", "Sale amount %s is negative", t.Amount)
+		}
+		if captured := t.Captured(); captured.Cmp(t.Amount) > 0 {
+			add(models.FindingCaptureExceedsAuth, t.ID, "", "captures", "Captured %s, more than the authorized %s", captured, t.Amount)
+		}
+		if t.ProcessorTxnID == "" && t.OrderID == "" {
+			add(models.FindingMissingReference, t.ID, "", "processor_txn_id", "Transaction has neither a processor transaction ID nor an order ID")
+		}
+	}
+
+	for _, s := range setts {
+		if !money.ValidCurrency(s.Currency) {
+			add(models.FindingInvalidCurrency, "", s.ID, "currency", "Currency %q is not an ISO 4217 code", s.Currency)
+		}
+		if !feeArithmeticOK(s) {
+			add(models.FindingArithmeticMismatch, "", s.ID, "net_amount", "Gross %s minus fee %s is %s, but net is %s",
+				s.GrossAmount, s.FeeAmount, s.GrossAmount.Sub(s.FeeAmount), s.NetAmount)
+		}
+		if s.FeeAmount.Sign() < 0 {
+			add(models.FindingNegativeAmount, "", s.ID, "fee_amount", "Fee %s is negative", s.FeeAmount)
+		}
+		if s.RecordType.Normalize() == models.RecordSale {
+			if s.GrossAmount.Sign() < 0 {
+				add(models.FindingNegativeAmount, "", s.ID, "gross_amount", "Sale gross amount %s is negative", s.GrossAmount)
+			}
+			if s.NetAmount.Sign() < 0 {
+				add(models.FindingNegativeAmount, "", s.ID, "net_amount", "Sale net amount %s is negative", s.NetAmount)
+			}
+		}
+		if s.ProcessorTxnID == "" && s.OrderReference == "" && len(s.ProcessorTxnIDs) == 0 {
+			add(models.FindingMissingReference, "", s.ID, "processor_txn_id", "Settlement line has neither a processor transaction ID nor an order reference")
+		}
+	}
+
+	for _, res := range results {
+		if res.AuthorizedAt != nil && res.SettledAt != nil && res.SettledAt.Before(*res.AuthorizedAt) {
+			add(models.FindingSettledBeforeAuth, res.TransactionID, res.SettlementID, "settled_at", "Settled %s, before the transaction was authorized on %s",
+				res.SettledAt.Format("2006-01-02 15:04"), res.AuthorizedAt.Format("2006-01-02 15:04"))
+		}
+	}
+
+	return dq
+}
+
+// feeArithmeticOK reports whether a line's net amount is its gross amount less
+// its fee, to the currency's minor unit. Refund and chargeback lines are signed
+// differently by different processors, so for them the magnitudes are checked,
+// with the fee either deducted from or added to the amount.
+func feeArithmeticOK(s models.SettlementRecord) bool {
+	equal := func(a, b money.Amount) bool { return a.Sub(b).Round(s.Currency).IsZero() }
+	if equal(s.GrossAmount.Sub(s.FeeAmount), s.NetAmount) {
+		return true
+	}
+	if s.RecordType.Normalize() == models.RecordSale {
+		return false
+	}
+	gross, fee, net := s.GrossAmount.Abs(), s.FeeAmount.Abs(), s.NetAmount.Abs()
+	return equal(gross.Sub(fee), net) || equal(gross.Add(fee), net)
+}
@@ -0,0 +1,90 @@
+package reconciler
+
+import (
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// varianceBreakdown splits the variance of settlement s against the
+// transactions it settles into its parts. Known causes are attributed first:
+// captures made after the settlement, which it cannot include yet, then the
+// FX difference between the applied and the reference rate, then up to the
+// uncaptured part of the authorized amounts for a remaining excess (the
+// processor settled what was authorized rather than what was captured), then
+// up to the settlement's fee for a remaining shortfall. Whatever is left is
+// the residual, including any part that cannot be converted for lack of an
+// FX rate. It returns nil when there is no variance to explain.
+func (r *Reconciler) varianceBreakdown(txns []models.Transaction, s models.SettlementRecord, variance money.Amount) *models.VarianceBreakdown {
+	if variance.IsZero() {
+		return nil
+	}
+	var b models.VarianceBreakdown
+	var uncaptured money.Amount // authorized but never captured, in the settlement currency
+	for _, txn := range txns {
+		at := r.fxDate(txn, s)
+		base := txn.Captured()
+		if txn.CaptureKnown() && base.Cmp(txn.Amount) < 0 {
+			if converted, err := r.convertAmount(txn.Amount.Sub(base), txn.Currency, s.Currency, at); err == nil {
+				uncaptured = uncaptured.Add(converted)
+			}
+		}
+		var later money.Amount
+		for _, c := range txn.Captures {
+			if c.CapturedAt.After(s.SettledAt) {
+				later = later.Add(c.Amount)
+			}
+		}
+		if !later.IsZero() {
+			if converted, err := r.convertAmount(later, txn.Currency, s.Currency, at); err == nil {
+				b.PartialCapture = b.PartialCapture.Sub(converted)
+			}
+		}
+		if txn.Currency != s.Currency {
+			ref, refErr := r.convertAmount(base, txn.Currency, s.Currency, r.fxReferenceDate(txn, s))
+			applied, err := r.convertAmount(base, txn.Currency, s.Currency, at)
+			if refErr == nil && err == nil {
+				b.FX = b.FX.Add(ref.Sub(applied))
+			}
+		}
+	}
+	rest := variance.Sub(b.PartialCapture).Sub(b.FX)
+	if rest.Sign() > 0 && uncaptured.Sign() > 0 {
+		part := rest
+		if rest.Cmp(uncaptured) > 0 {
+			part = uncaptured
+		}
+		b.PartialCapture = b.PartialCapture.Add(part)
+		rest = rest.Sub(part)
+	}
+	if rest.Sign() < 0 && s.FeeAmount.Sign() > 0 {
+		b.Fee = rest
+		if fee := s.FeeAmount.Neg(); rest.Cmp(fee) < 0 {
+			b.Fee = fee
+		}
+	}
+	b.Residual = rest.Sub(b.Fee)
+	return &b
+}
+
+// fxReferenceDate is the date of the reference rate FX variance is measured
+// against: whichever of the authorization and settlement dates the FX date
+// policy does not convert at.
+func (r *Reconciler) fxReferenceDate(txn models.Transaction, s models.SettlementRecord) time.Time {
+	if r.config.FXDatePolicy == models.FXDateAuthorization {
+		return s.SettledAt
+	}
+	return txn.AuthorizedAt
+}
+
+// addVarianceToTotals adds a result's variance breakdown to t.
+func addVarianceToTotals(t *models.AmountTotals, b *models.VarianceBreakdown) {
+	if b == nil {
+		return
+	}
+	t.FeeVariance = t.FeeVariance.Add(b.Fee)
+	t.FXVariance = t.FXVariance.Add(b.FX)
+	t.PartialCaptureVariance = t.PartialCaptureVariance.Add(b.PartialCapture)
+	t.ResidualVariance = t.ResidualVariance.Add(b.Residual)
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// WriteCSV writes one section of a report as CSV: the results, the
+// high-priority discrepancies, or one of the breakdowns, one row per key in
+// key order. Columns are always in the same order, whatever the data.
+func WriteCSV(w io.Writer, rep *models.ReconciliationReport, section string) error {
+	cw := csv.NewWriter(w)
+	switch section {
+	case SectionResults:
+		writeCSVTable(cw, resultColumns, rep.Results)
+	case SectionHighPriority:
+		writeCSVTable(cw, resultColumns, rep.HighPriority)
+	default:
+		key, b, ok := breakdown(rep, section)
+		if !ok {
+			return fmt.Errorf("unknown report section %q", section)
+		}
+		cols, rows := breakdownTable(section, key, b)
+		writeCSVTable(cw, cols, rows)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeCSVTable[T any](cw *csv.Writer, cols []column[T], rows []T) {
+	record := make([]string, len(cols))
+	for i, c := range cols {
+		record[i] = c.name
+	}
+	cw.Write(record)
+	for _, row := range rows {
+		for i, c := range cols {
+			record[i] = c.value(row)
+			if c.kind == kindText {
+				record[i] = text(record[i])
+			}
+		}
+		cw.Write(record)
+	}
+}
+
+// text guards a free-text cell against spreadsheet formula injection: a value
+// starting with =, +, -, @, tab or carriage return is prefixed with a quote,
+// as spreadsheets would otherwise evaluate it. Quoting of commas, quotes and
+// line breaks is left to the CSV writer.
+func text(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
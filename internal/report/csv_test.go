@@ -0,0 +1,77 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestWriteCSV(t *testing.T) {
+	settledAt := time.Date(2025, 1, 17, 14, 0, 0, 0, time.UTC)
+	days := 2
+	rep := &models.ReconciliationReport{
+		RunID: "RUN-0001",
+		Results: []models.ReconciliationResult{
+			{ID: "RR-1", TransactionID: "TXN-1", SettlementID: "S-1", ProcessorName: "P1", Status: models.StatusMatchedWithVariance, RecordType: models.RecordSale,
+				ExpectedAmount: money.MustParse("100"), SettledGrossAmount: money.MustParse("97.50"), VarianceAmount: money.MustParse("-2.50"), Currency: "MXN",
+				SettledAt: &settledAt, DaysToSettle: &days, VarianceBreakdown: &models.VarianceBreakdown{Fee: money.MustParse("-2.50")},
+				Notes: "Amount variance: expected 100.00, settled \"gross\" 97.50,\nsee batch"},
+			{ID: "RR-2", SettlementID: "=HYPERLINK(1)", ProcessorName: "P1", Status: models.StatusUnexpectedSettlement, RecordType: models.RecordSale},
+		},
+		ByProcessor: map[string]models.ReportSummary{
+			"P2": {Unsettled: 1},
+			"P1": {Matched: 3, ReportingTotals: models.AmountTotals{Fees: money.MustParse("1.5")}, ReconciliationRate: 75},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, rep, SectionResults); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %d", len(rows))
+	}
+	header := rows[0]
+	if len(header) != len(resultColumns) || header[0] != "id" || header[len(header)-1] != "notes" {
+		t.Errorf("unexpected header %v", header)
+	}
+	cell := func(row []string, name string) string { return row[slices.Index(header, name)] }
+	if got := cell(rows[1], "notes"); got != rep.Results[0].Notes {
+		t.Errorf("notes did not round-trip: %q", got)
+	}
+	if cell(rows[1], "settled_at") != "2025-01-17T14:00:00Z" || cell(rows[1], "days_to_settle") != "2" || cell(rows[1], "fee_variance") != "-2.50" {
+		t.Errorf("unexpected row %v", rows[1])
+	}
+	if cell(rows[2], "transaction_id") != "" || cell(rows[2], "fee_variance") != "" {
+		t.Errorf("expected empty cells for missing values, got %v", rows[2])
+	}
+	if got := cell(rows[2], "settlement_id"); got != "'=HYPERLINK(1)" {
+		t.Errorf("expected a formula to be escaped, got %q", got)
+	}
+
+	buf.Reset()
+	if err := WriteCSV(&buf, rep, SectionByProcessor); err != nil {
+		t.Fatal(err)
+	}
+	rows, _ = csv.NewReader(&buf).ReadAll()
+	if len(rows) != 3 || rows[0][0] != "processor_name" || rows[1][0] != "P1" || rows[2][0] != "P2" {
+		t.Fatalf("expected processors in order, got %v", rows)
+	}
+	header = rows[0]
+	if cell(rows[1], "matched") != "3" || cell(rows[1], "reporting_fees") != "1.50" || cell(rows[1], "reconciliation_rate_pct") != "75.00" {
+		t.Errorf("unexpected row %v", rows[1])
+	}
+
+	if err := WriteCSV(&buf, rep, "by_weather"); err == nil {
+		t.Error("expected an unknown section to fail")
+	}
+}
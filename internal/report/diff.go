@@ -0,0 +1,187 @@
+package report
+
+import (
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// Diff compares a run's report with the report of an earlier run (against).
+//
+// Results are paired by transaction and settlement ID. A result whose exact
+// (transaction, settlement) pair is not in the other run is paired by
+// transaction ID alone and then by settlement ID alone, so an unsettled
+// transaction that later matched a new settlement, or an unexpected settlement
+// whose transaction arrived later, shows up as a status change rather than as
+// one removed and one added item.
+func Diff(report, against *models.ReconciliationReport) models.RunDiff {
+	d := models.RunDiff{
+		RunID:        report.RunID,
+		AgainstRunID: against.RunID,
+		Changed:      []models.ResultChange{},
+		Added:        []models.ReconciliationResult{},
+		Removed:      []models.ReconciliationResult{},
+		Summary:      summaryDelta(report.Summary, against.Summary),
+		ByCurrency:   breakdownDelta(report.ByCurrency, against.ByCurrency),
+		ByCountry:    breakdownDelta(report.ByCountry, against.ByCountry),
+		ByProcessor:  breakdownDelta(report.ByProcessor, against.ByProcessor),
+		ByRecordType: breakdownDelta(report.ByRecordType, against.ByRecordType),
+	}
+
+	old := against.Results
+	used := make([]bool, len(old))
+	byPair := make(map[[2]string][]int)
+	byTxn := make(map[string][]int)
+	bySettlement := make(map[string][]int)
+	for i, res := range old {
+		key := [2]string{res.TransactionID, res.SettlementID}
+		byPair[key] = append(byPair[key], i)
+		if res.TransactionID != "" {
+			byTxn[res.TransactionID] = append(byTxn[res.TransactionID], i)
+		}
+		if res.SettlementID != "" {
+			bySettlement[res.SettlementID] = append(bySettlement[res.SettlementID], i)
+		}
+	}
+	take := func(candidates []int) int {
+		for _, i := range candidates {
+			if !used[i] {
+				used[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+
+	match := make([]int, len(report.Results))
+	for i, res := range report.Results {
+		match[i] = take(byPair[[2]string{res.TransactionID, res.SettlementID}])
+	}
+	for i, res := range report.Results {
+		if match[i] >= 0 {
+			continue
+		}
+		if res.TransactionID != "" {
+			match[i] = take(byTxn[res.TransactionID])
+		}
+		if match[i] < 0 && res.SettlementID != "" {
+			match[i] = take(bySettlement[res.SettlementID])
+		}
+	}
+
+	for i, res := range report.Results {
+		if match[i] < 0 {
+			d.Added = append(d.Added, res)
+			continue
+		}
+		prev := old[match[i]]
+		if prev.Status == res.Status {
+			continue
+		}
+		change := models.ResultChange{
+			TransactionID: res.TransactionID,
+			SettlementID:  res.SettlementID,
+			FromStatus:    prev.Status,
+			ToStatus:      res.Status,
+			From:          prev,
+			To:            res,
+		}
+		if change.TransactionID == "" {
+			change.TransactionID = prev.TransactionID
+		}
+		if change.SettlementID == "" {
+			change.SettlementID = prev.SettlementID
+		}
+		d.Changed = append(d.Changed, change)
+	}
+	for i, res := range old {
+		if !used[i] {
+			d.Removed = append(d.Removed, res)
+		}
+	}
+	return d
+}
+
+// summaryDelta returns a - b field by field.
+func summaryDelta(a, b models.ReportSummary) models.ReportSummary {
+	return models.ReportSummary{
+		TotalTransactions:     a.TotalTransactions - b.TotalTransactions,
+		TotalSettlements:      a.TotalSettlements - b.TotalSettlements,
+		Matched:               a.Matched - b.Matched,
+		MatchedWithVariance:   a.MatchedWithVariance - b.MatchedWithVariance,
+		Unsettled:             a.Unsettled - b.Unsettled,
+		UnexpectedSettlements: a.UnexpectedSettlements - b.UnexpectedSettlements,
+		Duplicates:            a.Duplicates - b.Duplicates,
+		ExactResends:          a.ExactResends - b.ExactResends,
+		ContentMismatches:     a.ContentMismatches - b.ContentMismatches,
+		Refunded:              a.Refunded - b.Refunded,
+		Chargebacks:           a.Chargebacks - b.Chargebacks,
+		ChargebackReversals:   a.ChargebackReversals - b.ChargebackReversals,
+		Adjustments:           a.Adjustments - b.Adjustments,
+		Unlinked:              a.Unlinked - b.Unlinked,
+		MatchedFuzzy:          a.MatchedFuzzy - b.MatchedFuzzy,
+		NotCaptured:           a.NotCaptured - b.NotCaptured,
+		Failed:                a.Failed - b.Failed,
+		FailedSettled:         a.FailedSettled - b.FailedSettled,
+		SplitGroups:           a.SplitGroups - b.SplitGroups,
+		AggregatedGroups:      a.AggregatedGroups - b.AggregatedGroups,
+		FeeOvercharges:        a.FeeOvercharges - b.FeeOvercharges,
+		DataQualityFindings:   a.DataQualityFindings - b.DataQualityFindings,
+		UnsettledAging: models.AgingBuckets{
+			Days0To3:   a.UnsettledAging.Days0To3 - b.UnsettledAging.Days0To3,
+			Days4To7:   a.UnsettledAging.Days4To7 - b.UnsettledAging.Days4To7,
+			Days8To14:  a.UnsettledAging.Days8To14 - b.UnsettledAging.Days8To14,
+			Days15To30: a.UnsettledAging.Days15To30 - b.UnsettledAging.Days15To30,
+			Over30:     a.UnsettledAging.Over30 - b.UnsettledAging.Over30,
+		},
+		ReconciliationRate:    a.ReconciliationRate - b.ReconciliationRate,
+		NativeTotals:          nativeTotalsDelta(a.NativeTotals, b.NativeTotals),
+		ReportingCurrency:     a.ReportingCurrency,
+		ReportingTotals:       totalsDelta(a.ReportingTotals, b.ReportingTotals),
+		UnconvertedCurrencies: a.UnconvertedCurrencies,
+	}
+}
+
+// totalsDelta returns a - b field by field.
+func totalsDelta(a, b models.AmountTotals) models.AmountTotals {
+	return models.AmountTotals{
+		ExpectedAmount: a.ExpectedAmount.Sub(b.ExpectedAmount),
+		SettledGross:   a.SettledGross.Sub(b.SettledGross),
+		SettledNet:     a.SettledNet.Sub(b.SettledNet),
+		VarianceAmount: a.VarianceAmount.Sub(b.VarianceAmount),
+		Fees:           a.Fees.Sub(b.Fees),
+		FeeOvercharge:  a.FeeOvercharge.Sub(b.FeeOvercharge),
+
+		FeeVariance:            a.FeeVariance.Sub(b.FeeVariance),
+		FXVariance:             a.FXVariance.Sub(b.FXVariance),
+		PartialCaptureVariance: a.PartialCaptureVariance.Sub(b.PartialCaptureVariance),
+		ResidualVariance:       a.ResidualVariance.Sub(b.ResidualVariance),
+	}
+}
+
+// nativeTotalsDelta returns the delta for every currency present on either side.
+func nativeTotalsDelta(a, b map[string]models.AmountTotals) map[string]models.AmountTotals {
+	out := make(map[string]models.AmountTotals, len(a))
+	for k, t := range a {
+		out[k] = totalsDelta(t, b[k])
+	}
+	for k, t := range b {
+		if _, ok := a[k]; !ok {
+			out[k] = totalsDelta(models.AmountTotals{}, t)
+		}
+	}
+	return out
+}
+
+// breakdownDelta returns the delta for every key present in either breakdown;
+// a key missing on one side counts as an all-zero summary.
+func breakdownDelta(a, b map[string]models.ReportSummary) map[string]models.ReportSummary {
+	out := make(map[string]models.ReportSummary, len(a))
+	for k, s := range a {
+		out[k] = summaryDelta(s, b[k])
+	}
+	for k, s := range b {
+		if _, ok := a[k]; !ok {
+			out[k] = summaryDelta(models.ReportSummary{}, s)
+		}
+	}
+	return out
+}
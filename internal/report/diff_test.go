@@ -0,0 +1,58 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestDiff(t *testing.T) {
+	against := &models.ReconciliationReport{
+		RunID: "RUN-0001",
+		Results: []models.ReconciliationResult{
+			{ID: "RR-RUN-0001-0001", TransactionID: "TXN-1", SettlementID: "S-1", Status: models.StatusMatched},
+			{ID: "RR-RUN-0001-0002", TransactionID: "TXN-2", Status: models.StatusUnsettled},
+			{ID: "RR-RUN-0001-0003", SettlementID: "S-3", Status: models.StatusUnexpectedSettlement},
+			{ID: "RR-RUN-0001-0004", TransactionID: "TXN-4", Status: models.StatusUnsettled},
+		},
+		Summary:    models.ReportSummary{Matched: 1, Unsettled: 2, UnexpectedSettlements: 1, ReportingTotals: models.AmountTotals{Fees: money.MustParse("1.50")}},
+		ByCurrency: map[string]models.ReportSummary{"MXN": {Matched: 1}, "COP": {Unsettled: 1}},
+	}
+	run := &models.ReconciliationReport{
+		RunID: "RUN-0002",
+		Results: []models.ReconciliationResult{
+			{ID: "RR-RUN-0002-0001", TransactionID: "TXN-1", SettlementID: "S-1", Status: models.StatusMatched},
+			{ID: "RR-RUN-0002-0002", TransactionID: "TXN-2", SettlementID: "S-2", Status: models.StatusMatched},
+			{ID: "RR-RUN-0002-0003", TransactionID: "TXN-3", SettlementID: "S-3", Status: models.StatusMatchedWithVariance},
+			{ID: "RR-RUN-0002-0004", SettlementID: "S-5", Status: models.StatusUnexpectedSettlement},
+		},
+		Summary:    models.ReportSummary{Matched: 2, MatchedWithVariance: 1, UnexpectedSettlements: 1, ReportingTotals: models.AmountTotals{Fees: money.MustParse("2")}},
+		ByCurrency: map[string]models.ReportSummary{"MXN": {Matched: 3}},
+	}
+
+	d := Diff(run, against)
+
+	if len(d.Changed) != 2 {
+		t.Fatalf("expected 2 changed items, got %d: %+v", len(d.Changed), d.Changed)
+	}
+	if c := d.Changed[0]; c.TransactionID != "TXN-2" || c.FromStatus != models.StatusUnsettled || c.ToStatus != models.StatusMatched {
+		t.Errorf("unexpected first change: %+v", c)
+	}
+	if c := d.Changed[1]; c.SettlementID != "S-3" || c.FromStatus != models.StatusUnexpectedSettlement || c.ToStatus != models.StatusMatchedWithVariance {
+		t.Errorf("unexpected second change: %+v", c)
+	}
+	if len(d.Added) != 1 || d.Added[0].SettlementID != "S-5" {
+		t.Errorf("expected S-5 added, got %+v", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].TransactionID != "TXN-4" {
+		t.Errorf("expected TXN-4 removed, got %+v", d.Removed)
+	}
+
+	if d.Summary.Matched != 1 || d.Summary.Unsettled != -2 || d.Summary.ReportingTotals.Fees != money.MustParse("0.50") {
+		t.Errorf("unexpected summary delta: %+v", d.Summary)
+	}
+	if d.ByCurrency["MXN"].Matched != 2 || d.ByCurrency["COP"].Unsettled != -1 {
+		t.Errorf("unexpected currency deltas: %+v", d.ByCurrency)
+	}
+}
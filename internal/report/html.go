@@ -0,0 +1,325 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// reconciledStatuses are the statuses that need no follow-up: settled as
+// expected, or not expected to settle at all. Every other result is a
+// discrepancy.
+var reconciledStatuses = map[models.ReconciliationStatus]bool{
+	models.StatusMatched:            true,
+	models.StatusRefunded:           true,
+	models.StatusChargeback:         true,
+	models.StatusChargebackReversed: true,
+	models.StatusNotCaptured:        true,
+	models.StatusFailed:             true,
+}
+
+// htmlMaxDiscrepancies is how many discrepancies, in result order, an HTML
+// report lists. The rest are left to the paginated results endpoint.
+const htmlMaxDiscrepancies = 200
+
+// summaryCard is one headline figure of a rendered report.
+type summaryCard struct {
+	Label string
+	Value string
+	Note  string
+	Alert bool // the figure needs attention
+}
+
+// breakdownView is one breakdown table of a rendered report. Amounts are
+// native per currency for the currency breakdown and in the reporting
+// currency for the others, which mix currencies.
+type breakdownView struct {
+	Title    string
+	Section  string
+	KeyLabel string
+	Currency string // currency of the amounts; empty when each row has its own
+	Rows     []breakdownViewRow
+}
+
+type breakdownViewRow struct {
+	Key      string
+	Summary  models.ReportSummary
+	Currency string // currency of Expected and Variance
+	Expected money.Amount
+	Variance money.Amount
+}
+
+// htmlView is what the HTML report template renders.
+type htmlView struct {
+	Report        *models.ReconciliationReport
+	Cards         []summaryCard
+	Processors    []breakdownViewRow
+	Breakdowns    []breakdownView
+	Discrepancies []models.ReconciliationResult
+	// DiscrepancyCount counts every discrepancy, listed or not, and
+	// DiscrepanciesURL queries all of them from the results endpoint.
+	DiscrepancyCount int
+	DiscrepanciesURL string
+}
+
+// WriteHTML renders a report as a self-contained HTML page: headline cards,
+// reconciliation-rate bars per processor, the breakdowns, a sortable table of
+// discrepancies and the high-priority discrepancies. It prints as a board
+// pack, without the interactive parts.
+func WriteHTML(w io.Writer, rep *models.ReconciliationReport) error {
+	return htmlReport.Execute(w, newHTMLView(rep))
+}
+
+func newHTMLView(rep *models.ReconciliationReport) htmlView {
+	v := htmlView{Report: rep, Cards: summaryCards(rep), Breakdowns: breakdownViews(rep)}
+	for _, b := range v.Breakdowns {
+		if b.Section == SectionByProcessor {
+			v.Processors = b.Rows
+		}
+	}
+	for _, res := range rep.Results {
+		if reconciledStatuses[res.Status] {
+			continue
+		}
+		if v.DiscrepancyCount < htmlMaxDiscrepancies {
+			v.Discrepancies = append(v.Discrepancies, res)
+		}
+		v.DiscrepancyCount++
+	}
+	var statuses []string
+	for _, st := range models.ReconciliationStatuses {
+		if !reconciledStatuses[st] {
+			statuses = append(statuses, string(st))
+		}
+	}
+	v.DiscrepanciesURL = "/api/v1/reconciliation/runs/" + url.PathEscape(rep.RunID) + "/results?status=" + strings.Join(statuses, ",")
+	return v
+}
+
+// summaryCards are the headline figures of a report, amounts in the
+// reporting currency.
+func summaryCards(rep *models.ReconciliationReport) []summaryCard {
+	s := rep.Summary
+	reporting := s.ReportingCurrency
+	variance := summaryCard{Label: "Variance", Value: formatAmount(s.ReportingTotals.VarianceAmount, reporting) + " " + reporting,
+		Alert: !s.ReportingTotals.VarianceAmount.IsZero(), Note: fmt.Sprintf("fees %s %s", formatAmount(s.ReportingTotals.Fees, reporting), reporting)}
+	if len(s.UnconvertedCurrencies) > 0 {
+		variance.Note += fmt.Sprintf("; %s not converted", strings.Join(s.UnconvertedCurrencies, ", "))
+	}
+	return []summaryCard{
+		{Label: "Reconciliation rate", Value: fmt.Sprintf("%.1f%%", s.ReconciliationRate)},
+		{Label: "Matched", Value: fmt.Sprint(s.Matched + s.MatchedWithVariance + s.MatchedFuzzy),
+			Note: fmt.Sprintf("%d with variance, %d fuzzy", s.MatchedWithVariance, s.MatchedFuzzy)},
+		{Label: "Unsettled", Value: fmt.Sprint(s.Unsettled), Alert: s.Unsettled > 0,
+			Note: fmt.Sprintf("%d outstanding over 30 days", s.UnsettledAging.Over30)},
+		{Label: "Unexpected settlements", Value: fmt.Sprint(s.UnexpectedSettlements), Alert: s.UnexpectedSettlements > 0},
+		{Label: "Duplicates", Value: fmt.Sprint(s.Duplicates), Alert: s.Duplicates > 0},
+		{Label: "Expected", Value: formatAmount(s.ReportingTotals.ExpectedAmount, reporting) + " " + reporting},
+		variance,
+		{Label: "High priority", Value: fmt.Sprint(len(rep.HighPriority)), Alert: len(rep.HighPriority) > 0},
+		{Label: "Data-quality findings", Value: fmt.Sprint(s.DataQualityFindings), Alert: s.DataQualityFindings > 0},
+	}
+}
+
+// breakdownViews are the currency, country and processor breakdowns of a
+// report, rows in key order.
+func breakdownViews(rep *models.ReconciliationReport) []breakdownView {
+	var views []breakdownView
+	for _, section := range []string{SectionByCurrency, SectionByCountry, SectionByProcessor} {
+		key, b, _ := breakdown(rep, section)
+		v := breakdownView{Title: sheetName(section), Section: section, KeyLabel: key, Currency: rep.Summary.ReportingCurrency}
+		if section == SectionByCurrency {
+			v.Currency = ""
+		}
+		for _, k := range slices.Sorted(maps.Keys(b)) {
+			row := breakdownViewRow{Key: k, Summary: b[k], Currency: v.Currency, Expected: b[k].ReportingTotals.ExpectedAmount, Variance: b[k].ReportingTotals.VarianceAmount}
+			if section == SectionByCurrency {
+				row.Currency, row.Expected, row.Variance = k, b[k].NativeTotals[k].ExpectedAmount, b[k].NativeTotals[k].VarianceAmount
+			}
+			v.Rows = append(v.Rows, row)
+		}
+		views = append(views, v)
+	}
+	return views
+}
+
+// formatAmount formats an amount for reading, rounded to the minor unit of its
+// currency and with thousands separators, as the xlsx amount formats show it:
+// "1,234.50", "5,000" for yen.
+func formatAmount(a money.Amount, currency string) string {
+	s := a.StringIn(currency)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct":    func(f float64) string { return fmt.Sprintf("%.1f", f) },
+	"amount": formatAmount,
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02")
+	},
+	"datetime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(htmlReportTemplate))
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Reconciliation report {{.Report.RunID}}</title>
+<style>
+  *, *::before, *::after { box-sizing: border-box; margin: 0; padding: 0; }
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; color: #1f2937; background: #f9fafb; line-height: 1.5; padding: 2rem; max-width: 1200px; margin: 0 auto; }
+  h1 { font-size: 1.6rem; }
+  h2 { font-size: 1.15rem; margin: 2rem 0 0.75rem; padding-bottom: 0.35rem; border-bottom: 1px solid #e5e7eb; }
+  .meta { color: #6b7280; font-size: 0.9rem; margin-bottom: 1.5rem; }
+  .cards { display: grid; grid-template-columns: repeat(auto-fill, minmax(170px, 1fr)); gap: 0.75rem; }
+  .card { background: #fff; border: 1px solid #e5e7eb; border-radius: 8px; padding: 0.85rem 1rem; }
+  .card .label { color: #6b7280; font-size: 0.75rem; text-transform: uppercase; letter-spacing: 0.04em; }
+  .card .value { font-size: 1.4rem; font-weight: 600; font-variant-numeric: tabular-nums; }
+  .card .note { color: #6b7280; font-size: 0.78rem; }
+  .card.alert { border-left: 4px solid #dc2626; }
+  .bars { background: #fff; border: 1px solid #e5e7eb; border-radius: 8px; padding: 0.75rem 1rem; }
+  .bar-row { display: grid; grid-template-columns: 180px 1fr 60px; align-items: center; gap: 0.75rem; padding: 0.25rem 0; font-size: 0.85rem; }
+  .bar { background: #e5e7eb; border-radius: 4px; height: 0.8rem; overflow: hidden; }
+  .bar span { display: block; height: 100%; background: #16a34a; }
+  .bar-row .rate { text-align: right; font-variant-numeric: tabular-nums; }
+  table { width: 100%; border-collapse: collapse; background: #fff; font-size: 0.8rem; }
+  th, td { text-align: left; padding: 0.4rem 0.6rem; border-bottom: 1px solid #e5e7eb; vertical-align: top; }
+  th { background: #f3f4f6; font-size: 0.72rem; text-transform: uppercase; letter-spacing: 0.04em; color: #4b5563; }
+  td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; white-space: nowrap; }
+  table.sortable th { cursor: pointer; user-select: none; }
+  table.sortable th::after { content: " \2195"; color: #9ca3af; }
+  table.sortable th[aria-sort=ascending]::after { content: " \2191"; color: #1f2937; }
+  table.sortable th[aria-sort=descending]::after { content: " \2193"; color: #1f2937; }
+  .status { font-family: "SF Mono", "Fira Code", monospace; font-size: 0.75rem; }
+  .negative { color: #b91c1c; }
+  .empty { color: #6b7280; font-style: italic; }
+  @media print {
+    body { background: #fff; padding: 0; max-width: none; font-size: 10pt; }
+    .cards { grid-template-columns: repeat(3, 1fr); }
+    .card, .bars { break-inside: avoid; }
+    h2 { break-after: avoid; }
+    tr { break-inside: avoid; }
+    thead { display: table-header-group; }
+    table.sortable th { cursor: auto; }
+    table.sortable th::after { content: none; }
+    .bar span { -webkit-print-color-adjust: exact; print-color-adjust: exact; }
+  }
+</style>
+</head>
+<body>
+
+<h1>Reconciliation report {{.Report.RunID}}</h1>
+<p class="meta">Generated {{datetime .Report.GeneratedAt}} · unsettled transactions aged as of {{datetime .Report.AsOf}} · {{.Report.Summary.TotalTransactions}} transactions, {{.Report.Summary.TotalSettlements}} settlement lines</p>
+
+<section>
+<h2>Summary</h2>
+<div class="cards">
+{{- range .Cards}}
+  <div class="card{{if .Alert}} alert{{end}}"><div class="label">{{.Label}}</div><div class="value">{{.Value}}</div>{{if .Note}}<div class="note">{{.Note}}</div>{{end}}</div>
+{{- end}}
+</div>
+</section>
+
+<section>
+<h2>Reconciliation rate by processor</h2>
+<div class="bars">
+{{- range .Processors}}
+  <div class="bar-row"><div>{{.Key}}</div><div class="bar"><span style="width: {{pct .Summary.ReconciliationRate}}%"></span></div><div class="rate">{{pct .Summary.ReconciliationRate}}%</div></div>
+{{- else}}
+  <p class="empty">No results.</p>
+{{- end}}
+</div>
+</section>
+
+{{range .Breakdowns}}
+<section>
+<h2>{{.Title}}</h2>
+<table>
+  <thead><tr><th>{{.KeyLabel}}</th><th class="num">Matched</th><th class="num">With variance</th><th class="num">Fuzzy</th><th class="num">Unsettled</th><th class="num">Unexpected</th><th class="num">Duplicates</th><th class="num">Expected{{if .Currency}} ({{.Currency}}){{end}}</th><th class="num">Variance{{if .Currency}} ({{.Currency}}){{end}}</th><th class="num">Rate</th></tr></thead>
+  <tbody>
+  {{- range .Rows}}
+    <tr><td>{{.Key}}</td><td class="num">{{.Summary.Matched}}</td><td class="num">{{.Summary.MatchedWithVariance}}</td><td class="num">{{.Summary.MatchedFuzzy}}</td><td class="num">{{.Summary.Unsettled}}</td><td class="num">{{.Summary.UnexpectedSettlements}}</td><td class="num">{{.Summary.Duplicates}}</td><td class="num">{{amount .Expected .Currency}}</td><td class="num{{if lt .Variance.Sign 0}} negative{{end}}">{{amount .Variance .Currency}}</td><td class="num">{{pct .Summary.ReconciliationRate}}%</td></tr>
+  {{- end}}
+  </tbody>
+</table>
+</section>
+{{end}}
+
+<section>
+<h2>High-priority discrepancies ({{len .Report.HighPriority}})</h2>
+{{template "results" .Report.HighPriority}}
+</section>
+
+<section>
+{{- if lt (len .Discrepancies) .DiscrepancyCount}}
+<h2>First {{len .Discrepancies}} of {{.DiscrepancyCount}} discrepancies</h2>
+<p class="meta">The rest are listed by the <a href="{{.DiscrepanciesURL}}">results endpoint</a>.</p>
+{{- else}}
+<h2>All discrepancies ({{.DiscrepancyCount}})</h2>
+{{- end}}
+{{template "results" .Discrepancies}}
+</section>
+
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, col) {
+    th.addEventListener("click", function () {
+      var ascending = th.getAttribute("aria-sort") !== "ascending";
+      table.querySelectorAll("th").forEach(function (other) { other.removeAttribute("aria-sort"); });
+      th.setAttribute("aria-sort", ascending ? "ascending" : "descending");
+      var body = table.tBodies[0];
+      var value = function (row) {
+        var cell = row.cells[col];
+        return cell.hasAttribute("data-value") ? cell.getAttribute("data-value") : cell.textContent.trim();
+      };
+      Array.from(body.rows).sort(function (a, b) {
+        var x = value(a), y = value(b);
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var order = !isNaN(nx) && !isNaN(ny) ? nx - ny : x.localeCompare(y);
+        return ascending ? order : -order;
+      }).forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+
+{{define "results"}}
+{{- if .}}
+<table class="sortable">
+  <thead><tr><th>Transaction</th><th>Settlement</th><th>Processor</th><th>Status</th><th class="num">Expected</th><th class="num">Settled gross</th><th class="num">Variance</th><th>Currency</th><th>Settled</th><th class="num">Days</th><th>Notes</th></tr></thead>
+  <tbody>
+  {{- range .}}
+    <tr><td>{{.TransactionID}}</td><td>{{.SettlementID}}</td><td>{{.ProcessorName}}</td><td class="status">{{.Status}}</td><td class="num" data-value="{{.ExpectedAmount}}">{{amount .ExpectedAmount .Currency}}</td><td class="num" data-value="{{.SettledGrossAmount}}">{{amount .SettledGrossAmount .Currency}}</td><td class="num{{if lt .VarianceAmount.Sign 0}} negative{{end}}" data-value="{{.VarianceAmount}}">{{amount .VarianceAmount .Currency}}</td><td>{{.Currency}}</td><td>{{date .SettledAt}}</td><td class="num">{{if .DaysToSettle}}{{.DaysToSettle}}{{else if .DaysOutstanding}}{{.DaysOutstanding}}{{end}}</td><td>{{.Notes}}</td></tr>
+  {{- end}}
+  </tbody>
+</table>
+{{- else}}
+<p class="empty">None.</p>
+{{- end}}
+{{end}}
+`
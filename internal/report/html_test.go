@@ -0,0 +1,103 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestWriteHTML(t *testing.T) {
+	rep := &models.ReconciliationReport{
+		RunID:       "RUN-0001",
+		GeneratedAt: time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC),
+		AsOf:        time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC),
+		Summary: models.ReportSummary{
+			Matched: 1, Unsettled: 1, ReconciliationRate: 50, ReportingCurrency: "USD",
+			ReportingTotals: models.AmountTotals{VarianceAmount: money.MustParse("-2.5")},
+		},
+		ByCurrency:  map[string]models.ReportSummary{"MXN": {Matched: 1, NativeTotals: map[string]models.AmountTotals{"MXN": {VarianceAmount: money.MustParse("-42")}}}},
+		ByProcessor: map[string]models.ReportSummary{"stripe": {Matched: 1, Unsettled: 1, ReconciliationRate: 50}},
+		Results: []models.ReconciliationResult{
+			{ID: "RR-1", TransactionID: "TXN-MATCHED", Status: models.StatusMatched, ProcessorName: "stripe", Currency: "MXN"},
+			{ID: "RR-2", TransactionID: "TXN-OPEN", Status: models.StatusUnsettled, ProcessorName: "stripe", ExpectedAmount: money.MustParse("5000"), Currency: "JPY",
+				Notes: `<script>alert("x")</script>`},
+		},
+	}
+	rep.HighPriority = rep.Results[1:]
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>Reconciliation report RUN-0001</title>",
+		`<div class="value">50.0%</div>`,
+		`<div class="value">-2.50 USD</div>`,
+		`<span style="width: 50.0%">`,
+		`<td class="num negative">-42.00</td>`,
+		"High-priority discrepancies (1)",
+		"All discrepancies (1)",
+		`data-value="5000.00">5,000</td>`,
+		"&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;",
+		"@media print",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	// Matched results are not discrepancies, and notes must be escaped.
+	if strings.Contains(out, "TXN-MATCHED") {
+		t.Error("matched result listed as a discrepancy")
+	}
+	if strings.Contains(out, `<script>alert`) {
+		t.Error("notes not escaped")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount, currency, want string
+	}{
+		{"1234.5", "MXN", "1,234.50"},
+		{"-1234567.891", "USD", "-1,234,567.89"},
+		{"5000", "JPY", "5,000"},
+		{"4999.5", "JPY", "5,000"},
+		{"12.3456", "KWD", "12.346"},
+		{"0", "", "0.00"},
+		{"-0.004", "USD", "0.00"},
+	}
+	for _, tt := range tests {
+		if got := formatAmount(money.MustParse(tt.amount), tt.currency); got != tt.want {
+			t.Errorf("formatAmount(%s, %q) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestWriteHTMLCapsDiscrepancies(t *testing.T) {
+	rep := &models.ReconciliationReport{RunID: "RUN-0001"}
+	for i := range htmlMaxDiscrepancies + 1 {
+		rep.Results = append(rep.Results, models.ReconciliationResult{ID: fmt.Sprintf("RR-%d", i), TransactionID: fmt.Sprintf("TXN-%d", i), Status: models.StatusUnsettled})
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "First 200 of 201 discrepancies") {
+		t.Error("expected the table to be capped")
+	}
+	if !strings.Contains(out, `href="/api/v1/reconciliation/runs/RUN-0001/results?status=matched_with_variance,unsettled,`) {
+		t.Error("missing link to the results endpoint")
+	}
+	if !strings.Contains(out, ">TXN-199<") || strings.Contains(out, ">TXN-200<") {
+		t.Error("expected the first 200 discrepancies only")
+	}
+}
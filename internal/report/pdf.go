@@ -0,0 +1,298 @@
+package report
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// pdfTopHighPriority is how many high-priority discrepancies, largest variance
+// in the reporting currency first, a PDF report lists.
+const pdfTopHighPriority = 25
+
+// A4 page geometry, in points.
+const (
+	pdfWidth   = 595
+	pdfHeight  = 842
+	pdfMargin  = 40
+	pdfFooter  = 24 // space kept free for the page footer
+	pdfRowSize = 8  // font size of table rows
+	pdfRowStep = 14 // height of a table row
+)
+
+// pdfStatusSeries are the result counts stacked in the per-processor chart.
+var pdfStatusSeries = []struct {
+	label string
+	color pdfColor
+	count func(models.ReportSummary) int
+}{
+	{"Matched", pdfColor{0.09, 0.64, 0.29}, func(s models.ReportSummary) int { return s.Matched }},
+	{"With variance", pdfColor{0.96, 0.62, 0.04}, func(s models.ReportSummary) int { return s.MatchedWithVariance }},
+	{"Fuzzy", pdfColor{0.23, 0.51, 0.96}, func(s models.ReportSummary) int { return s.MatchedFuzzy }},
+	{"Unsettled", pdfColor{0.86, 0.15, 0.15}, func(s models.ReportSummary) int { return s.Unsettled }},
+	{"Unexpected", pdfColor{0.58, 0.2, 0.92}, func(s models.ReportSummary) int { return s.UnexpectedSettlements }},
+	{"Duplicates", pdfColor{0.42, 0.45, 0.5}, func(s models.ReportSummary) int { return s.Duplicates }},
+}
+
+// pdfColumn is one column of a PDF table.
+type pdfColumn struct {
+	title string
+	width float64
+	right bool // right-aligned, for numbers
+}
+
+// pdfLayout places blocks top to bottom, starting a new page when one does
+// not fit.
+type pdfLayout struct {
+	doc  *pdfDoc
+	page *pdfPage
+	y    float64 // top of the next block
+}
+
+// WritePDF writes a report as an A4 PDF for a board pack: the headline
+// figures, reconciliation-rate and result charts per processor, the currency,
+// country and processor breakdowns and the largest high-priority
+// discrepancies. The document only depends on the report, so the same report
+// always gives the same bytes.
+func WritePDF(w io.Writer, rep *models.ReconciliationReport) error {
+	title := "Reconciliation report " + rep.RunID
+	l := &pdfLayout{doc: &pdfDoc{title: title, created: rep.GeneratedAt}}
+	l.newPage()
+
+	l.page.text(pdfMargin, l.y-18, fontBold, 18, colorText, title)
+	l.y -= 34
+	l.page.text(pdfMargin, l.y-9, fontRegular, 9, colorMuted, fmt.Sprintf(
+		"Generated %s · unsettled transactions aged as of %s · %d transactions, %d settlement lines",
+		rep.GeneratedAt.UTC().Format("2006-01-02 15:04 UTC"), rep.AsOf.UTC().Format("2006-01-02"),
+		rep.Summary.TotalTransactions, rep.Summary.TotalSettlements))
+	l.y -= 20
+
+	l.heading("Summary")
+	l.cards(summaryCards(rep))
+
+	views := breakdownViews(rep)
+	var processors []breakdownViewRow
+	for _, v := range views {
+		if v.Section == SectionByProcessor {
+			processors = v.Rows
+		}
+	}
+	l.heading("Reconciliation rate by processor")
+	l.rateChart(processors)
+	l.heading("Results by processor")
+	l.statusChart(processors)
+
+	for _, v := range views {
+		l.heading(v.Title)
+		l.breakdownTable(v)
+	}
+
+	top := rep.HighPriority[:min(len(rep.HighPriority), pdfTopHighPriority)]
+	if len(top) < len(rep.HighPriority) {
+		l.heading(fmt.Sprintf("Top %d of %d high-priority discrepancies", len(top), len(rep.HighPriority)))
+	} else {
+		l.heading(fmt.Sprintf("High-priority discrepancies (%d)", len(top)))
+	}
+	l.discrepancyTable(top)
+
+	for i, p := range l.doc.pages {
+		p.line(pdfMargin, pdfMargin-6, pdfWidth-pdfMargin, pdfMargin-6, colorRule)
+		p.text(pdfMargin, pdfMargin-16, fontRegular, 8, colorMuted, title)
+		p.textRight(pdfWidth-pdfMargin, pdfMargin-16, fontRegular, 8, colorMuted, fmt.Sprintf("Page %d of %d", i+1, len(l.doc.pages)))
+	}
+	return l.doc.write(w, pdfWidth, pdfHeight)
+}
+
+func (l *pdfLayout) newPage() {
+	l.page = l.doc.addPage()
+	l.y = pdfHeight - pdfMargin
+}
+
+// ensure starts a new page unless h more points fit on this one.
+func (l *pdfLayout) ensure(h float64) {
+	if l.y-h < pdfMargin+pdfFooter {
+		l.newPage()
+	}
+}
+
+// heading starts a section. It keeps room for a few lines after it, so that a
+// heading is not left alone at the bottom of a page.
+func (l *pdfLayout) heading(s string) {
+	l.ensure(34 + 3*pdfRowStep)
+	if l.y < pdfHeight-pdfMargin {
+		l.y -= 10
+	}
+	l.page.text(pdfMargin, l.y-12, fontBold, 12, colorText, s)
+	l.page.line(pdfMargin, l.y-17, pdfWidth-pdfMargin, l.y-17, colorRule)
+	l.y -= 24
+}
+
+// cards draws the headline figures as a grid of three columns.
+func (l *pdfLayout) cards(cards []summaryCard) {
+	const columns, gap, height = 3, 8.0, 46.0
+	width := (pdfWidth - 2*pdfMargin - (columns-1)*gap) / columns
+	for i, c := range cards {
+		if i%columns == 0 {
+			if i > 0 {
+				l.y -= height + gap
+			}
+			l.ensure(height)
+		}
+		x := pdfMargin + float64(i%columns)*(width+gap)
+		l.page.fillRect(x, l.y-height, width, height, colorHeader)
+		if c.Alert {
+			l.page.fillRect(x, l.y-height, 3, height, colorAlert)
+		}
+		l.page.text(x+10, l.y-13, fontRegular, 7, colorMuted, c.Label)
+		l.page.text(x+10, l.y-29, fontBold, 14, colorText, fitText(fontBold, 14, width-20, c.Value))
+		if c.Note != "" {
+			l.page.text(x+10, l.y-40, fontRegular, 7, colorMuted, fitText(fontRegular, 7, width-20, c.Note))
+		}
+	}
+	l.y -= height + gap
+}
+
+// rateChart draws one bar per processor, as long as its reconciliation rate.
+func (l *pdfLayout) rateChart(rows []breakdownViewRow) {
+	const label, value = 130.0, 40.0
+	track := pdfWidth - 2*pdfMargin - label - value
+	if len(rows) == 0 {
+		l.empty()
+		return
+	}
+	for _, row := range rows {
+		l.ensure(pdfRowStep)
+		rate := row.Summary.ReconciliationRate
+		l.page.text(pdfMargin, l.y-10, fontRegular, pdfRowSize, colorText, fitText(fontRegular, pdfRowSize, label-8, row.Key))
+		l.page.fillRect(pdfMargin+label, l.y-10, track, 8, colorRule)
+		l.page.fillRect(pdfMargin+label, l.y-10, track*min(max(rate, 0), 100)/100, 8, pdfStatusSeries[0].color)
+		l.page.textRight(pdfWidth-pdfMargin, l.y-10, fontRegular, pdfRowSize, colorText, fmt.Sprintf("%.1f%%", rate))
+		l.y -= pdfRowStep
+	}
+}
+
+// statusChart draws one bar per processor split into its result counts, with
+// a legend.
+func (l *pdfLayout) statusChart(rows []breakdownViewRow) {
+	const label, value = 130.0, 40.0
+	track := pdfWidth - 2*pdfMargin - label - value
+	if len(rows) == 0 {
+		l.empty()
+		return
+	}
+	l.ensure(pdfRowStep)
+	x := pdfMargin + label
+	for _, series := range pdfStatusSeries {
+		l.page.fillRect(x, l.y-9, 7, 7, series.color)
+		l.page.text(x+10, l.y-9, fontRegular, 7, colorMuted, series.label)
+		x += 18 + textWidth(fontRegular, 7, series.label)
+	}
+	l.y -= pdfRowStep
+	for _, row := range rows {
+		l.ensure(pdfRowStep)
+		total := 0
+		for _, series := range pdfStatusSeries {
+			total += series.count(row.Summary)
+		}
+		l.page.text(pdfMargin, l.y-10, fontRegular, pdfRowSize, colorText, fitText(fontRegular, pdfRowSize, label-8, row.Key))
+		l.page.fillRect(pdfMargin+label, l.y-10, track, 8, colorRule)
+		x, seen := pdfMargin+label, 0
+		for _, series := range pdfStatusSeries {
+			if n := series.count(row.Summary); n > 0 {
+				// Place each segment from the running count, so the
+				// segments always end exactly at the end of the track.
+				from, to := track*float64(seen)/float64(total), track*float64(seen+n)/float64(total)
+				l.page.fillRect(x+from, l.y-10, to-from, 8, series.color)
+				seen += n
+			}
+		}
+		l.page.textRight(pdfWidth-pdfMargin, l.y-10, fontRegular, pdfRowSize, colorText, fmt.Sprint(total))
+		l.y -= pdfRowStep
+	}
+}
+
+func (l *pdfLayout) breakdownTable(v breakdownView) {
+	currency := ""
+	if v.Currency != "" {
+		currency = " (" + v.Currency + ")"
+	}
+	cols := []pdfColumn{
+		{v.KeyLabel, 79, false}, {"Matched", 42, true}, {"Variance", 42, true}, {"Fuzzy", 34, true},
+		{"Unsettled", 44, true}, {"Unexpected", 48, true}, {"Dupl.", 30, true},
+		{"Expected" + currency, 80, true}, {"Variance" + currency, 76, true}, {"Rate", 40, true},
+	}
+	var rows [][]string
+	for _, r := range v.Rows {
+		s := r.Summary
+		rows = append(rows, []string{r.Key, fmt.Sprint(s.Matched), fmt.Sprint(s.MatchedWithVariance), fmt.Sprint(s.MatchedFuzzy),
+			fmt.Sprint(s.Unsettled), fmt.Sprint(s.UnexpectedSettlements), fmt.Sprint(s.Duplicates),
+			formatAmount(r.Expected, r.Currency), formatAmount(r.Variance, r.Currency), fmt.Sprintf("%.1f%%", s.ReconciliationRate)})
+	}
+	l.table(cols, rows)
+}
+
+func (l *pdfLayout) discrepancyTable(results []models.ReconciliationResult) {
+	cols := []pdfColumn{
+		{"Transaction", 62, false}, {"Settlement", 62, false}, {"Processor", 58, false}, {"Status", 74, false},
+		{"Expected", 56, true}, {"Variance", 52, true}, {"Cur.", 26, false}, {"Days", 26, true}, {"Notes", 99, false},
+	}
+	var rows [][]string
+	for _, r := range results {
+		days := optionalInt(r.DaysToSettle)
+		if days == "" {
+			days = optionalInt(r.DaysOutstanding)
+		}
+		rows = append(rows, []string{r.TransactionID, r.SettlementID, r.ProcessorName, string(r.Status),
+			formatAmount(r.ExpectedAmount, r.Currency), formatAmount(r.VarianceAmount, r.Currency), r.Currency, days, r.Notes})
+	}
+	l.table(cols, rows)
+}
+
+// table draws a table with a shaded header row, repeated on every page the
+// table runs onto. Cells are cut to fit their column.
+func (l *pdfLayout) table(cols []pdfColumn, rows [][]string) {
+	if len(rows) == 0 {
+		l.empty()
+		return
+	}
+	header := func() {
+		l.ensure(2 * pdfRowStep)
+		l.page.fillRect(pdfMargin, l.y-pdfRowStep, pdfWidth-2*pdfMargin, pdfRowStep, colorHeader)
+		l.row(cols, nil, fontBold)
+	}
+	header()
+	for _, cells := range rows {
+		if l.y-pdfRowStep < pdfMargin+pdfFooter {
+			l.newPage()
+			header()
+		}
+		l.row(cols, cells, fontRegular)
+		l.page.line(pdfMargin, l.y, pdfWidth-pdfMargin, l.y, colorRule)
+	}
+}
+
+// row draws one table row, or the header row when cells is nil.
+func (l *pdfLayout) row(cols []pdfColumn, cells []string, font pdfFont) {
+	x := float64(pdfMargin)
+	for i, c := range cols {
+		s := c.title
+		if cells != nil {
+			s = cells[i]
+		}
+		s = fitText(font, pdfRowSize, c.width-8, s)
+		if c.right {
+			l.page.textRight(x+c.width-4, l.y-10, font, pdfRowSize, colorText, s)
+		} else {
+			l.page.text(x+4, l.y-10, font, pdfRowSize, colorText, s)
+		}
+		x += c.width
+	}
+	l.y -= pdfRowStep
+}
+
+func (l *pdfLayout) empty() {
+	l.ensure(pdfRowStep)
+	l.page.text(pdfMargin, l.y-10, fontRegular, pdfRowSize, colorMuted, "None.")
+	l.y -= pdfRowStep
+}
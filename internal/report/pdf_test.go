@@ -0,0 +1,149 @@
+package report
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func pdfTestReport() *models.ReconciliationReport {
+	settledAt := time.Date(2025, 1, 17, 12, 0, 0, 0, time.UTC)
+	days := 3
+	rep := &models.ReconciliationReport{
+		RunID:       "RUN-0007",
+		GeneratedAt: time.Date(2025, 2, 1, 9, 30, 0, 0, time.UTC),
+		AsOf:        time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		Summary: models.ReportSummary{
+			TotalTransactions: 40, TotalSettlements: 38, Matched: 30, MatchedWithVariance: 4, Unsettled: 3,
+			UnexpectedSettlements: 2, Duplicates: 1, ReconciliationRate: 85, ReportingCurrency: "USD",
+			ReportingTotals: models.AmountTotals{ExpectedAmount: money.MustParse("12500.4"), VarianceAmount: money.MustParse("-310.25"), Fees: money.MustParse("301")},
+		},
+		ByCurrency: map[string]models.ReportSummary{
+			"BRL": {Matched: 10, Unsettled: 1, ReconciliationRate: 90.9, NativeTotals: map[string]models.AmountTotals{"BRL": {ExpectedAmount: money.MustParse("4000"), VarianceAmount: money.MustParse("-120")}}},
+			"MXN": {Matched: 20, MatchedWithVariance: 4, Unsettled: 2, ReconciliationRate: 83.3, NativeTotals: map[string]models.AmountTotals{"MXN": {ExpectedAmount: money.MustParse("150000"), VarianceAmount: money.MustParse("-3500.5")}}},
+		},
+		ByCountry: map[string]models.ReportSummary{
+			"BR": {Matched: 10, Unsettled: 1, ReconciliationRate: 90.9},
+			"MX": {Matched: 20, MatchedWithVariance: 4, Unsettled: 2, ReconciliationRate: 83.3},
+		},
+		ByProcessor: map[string]models.ReportSummary{
+			"BrazilConnect": {Matched: 10, Unsettled: 1, Duplicates: 1, ReconciliationRate: 83.3},
+			"PaySureMX":     {Matched: 20, MatchedWithVariance: 4, Unsettled: 2, UnexpectedSettlements: 2, ReconciliationRate: 71.4},
+		},
+	}
+	for i := range 30 {
+		rep.HighPriority = append(rep.HighPriority, models.ReconciliationResult{
+			TransactionID: fmt.Sprintf("TXN-%04d", i+1), SettlementID: fmt.Sprintf("STL-%04d", i+1), ProcessorName: "PaySureMX",
+			Status: models.StatusMatchedWithVariance, ExpectedAmount: money.MustParse("1000"), VarianceAmount: money.MustParse(fmt.Sprint(-300 + i)),
+			Currency: "MXN", SettledAt: &settledAt, DaysToSettle: &days, Notes: "Fee (3.5%) above São Paulo schedule — check with processor",
+		})
+	}
+	return rep
+}
+
+// TestWritePDFGolden compares the PDF of a fixed report to
+// testdata/report.golden.pdf. Run with -update to regenerate it after an
+// intended change.
+func TestWritePDFGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, pdfTestReport()); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	golden := filepath.Join("testdata", "report.golden.pdf")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update if intended)", golden)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := WritePDF(&first, pdfTestReport()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePDF(&second, pdfTestReport()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("the same report gave different PDFs")
+	}
+	out := first.String()
+
+	if !strings.HasPrefix(out, "%PDF-1.4\n") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatal("missing PDF header or trailer")
+	}
+	// Every cross-reference entry must point at its object.
+	xref, err := strconv.Atoi(regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)[1])
+	if err != nil || !strings.HasPrefix(out[xref:], "xref\n") {
+		t.Fatalf("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(out[off:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, out[off:off+10])
+		}
+	}
+
+	// The page tree must point at the pages, and each page at its content.
+	object := func(ref string) string {
+		n, _ := strconv.Atoi(ref)
+		off, _ := strconv.Atoi(entries[n-1][1])
+		return out[off:]
+	}
+	kids := regexp.MustCompile(`/Kids \[ ((?:\d+ 0 R )+)\]`).FindStringSubmatch(out)
+	if kids == nil {
+		t.Fatal("missing page tree")
+	}
+	for _, ref := range strings.Fields(strings.ReplaceAll(kids[1], "0 R", "")) {
+		page := object(ref)
+		if !strings.Contains(page[:strings.Index(page, "endobj")], "/Type /Page ") {
+			t.Fatalf("page tree kid %s is not a page", ref)
+		}
+		contents := regexp.MustCompile(`/Contents (\d+) 0 R`).FindStringSubmatch(page)[1]
+		if !strings.Contains(object(contents)[:40], "stream") {
+			t.Errorf("contents %s of page %s is not a stream", contents, ref)
+		}
+	}
+
+	for _, want := range []string{
+		"/CreationDate (D:20250201093000Z)",
+		"(Top 25 of 30 high-priority discrepancies)",
+		"(TXN-0025)",
+		`(Fee \(3.5%\) above S\343o \205)`, // escaped parentheses, WinAnsi ã, cut with an ellipsis
+		"(-310.25 USD)",
+		"(Page 1 of ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	if strings.Contains(out, "(TXN-0026)") {
+		t.Error("listed more than the top high-priority discrepancies")
+	}
+}
@@ -0,0 +1,228 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal PDF 1.4 writer: pages of text, filled rectangles and lines in the
+// standard Helvetica fonts, which every reader has, so nothing is embedded.
+// Streams are not compressed, which keeps the output identical across Go
+// versions and readable in a diff.
+
+// pdfFont is one of the standard fonts a page can use.
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+)
+
+var pdfFontNames = [...]string{fontRegular: "Helvetica", fontBold: "Helvetica-Bold"}
+
+// pdfColor is an RGB color, each component 0-1.
+type pdfColor [3]float64
+
+var (
+	colorText   = pdfColor{0.12, 0.16, 0.22}
+	colorMuted  = pdfColor{0.42, 0.45, 0.50}
+	colorRule   = pdfColor{0.90, 0.91, 0.92}
+	colorHeader = pdfColor{0.95, 0.96, 0.96}
+	colorAlert  = pdfColor{0.86, 0.15, 0.15}
+)
+
+// pdfPage is the content stream of one page. Coordinates are in points from
+// the bottom-left corner.
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func (p *pdfPage) text(x, y float64, font pdfFont, size float64, c pdfColor, s string) {
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s Td %s Tj ET\n",
+		c, font+1, pdfNum(size), pdfNum(x), pdfNum(y), pdfString(s))
+}
+
+// textRight draws s ending at x.
+func (p *pdfPage) textRight(x, y float64, font pdfFont, size float64, c pdfColor, s string) {
+	p.text(x-textWidth(font, size, s), y, font, size, c, s)
+}
+
+func (p *pdfPage) fillRect(x, y, w, h float64, c pdfColor) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n", c, pdfNum(x), pdfNum(y), pdfNum(w), pdfNum(h))
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2 float64, c pdfColor) {
+	fmt.Fprintf(&p.content, "%s RG 0.5 w %s %s m %s %s l S\n", c, pdfNum(x1), pdfNum(y1), pdfNum(x2), pdfNum(y2))
+}
+
+func (c pdfColor) String() string {
+	return pdfNum(c[0]) + " " + pdfNum(c[1]) + " " + pdfNum(c[2])
+}
+
+// pdfDoc is a document being built, page by page.
+type pdfDoc struct {
+	title   string
+	created time.Time
+	pages   []*pdfPage
+}
+
+func (d *pdfDoc) addPage() *pdfPage {
+	p := &pdfPage{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// write serializes the document. Objects are numbered in a fixed order: the
+// catalog, the page tree, the fonts, the info dictionary, then each page and
+// its content stream.
+func (d *pdfDoc) write(w io.Writer, width, height float64) error {
+	const info = 3 + len(pdfFontNames)
+	const firstPage = info + 1
+	var objects [][]byte
+	add := func(format string, args ...any) {
+		objects = append(objects, fmt.Appendf(nil, format, args...))
+	}
+
+	kids := new(bytes.Buffer)
+	for i := range d.pages {
+		fmt.Fprintf(kids, "%d 0 R ", firstPage+2*i)
+	}
+	add("<< /Type /Catalog /Pages 2 0 R >>")
+	add("<< /Type /Pages /Kids [ %s] /Count %d /MediaBox [0 0 %s %s] >>", kids, len(d.pages), pdfNum(width), pdfNum(height))
+	fonts := new(bytes.Buffer)
+	for i, name := range pdfFontNames {
+		add("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name)
+		fmt.Fprintf(fonts, "/F%d %d 0 R ", i+1, 3+i)
+	}
+	add("<< /Title %s /Producer (settlement-reconciler) /CreationDate (D:%s) >>",
+		pdfString(d.title), d.created.UTC().Format("20060102150405Z"))
+	for i, p := range d.pages {
+		add("<< /Type /Page /Parent 2 0 R /Resources << /Font << %s>> >> /Contents %d 0 R >>", fonts, firstPage+2*i+1)
+		add("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.Bytes())
+	}
+
+	bw := bufio.NewWriter(w)
+	offset := 0
+	write := func(b []byte) {
+		n, _ := bw.Write(b)
+		offset += n
+	}
+	write([]byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"))
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = offset
+		write(fmt.Appendf(nil, "%d 0 obj\n%s\nendobj\n", i+1, obj))
+	}
+	xref := offset
+	write(fmt.Appendf(nil, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1))
+	for _, off := range offsets {
+		write(fmt.Appendf(nil, "%010d 00000 n \n", off))
+	}
+	write(fmt.Appendf(nil, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, info, xref))
+	return bw.Flush()
+}
+
+// pdfNum formats a number with at most two decimals, without trailing zeros.
+func pdfNum(f float64) string {
+	s := strings.TrimSuffix(strings.TrimRight(strconv.FormatFloat(f, 'f', 2, 64), "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsiEncoding. Characters
+// the encoding lacks become '?'.
+func pdfString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, c := range winAnsi(s) {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// winAnsiExtra maps the characters of WinAnsiEncoding outside Latin-1 that a
+// report is likely to contain.
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			out = append(out, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case winAnsiExtra[r] != 0:
+			out = append(out, winAnsiExtra[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// Glyph widths of the printable ASCII characters (space to tilde), in
+// thousandths of the font size, from the Adobe font metrics. Other characters
+// are taken to be as wide as a digit.
+var pdfGlyphWidths = [...][95]int{
+	fontRegular: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	fontBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// textWidth is the width of s in points when set in font at size.
+func textWidth(font pdfFont, size float64, s string) float64 {
+	total := 0
+	for _, c := range winAnsi(s) {
+		if c >= 0x20 && c < 0x7f {
+			total += pdfGlyphWidths[font][c-0x20]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// fitText shortens s with an ellipsis so it fits in width points.
+func fitText(font pdfFont, size, width float64, s string) string {
+	if textWidth(font, size, s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && textWidth(font, size, string(r)+"…") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
@@ -0,0 +1,225 @@
+package report
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// Report sections that can be exported as a table.
+const (
+	SectionResults      = "results"
+	SectionHighPriority = "high_priority"
+	SectionByCurrency   = "by_currency"
+	SectionByCountry    = "by_country"
+	SectionByProcessor  = "by_processor"
+	SectionByRecordType = "by_record_type"
+)
+
+// Sections lists the exportable sections in the order they appear in a report.
+var Sections = []string{SectionResults, SectionHighPriority, SectionByCurrency, SectionByCountry, SectionByProcessor, SectionByRecordType}
+
+// cellKind is the type of a column's values, for formats that are typed.
+type cellKind int
+
+const (
+	kindText   cellKind = iota
+	kindNumber          // counts, days, rates and percentages
+	kindAmount          // money, in the currency the column reports
+	kindTime            // RFC 3339 timestamp
+	kindDate            // 2006-01-02
+)
+
+// column is one column of an exported table: its header, the type of its
+// values, how to render a row's value (empty when it has none) and, for
+// amounts, the currency of that value if there is a single one.
+type column[T any] struct {
+	name     string
+	kind     cellKind
+	value    func(T) string
+	currency func(T) string
+}
+
+type result = models.ReconciliationResult
+
+func resultCurrency(r result) string { return r.Currency }
+
+// resultColumns are the columns of the results and high-priority tables.
+// New columns go at the end, so that existing spreadsheets keep working.
+var resultColumns = []column[result]{
+	{"id", kindText, func(r result) string { return r.ID }, nil},
+	{"transaction_id", kindText, func(r result) string { return r.TransactionID }, nil},
+	{"settlement_id", kindText, func(r result) string { return r.SettlementID }, nil},
+	{"processor_name", kindText, func(r result) string { return r.ProcessorName }, nil},
+	{"status", kindText, func(r result) string { return string(r.Status) }, nil},
+	{"record_type", kindText, func(r result) string { return string(r.RecordType) }, nil},
+	{"original_transaction_id", kindText, func(r result) string { return r.OriginalTransactionID }, nil},
+	{"expected_amount", kindAmount, func(r result) string { return r.ExpectedAmount.String() }, resultCurrency},
+	{"settled_gross_amount", kindAmount, func(r result) string { return r.SettledGrossAmount.String() }, resultCurrency},
+	{"settled_net_amount", kindAmount, func(r result) string { return r.SettledNetAmount.String() }, resultCurrency},
+	{"fee_amount", kindAmount, func(r result) string { return r.FeeAmount.String() }, resultCurrency},
+	{"variance_amount", kindAmount, func(r result) string { return r.VarianceAmount.String() }, resultCurrency},
+	{"currency", kindText, func(r result) string { return r.Currency }, nil},
+	{"country", kindText, func(r result) string { return r.Country }, nil},
+	{"authorized_at", kindTime, func(r result) string { return timestamp(r.AuthorizedAt) }, nil},
+	{"settled_at", kindTime, func(r result) string { return timestamp(r.SettledAt) }, nil},
+	{"days_to_settle", kindNumber, func(r result) string { return optionalInt(r.DaysToSettle) }, nil},
+	{"days_outstanding", kindNumber, func(r result) string { return optionalInt(r.DaysOutstanding) }, nil},
+	{"aging_bucket", kindText, func(r result) string { return r.AgingBucket }, nil},
+	{"match_confidence", kindNumber, func(r result) string { return optionalFloat(r.MatchConfidence) }, nil},
+	{"match_group", kindText, func(r result) string { return r.MatchGroup }, nil},
+	{"duplicate_kind", kindText, func(r result) string { return r.DuplicateKind }, nil},
+	{"duplicate_of", kindText, func(r result) string { return r.DuplicateOf }, nil},
+	{"fx_rate", kindNumber, func(r result) string { return optionalFloat(r.FXRate) }, nil},
+	{"fx_rate_date", kindDate, func(r result) string { return day(r.FXRateDate) }, nil},
+	{"fee_variance", kindAmount, varianceColumn(func(b models.VarianceBreakdown) money.Amount { return b.Fee }), resultCurrency},
+	{"fx_variance", kindAmount, varianceColumn(func(b models.VarianceBreakdown) money.Amount { return b.FX }), resultCurrency},
+	{"partial_capture_variance", kindAmount, varianceColumn(func(b models.VarianceBreakdown) money.Amount { return b.PartialCapture }), resultCurrency},
+	{"residual_variance", kindAmount, varianceColumn(func(b models.VarianceBreakdown) money.Amount { return b.Residual }), resultCurrency},
+	{"expected_fee", kindAmount, func(r result) string { return optionalAmount(r.ExpectedFee) }, resultCurrency},
+	{"fee_overcharge", kindAmount, func(r result) string { return optionalAmount(r.FeeOvercharge) }, resultCurrency},
+	{"notes", kindText, func(r result) string { return r.Notes }, nil},
+}
+
+func varianceColumn(part func(models.VarianceBreakdown) money.Amount) func(result) string {
+	return func(r result) string {
+		if r.VarianceBreakdown == nil {
+			return ""
+		}
+		return part(*r.VarianceBreakdown).String()
+	}
+}
+
+// breakdownRow is one entry of a breakdown: the currency, country, processor
+// or record type, and its summary. currency is set when all of the entry's
+// native amounts are in one currency.
+type breakdownRow struct {
+	key      string
+	currency string
+	summary  models.ReportSummary
+}
+
+func nativeCurrency(b breakdownRow) string    { return b.currency }
+func reportingCurrency(b breakdownRow) string { return b.summary.ReportingCurrency }
+
+func count(name string, f func(models.ReportSummary) int) column[breakdownRow] {
+	return column[breakdownRow]{name, kindNumber, func(b breakdownRow) string { return strconv.Itoa(f(b.summary)) }, nil}
+}
+
+func total(name string, f func(models.ReportSummary) money.Amount) column[breakdownRow] {
+	return column[breakdownRow]{name, kindAmount, func(b breakdownRow) string { return f(b.summary).String() }, nativeCurrency}
+}
+
+func reportingTotal(name string, f func(models.AmountTotals) money.Amount) column[breakdownRow] {
+	return column[breakdownRow]{name, kindAmount, func(b breakdownRow) string { return f(b.summary.ReportingTotals).String() }, reportingCurrency}
+}
+
+// summaryColumns are the columns of a breakdown table after its key column,
+// and the rows of the summary sheet. New columns go at the end.
+var summaryColumns = []column[breakdownRow]{
+	count("matched", func(s models.ReportSummary) int { return s.Matched }),
+	count("matched_with_variance", func(s models.ReportSummary) int { return s.MatchedWithVariance }),
+	count("matched_fuzzy", func(s models.ReportSummary) int { return s.MatchedFuzzy }),
+	count("unsettled", func(s models.ReportSummary) int { return s.Unsettled }),
+	count("not_captured", func(s models.ReportSummary) int { return s.NotCaptured }),
+	count("failed", func(s models.ReportSummary) int { return s.Failed }),
+	count("failed_transaction_settled", func(s models.ReportSummary) int { return s.FailedSettled }),
+	count("unexpected_settlements", func(s models.ReportSummary) int { return s.UnexpectedSettlements }),
+	count("duplicates", func(s models.ReportSummary) int { return s.Duplicates }),
+	count("refunded", func(s models.ReportSummary) int { return s.Refunded }),
+	count("chargebacks", func(s models.ReportSummary) int { return s.Chargebacks }),
+	count("chargeback_reversals", func(s models.ReportSummary) int { return s.ChargebackReversals }),
+	count("adjustments", func(s models.ReportSummary) int { return s.Adjustments }),
+	count("unlinked", func(s models.ReportSummary) int { return s.Unlinked }),
+	count("split_groups", func(s models.ReportSummary) int { return s.SplitGroups }),
+	count("aggregated_groups", func(s models.ReportSummary) int { return s.AggregatedGroups }),
+	count("fee_overcharges", func(s models.ReportSummary) int { return s.FeeOvercharges }),
+	count("unsettled_0_3", func(s models.ReportSummary) int { return s.UnsettledAging.Days0To3 }),
+	count("unsettled_4_7", func(s models.ReportSummary) int { return s.UnsettledAging.Days4To7 }),
+	count("unsettled_8_14", func(s models.ReportSummary) int { return s.UnsettledAging.Days8To14 }),
+	count("unsettled_15_30", func(s models.ReportSummary) int { return s.UnsettledAging.Days15To30 }),
+	count("unsettled_over_30", func(s models.ReportSummary) int { return s.UnsettledAging.Over30 }),
+	{"reporting_currency", kindText, func(b breakdownRow) string { return b.summary.ReportingCurrency }, nil},
+	reportingTotal("reporting_expected_amount", func(t models.AmountTotals) money.Amount { return t.ExpectedAmount }),
+	reportingTotal("reporting_settled_gross", func(t models.AmountTotals) money.Amount { return t.SettledGross }),
+	reportingTotal("reporting_settled_net", func(t models.AmountTotals) money.Amount { return t.SettledNet }),
+	reportingTotal("reporting_variance_amount", func(t models.AmountTotals) money.Amount { return t.VarianceAmount }),
+	reportingTotal("reporting_fees", func(t models.AmountTotals) money.Amount { return t.Fees }),
+	{"unconverted_currencies", kindText, func(b breakdownRow) string { return strings.Join(b.summary.UnconvertedCurrencies, " ") }, nil},
+	{"reconciliation_rate_pct", kindNumber, func(b breakdownRow) string { return strconv.FormatFloat(b.summary.ReconciliationRate, 'f', 2, 64) }, nil},
+	reportingTotal("reporting_fee_overcharge", func(t models.AmountTotals) money.Amount { return t.FeeOvercharge }),
+	reportingTotal("reporting_fee_variance", func(t models.AmountTotals) money.Amount { return t.FeeVariance }),
+	reportingTotal("reporting_fx_variance", func(t models.AmountTotals) money.Amount { return t.FXVariance }),
+	reportingTotal("reporting_partial_capture_variance", func(t models.AmountTotals) money.Amount { return t.PartialCaptureVariance }),
+	reportingTotal("reporting_residual_variance", func(t models.AmountTotals) money.Amount { return t.ResidualVariance }),
+}
+
+// breakdown returns the breakdown a section names, with the header of its key
+// column, and false if section is not a breakdown.
+func breakdown(rep *models.ReconciliationReport, section string) (string, map[string]models.ReportSummary, bool) {
+	switch section {
+	case SectionByCurrency:
+		return "currency", rep.ByCurrency, true
+	case SectionByCountry:
+		return "country", rep.ByCountry, true
+	case SectionByProcessor:
+		return "processor_name", rep.ByProcessor, true
+	case SectionByRecordType:
+		return "record_type", rep.ByRecordType, true
+	}
+	return "", nil, false
+}
+
+// breakdownTable returns the columns and rows of a breakdown, sorted by key.
+func breakdownTable(section, key string, b map[string]models.ReportSummary) ([]column[breakdownRow], []breakdownRow) {
+	cols := append([]column[breakdownRow]{{key, kindText, func(b breakdownRow) string { return b.key }, nil}}, summaryColumns...)
+	rows := make([]breakdownRow, 0, len(b))
+	for _, k := range slices.Sorted(maps.Keys(b)) {
+		row := breakdownRow{key: k, summary: b[k]}
+		if section == SectionByCurrency {
+			row.currency = k
+		}
+		rows = append(rows, row)
+	}
+	return cols, rows
+}
+
+func timestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func day(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func optionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func optionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func optionalAmount(a *money.Amount) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,390 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// Cell styles of an exported workbook (indexes into cellXfs). Amounts in a
+// known currency get a style of their own, appended after these.
+const (
+	styleDefault = iota
+	styleHeader
+	styleTime
+	styleDate
+	styleAmount // amount of mixed or unknown currency
+	styleRate   // percentage with two decimals
+)
+
+// Custom number formats; IDs below 164 are built in.
+const (
+	numFmtTime        = 164
+	numFmtDate        = 165
+	numFmtFirstAmount = 166
+)
+
+// xlsxPart is one file of the workbook package.
+type xlsxPart struct {
+	name string
+	data []byte
+}
+
+// xlsxCell is one cell of a worksheet: a rendered value and how to type it.
+type xlsxCell struct {
+	kind     cellKind
+	value    string
+	currency string
+	style    int // overrides the style of kind when non-zero
+}
+
+// xlsxSheet is a worksheet whose first row is a header.
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+}
+
+// WriteXLSX writes a report as an Excel workbook: a summary sheet, one sheet
+// per breakdown, all results and the high-priority discrepancies. Header rows
+// are frozen, and amounts are formatted with their currency's minor units and
+// code. The workbook only depends on the report, so the same report always
+// gives the same bytes.
+func WriteXLSX(w io.Writer, rep *models.ReconciliationReport) error {
+	sheets := []xlsxSheet{summarySheet(rep)}
+	for _, section := range []string{SectionByCurrency, SectionByCountry, SectionByProcessor, SectionByRecordType} {
+		key, b, _ := breakdown(rep, section)
+		cols, rows := breakdownTable(section, key, b)
+		sheets = append(sheets, tableSheet(sheetName(section), cols, rows))
+	}
+	sheets = append(sheets,
+		tableSheet(sheetName(SectionResults), resultColumns, rep.Results),
+		tableSheet(sheetName(SectionHighPriority), resultColumns, rep.HighPriority))
+
+	styles := newXLSXStyles()
+	parts := []xlsxPart{
+		{"[Content_Types].xml", contentTypesXML(len(sheets))},
+		{"_rels/.rels", []byte(rootRelsXML)},
+		{"xl/workbook.xml", workbookXML(sheets)},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML(len(sheets))},
+	}
+	for i, s := range sheets {
+		parts = append(parts, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s.xml(styles)})
+	}
+	// Styles go last: the sheets register the currency formats they use.
+	parts = append(parts, xlsxPart{"xl/styles.xml", styles.xml()})
+
+	zw := zip.NewWriter(w)
+	for _, p := range parts {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: p.name, Method: zip.Deflate, Modified: rep.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(p.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// sheetName is the worksheet name of a report section.
+func sheetName(section string) string {
+	name := strings.ReplaceAll(section, "_", " ")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// summarySheet lists the run and its summary as field and value rows, then
+// the native totals per currency.
+func summarySheet(rep *models.ReconciliationReport) xlsxSheet {
+	textCell := func(s string) xlsxCell { return xlsxCell{kind: kindText, value: s} }
+	s := xlsxSheet{name: "Summary", rows: [][]xlsxCell{
+		{{kind: kindText, value: "field", style: styleHeader}, {kind: kindText, value: "value", style: styleHeader}},
+		{textCell("run_id"), textCell(rep.RunID)},
+		{textCell("generated_at"), {kind: kindTime, value: timestamp(&rep.GeneratedAt)}},
+		{textCell("as_of"), {kind: kindTime, value: timestamp(&rep.AsOf)}},
+	}}
+	row := breakdownRow{summary: rep.Summary}
+	for _, c := range summaryColumns {
+		cell := xlsxCell{kind: c.kind, value: c.value(row)}
+		if c.name == "reconciliation_rate_pct" {
+			cell.style = styleRate
+		}
+		if c.currency != nil {
+			cell.currency = c.currency(row)
+		}
+		s.rows = append(s.rows, []xlsxCell{textCell(c.name), cell})
+	}
+
+	header := []string{"currency", "expected_amount", "settled_gross", "settled_net", "variance_amount", "fees", "fee_overcharge",
+		"fee_variance", "fx_variance", "partial_capture_variance", "residual_variance"}
+	s.rows = append(s.rows, nil, make([]xlsxCell, len(header)))
+	for i, h := range header {
+		s.rows[len(s.rows)-1][i] = xlsxCell{kind: kindText, value: h, style: styleHeader}
+	}
+	for _, cur := range slices.Sorted(maps.Keys(rep.Summary.NativeTotals)) {
+		t := rep.Summary.NativeTotals[cur]
+		r := []xlsxCell{textCell(cur)}
+		for _, a := range []money.Amount{t.ExpectedAmount, t.SettledGross, t.SettledNet, t.VarianceAmount, t.Fees, t.FeeOvercharge,
+			t.FeeVariance, t.FXVariance, t.PartialCaptureVariance, t.ResidualVariance} {
+			r = append(r, xlsxCell{kind: kindAmount, value: a.String(), currency: cur})
+		}
+		s.rows = append(s.rows, r)
+	}
+	return s
+}
+
+// tableSheet is a worksheet with a header row of column names and a row per
+// table row.
+func tableSheet[T any](name string, cols []column[T], rows []T) xlsxSheet {
+	s := xlsxSheet{name: name, rows: make([][]xlsxCell, 0, len(rows)+1)}
+	header := make([]xlsxCell, len(cols))
+	for i, c := range cols {
+		header[i] = xlsxCell{kind: kindText, value: c.name, style: styleHeader}
+	}
+	s.rows = append(s.rows, header)
+	for _, row := range rows {
+		cells := make([]xlsxCell, len(cols))
+		for i, c := range cols {
+			cells[i] = xlsxCell{kind: c.kind, value: c.value(row)}
+			if c.currency != nil {
+				cells[i].currency = c.currency(row)
+			}
+			if c.name == "reconciliation_rate_pct" {
+				cells[i].style = styleRate
+			}
+		}
+		s.rows = append(s.rows, cells)
+	}
+	return s
+}
+
+// xml renders the worksheet, registering the amount styles it uses.
+func (s xlsxSheet) xml(styles *xlsxStyles) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft"/></sheetView></sheetViews>`)
+	if widths := s.columnWidths(); len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			writeXLSXCell(&b, cellRef(c, r), cell, styles)
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	return b.Bytes()
+}
+
+// columnWidths sizes each column to its longest value, within limits.
+func (s xlsxSheet) columnWidths() []int {
+	var widths []int
+	for _, row := range s.rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 10)
+			}
+			n := len(cell.value) + 2
+			if cell.kind == kindTime {
+				n = 20
+			}
+			widths[i] = min(max(widths[i], n), 60)
+		}
+	}
+	return widths
+}
+
+func writeXLSXCell(b *bytes.Buffer, ref string, cell xlsxCell, styles *xlsxStyles) {
+	if cell.value == "" {
+		return
+	}
+	style := cell.style
+	value := cell.value
+	numeric := true
+	switch cell.kind {
+	case kindText:
+		numeric = false
+	case kindAmount:
+		if style == styleDefault {
+			style = styles.amount(cell.currency)
+		}
+	case kindTime, kindDate:
+		layout, dateStyle := time.RFC3339, styleTime
+		if cell.kind == kindDate {
+			layout, dateStyle = "2006-01-02", styleDate
+		}
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			numeric = false
+			break
+		}
+		value = excelSerial(t)
+		if style == styleDefault {
+			style = dateStyle
+		}
+	}
+	fmt.Fprintf(b, `<c r="%s"`, ref)
+	if style != styleDefault {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	if numeric {
+		fmt.Fprintf(b, `><v>%s</v></c>`, value)
+		return
+	}
+	b.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(b, []byte(value))
+	b.WriteString(`</t></is></c>`)
+}
+
+// cellRef is the A1-style reference of a zero-based column and row.
+func cellRef(col, row int) string {
+	var name []byte
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = append([]byte{byte('A' + (col-1)%26)}, name...)
+	}
+	return string(name) + strconv.Itoa(row+1)
+}
+
+// excelSerial is t as a spreadsheet date serial: days since 1899-12-30.
+func excelSerial(t time.Time) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return strconv.FormatFloat(t.Sub(epoch).Hours()/24, 'f', -1, 64)
+}
+
+// xlsxStyles collects the number formats of a workbook. Each currency gets a
+// format with its minor units and code, e.g. #,##0.00 "MXN".
+type xlsxStyles struct {
+	currencies []string
+	index      map[string]int
+}
+
+func newXLSXStyles() *xlsxStyles {
+	return &xlsxStyles{index: make(map[string]int)}
+}
+
+// amount returns the style of an amount in currency.
+func (s *xlsxStyles) amount(currency string) int {
+	if !money.ValidCurrency(currency) {
+		return styleAmount
+	}
+	i, ok := s.index[currency]
+	if !ok {
+		i = len(s.currencies)
+		s.index[currency] = i
+		s.currencies = append(s.currencies, currency)
+	}
+	return styleRate + 1 + i
+}
+
+func amountFormat(currency string) string {
+	format := "#,##0"
+	if e := money.Exponent(currency); e > 0 {
+		format += "." + strings.Repeat("0", e)
+	}
+	if currency != "" {
+		format += ` "` + currency + `"`
+	}
+	return format
+}
+
+func (s *xlsxStyles) xml() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	fmt.Fprintf(&b, `<numFmts count="%d">`, 3+len(s.currencies))
+	writeNumFmt(&b, numFmtTime, "yyyy-mm-dd hh:mm:ss")
+	writeNumFmt(&b, numFmtDate, "yyyy-mm-dd")
+	writeNumFmt(&b, numFmtFirstAmount, amountFormat(""))
+	for i, cur := range s.currencies {
+		writeNumFmt(&b, numFmtFirstAmount+1+i, amountFormat(cur))
+	}
+	b.WriteString(`</numFmts>`)
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	b.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&b, `<cellXfs count="%d">`, styleRate+1+len(s.currencies))
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`)
+	b.WriteString(`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	writeNumberXf(&b, numFmtTime)
+	writeNumberXf(&b, numFmtDate)
+	writeNumberXf(&b, numFmtFirstAmount)
+	writeNumberXf(&b, 2) // built-in 0.00
+	for i := range s.currencies {
+		writeNumberXf(&b, numFmtFirstAmount+1+i)
+	}
+	b.WriteString(`</cellXfs>`)
+	b.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	b.WriteString(`</styleSheet>`)
+	return b.Bytes()
+}
+
+func writeNumFmt(b *bytes.Buffer, id int, code string) {
+	fmt.Fprintf(b, `<numFmt numFmtId="%d" formatCode="`, id)
+	xml.EscapeText(b, []byte(code))
+	b.WriteString(`"/>`)
+}
+
+func writeNumberXf(b *bytes.Buffer, numFmtID int) {
+	fmt.Fprintf(b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, numFmtID)
+}
+
+func contentTypesXML(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	b.WriteString(`</Types>`)
+	return b.Bytes()
+}
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func workbookXML(sheets []xlsxSheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range sheets {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(s.name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.Bytes()
+}
+
+func workbookRelsXML(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.Bytes()
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+func TestWriteXLSX(t *testing.T) {
+	settledAt := time.Date(2025, 1, 17, 12, 0, 0, 0, time.UTC)
+	rep := &models.ReconciliationReport{
+		RunID:       "RUN-0001",
+		GeneratedAt: time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC),
+		Summary: models.ReportSummary{
+			Matched: 1, ReconciliationRate: 50, ReportingCurrency: "USD",
+			NativeTotals: map[string]models.AmountTotals{"MXN": {ExpectedAmount: money.MustParse("100")}},
+		},
+		ByCurrency: map[string]models.ReportSummary{"MXN": {Matched: 1}},
+		Results: []models.ReconciliationResult{
+			{ID: "RR-1", Status: models.StatusMatched, ExpectedAmount: money.MustParse("1234.5"), Currency: "MXN", SettledAt: &settledAt, Notes: `Fee <2.50> & "rounding"`},
+			{ID: "RR-2", Status: models.StatusUnsettled, ExpectedAmount: money.MustParse("5000"), Currency: "JPY"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(data)
+		// Every part must be well-formed XML.
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet7.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	for _, name := range []string{"Summary", "By currency", "By country", "By processor", "By record type", "Results", "High priority"} {
+		if !strings.Contains(parts["xl/workbook.xml"], `name="`+name+`"`) {
+			t.Errorf("missing sheet %q", name)
+		}
+	}
+
+	results := parts["xl/worksheets/sheet6.xml"]
+	if !strings.Contains(results, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`) {
+		t.Error("expected a frozen header row")
+	}
+	if !strings.Contains(results, `Fee &lt;2.50&gt; &amp; &#34;rounding&#34;`) {
+		t.Error("expected notes to be escaped")
+	}
+	// Amounts are numbers styled per currency: USD (the reporting currency on
+	// the summary sheet) got the first currency style, then MXN, then JPY.
+	styles := parts["xl/styles.xml"]
+	if !strings.Contains(results, `<c r="H2" s="7"><v>1234.50</v></c>`) || !strings.Contains(styles, `formatCode="#,##0.00 &#34;MXN&#34;"`) {
+		t.Errorf("expected an MXN-formatted amount")
+	}
+	if !strings.Contains(results, `<c r="H3" s="8"><v>5000.00</v></c>`) || !strings.Contains(styles, `formatCode="#,##0 &#34;JPY&#34;"`) {
+		t.Errorf("expected a JPY-formatted amount without decimals")
+	}
+	// 2025-01-17 12:00 is day 45674.5.
+	if !strings.Contains(results, `<c r="P2" s="2"><v>45674.5</v></c>`) {
+		t.Errorf("expected settled_at as a date serial")
+	}
+
+	var again bytes.Buffer
+	WriteXLSX(&again, rep)
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Error("expected the same report to give the same workbook")
+	}
+}
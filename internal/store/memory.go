@@ -0,0 +1,230 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// Memory is a thread-safe in-memory Store. Data is lost when the process exits.
+type Memory struct {
+	mu           sync.RWMutex
+	transactions map[string]models.Transaction      // keyed by ID
+	settlements  map[string]models.SettlementRecord // keyed by ID
+	runs         map[string]*models.ReconciliationRun
+	runInputs    map[string]models.RunInputs // keyed by run ID
+	fxRates      map[string]models.FXRate    // keyed by fxRateID
+	results      map[string]*resultIndex     // keyed by run ID, once the run has a report
+}
+
+// New returns an empty in-memory store.
+func New() *Memory {
+	return &Memory{
+		transactions: make(map[string]models.Transaction),
+		settlements:  make(map[string]models.SettlementRecord),
+		runs:         make(map[string]*models.ReconciliationRun),
+		runInputs:    make(map[string]models.RunInputs),
+		fxRates:      make(map[string]models.FXRate),
+		results:      make(map[string]*resultIndex),
+	}
+}
+
+// --- Transactions ---
+
+func (s *Memory) AddTransactions(txns []models.Transaction) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, t := range txns {
+		if _, exists := s.transactions[t.ID]; !exists {
+			count++
+		}
+		s.transactions[t.ID] = t
+	}
+	return count, nil
+}
+
+func (s *Memory) GetTransaction(id string) (models.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.transactions[id]
+	if !ok {
+		return models.Transaction{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *Memory) ListTransactions() ([]models.Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]models.Transaction, 0, len(s.transactions))
+	for _, t := range s.transactions {
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// --- Settlements ---
+
+func (s *Memory) AddSettlements(recs []models.SettlementRecord) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, r := range recs {
+		if _, exists := s.settlements[r.ID]; !exists {
+			count++
+		}
+		s.settlements[r.ID] = r
+	}
+	return count, nil
+}
+
+func (s *Memory) GetSettlement(id string) (models.SettlementRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.settlements[id]
+	if !ok {
+		return models.SettlementRecord{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *Memory) ListSettlements() ([]models.SettlementRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]models.SettlementRecord, 0, len(s.settlements))
+	for _, r := range s.settlements {
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// --- Reconciliation Runs ---
+
+// SaveRun stores a copy of run, so callers may keep updating their value (e.g.
+// progress from a background job) without racing readers.
+func (s *Memory) SaveRun(run *models.ReconciliationRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *run
+	if cp.Report == nil && s.runs[run.ID] != nil {
+		cp.Report = s.runs[run.ID].Report
+	}
+	s.runs[run.ID] = &cp
+	// A report does not change once written, so its results are indexed once.
+	if run.Report != nil && s.results[run.ID] == nil {
+		s.results[run.ID] = newResultIndex(run.Report.Results)
+	}
+	return nil
+}
+
+func (s *Memory) GetRun(id string) (*models.ReconciliationRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *r
+	return &cp, nil
+}
+
+func (s *Memory) GetRunInfo(id string) (*models.ReconciliationRun, error) {
+	run, err := s.GetRun(id)
+	if err != nil {
+		return nil, err
+	}
+	run.Report = nil
+	return run, nil
+}
+
+func (s *Memory) ListRuns() ([]*models.ReconciliationRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*models.ReconciliationRun, 0, len(s.runs))
+	for _, r := range s.runs {
+		cp := *r
+		cp.Report = nil
+		result = append(result, &cp)
+	}
+	return result, nil
+}
+
+func (s *Memory) QueryResults(runID string, q ResultQuery) (ResultPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx, ok := s.results[runID]
+	if !ok {
+		return ResultPage{}, ErrNotFound
+	}
+	return idx.query(q)
+}
+
+func (s *Memory) SaveRunInputs(runID string, in models.RunInputs) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.runInputs[runID]; exists {
+		return ErrExists
+	}
+	s.runInputs[runID] = models.RunInputs{
+		Transactions: slices.Clone(in.Transactions),
+		Settlements:  slices.Clone(in.Settlements),
+		FXRates:      slices.Clone(in.FXRates),
+	}
+	return nil
+}
+
+func (s *Memory) GetRunInputs(runID string) (models.RunInputs, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	in, ok := s.runInputs[runID]
+	if !ok {
+		return models.RunInputs{}, ErrNotFound
+	}
+	return models.RunInputs{
+		Transactions: slices.Clone(in.Transactions),
+		Settlements:  slices.Clone(in.Settlements),
+		FXRates:      slices.Clone(in.FXRates),
+	}, nil
+}
+
+// --- FX Rates ---
+
+func (s *Memory) AddFXRates(rates []models.FXRate) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, r := range rates {
+		id := fxRateID(r)
+		if _, exists := s.fxRates[id]; !exists {
+			count++
+		}
+		s.fxRates[id] = r
+	}
+	return count, nil
+}
+
+func (s *Memory) ListFXRates() ([]models.FXRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]models.FXRate, 0, len(s.fxRates))
+	for _, id := range slices.Sorted(maps.Keys(s.fxRates)) {
+		result = append(result, s.fxRates[id])
+	}
+	return result, nil
+}
+
+// Clear removes all data from the store.
+func (s *Memory) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions = make(map[string]models.Transaction)
+	s.settlements = make(map[string]models.SettlementRecord)
+	s.runs = make(map[string]*models.ReconciliationRun)
+	s.runInputs = make(map[string]models.RunInputs)
+	s.fxRates = make(map[string]models.FXRate)
+	s.results = make(map[string]*resultIndex)
+	return nil
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// ErrInvalidCursor is returned for a page cursor that was not issued for the
+// query's sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ResultSortFields are the fields results can be sorted by. Results without
+// a value for the field come last in either direction; ties keep report order.
+var ResultSortFields = []string{"expected_amount", "variance_amount", "days_to_settle", "authorized_at", "settled_at"}
+
+// ResultQuery selects, orders and pages the results of a run. Empty filters
+// match every result, and a list filter matches any of its values. Range
+// bounds are inclusive; a result without the value never matches a range.
+type ResultQuery struct {
+	Statuses   []models.ReconciliationStatus
+	Processors []string
+	Currencies []string
+	Countries  []string
+
+	MinVariance, MaxVariance         *money.Amount // signed variance, in the result's currency
+	MinDaysToSettle, MaxDaysToSettle *int
+	AuthorizedFrom, AuthorizedTo     *time.Time
+	SettledFrom, SettledTo           *time.Time
+
+	// Sort is one of ResultSortFields, prefixed with "-" for descending order.
+	// Empty keeps report order.
+	Sort   string
+	Limit  int    // results per page; 0 returns all
+	Cursor string // NextCursor of the previous page; empty for the first
+}
+
+// ResultPage is one page of a run's results.
+type ResultPage struct {
+	Results    []models.ReconciliationResult `json:"results"`
+	Total      int                           `json:"total"`                 // results matching the filters, over all pages
+	NextCursor string                        `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// sortField splits Sort into its field and direction.
+func (q ResultQuery) sortField() (field string, desc bool) {
+	return strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+}
+
+// matchesRanges reports whether r is within the range filters of q.
+func (q ResultQuery) matchesRanges(r models.ReconciliationResult) bool {
+	ranges := []struct {
+		field    string
+		min, max *int64
+	}{
+		{"variance_amount", amountUnits(q.MinVariance), amountUnits(q.MaxVariance)},
+		{"days_to_settle", intValue(q.MinDaysToSettle), intValue(q.MaxDaysToSettle)},
+		{"authorized_at", timeNanos(q.AuthorizedFrom), timeNanos(q.AuthorizedTo)},
+		{"settled_at", timeNanos(q.SettledFrom), timeNanos(q.SettledTo)},
+	}
+	for _, rg := range ranges {
+		if rg.min == nil && rg.max == nil {
+			continue
+		}
+		k := resultKeyOf(r, rg.field, 0)
+		if k.Null || rg.min != nil && k.Value < *rg.min || rg.max != nil && k.Value > *rg.max {
+			return false
+		}
+	}
+	return true
+}
+
+// resultKey is the position of a result in a sort order: its value for the
+// sort field, null when it has none, then its position in the report.
+type resultKey struct {
+	Null     bool  `json:"n,omitempty"`
+	Value    int64 `json:"v,omitempty"`
+	Position int   `json:"p"`
+}
+
+// resultKeyOf returns the key of r, at position pos of the report, for a
+// sort field. Amounts are in ten-thousandths and times in Unix nanoseconds,
+// as the SQLite store indexes them. An empty field orders by position only.
+func resultKeyOf(r models.ReconciliationResult, field string, pos int) resultKey {
+	k := resultKey{Position: pos}
+	switch field {
+	case "expected_amount":
+		k.Value = r.ExpectedAmount.Units()
+	case "variance_amount":
+		k.Value = r.VarianceAmount.Units()
+	case "days_to_settle":
+		k.Null = r.DaysToSettle == nil
+		if !k.Null {
+			k.Value = int64(*r.DaysToSettle)
+		}
+	case "authorized_at":
+		k.Null = r.AuthorizedAt == nil
+		if !k.Null {
+			k.Value = r.AuthorizedAt.UnixNano()
+		}
+	case "settled_at":
+		k.Null = r.SettledAt == nil
+		if !k.Null {
+			k.Value = r.SettledAt.UnixNano()
+		}
+	}
+	return k
+}
+
+// before reports whether key a sorts before b.
+func (a resultKey) before(b resultKey, desc bool) bool {
+	switch {
+	case a.Null != b.Null:
+		return b.Null
+	case a.Value != b.Value:
+		return (a.Value < b.Value) != desc
+	}
+	return a.Position < b.Position
+}
+
+// cursor is what a page cursor encodes: the sort it was issued for and the
+// key of the last result of the page.
+type cursor struct {
+	Sort string `json:"s,omitempty"`
+	resultKey
+}
+
+func encodeCursor(sort string, last resultKey) string {
+	data, _ := json.Marshal(cursor{sort, last})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the key a page starts after, or nil for the first
+// page. It also checks the sort field, which the SQLite store puts in SQL.
+func (q ResultQuery) decodeCursor() (*resultKey, error) {
+	if field, _ := q.sortField(); field != "" && !slices.Contains(ResultSortFields, field) {
+		return nil, fmt.Errorf("unknown sort field %q", field)
+	}
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != q.Sort {
+		return nil, ErrInvalidCursor
+	}
+	return &c.resultKey, nil
+}
+
+// resultFilterColumns are the columns results are filtered on by value, with
+// the value of a result and the values a query accepts.
+var resultFilterColumns = []struct {
+	name   string
+	value  func(models.ReconciliationResult) string
+	values func(ResultQuery) []string
+}{
+	{"status", func(r models.ReconciliationResult) string { return string(r.Status) }, func(q ResultQuery) []string { return statusStrings(q.Statuses) }},
+	{"processor_name", func(r models.ReconciliationResult) string { return r.ProcessorName }, func(q ResultQuery) []string { return q.Processors }},
+	{"currency", func(r models.ReconciliationResult) string { return r.Currency }, func(q ResultQuery) []string { return q.Currencies }},
+	{"country", func(r models.ReconciliationResult) string { return r.Country }, func(q ResultQuery) []string { return q.Countries }},
+}
+
+// resultIndex indexes the results of one run for the in-memory store.
+type resultIndex struct {
+	results []models.ReconciliationResult
+	// postings lists, per filter column and value, the positions of the
+	// results with that value in ascending order.
+	postings map[string]map[string][]int
+}
+
+func newResultIndex(results []models.ReconciliationResult) *resultIndex {
+	idx := &resultIndex{results: results, postings: make(map[string]map[string][]int)}
+	for _, col := range resultFilterColumns {
+		postings := make(map[string][]int)
+		for pos, r := range results {
+			postings[col.value(r)] = append(postings[col.value(r)], pos)
+		}
+		idx.postings[col.name] = postings
+	}
+	return idx
+}
+
+// query returns a page of the indexed results. The value filters are looked
+// up in the postings, so only their matches are checked against the ranges.
+func (idx *resultIndex) query(q ResultQuery) (ResultPage, error) {
+	after, err := q.decodeCursor()
+	if err != nil {
+		return ResultPage{}, err
+	}
+
+	var candidates []int
+	filtered := false // candidates are narrowed down; otherwise every result is one
+	for _, col := range resultFilterColumns {
+		values := col.values(q)
+		if len(values) == 0 {
+			continue
+		}
+		var matching []int
+		for _, v := range values {
+			matching = append(matching, idx.postings[col.name][v]...)
+		}
+		slices.Sort(matching)
+		matching = slices.Compact(matching)
+		if filtered {
+			candidates = intersectSorted(candidates, matching)
+		} else {
+			candidates, filtered = matching, true
+		}
+	}
+	if !filtered {
+		candidates = make([]int, len(idx.results))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	field, desc := q.sortField()
+	keys := make([]resultKey, 0, len(candidates))
+	for _, pos := range candidates {
+		if r := idx.results[pos]; q.matchesRanges(r) {
+			keys = append(keys, resultKeyOf(r, field, pos))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].before(keys[j], desc) })
+
+	page := ResultPage{Total: len(keys), Results: []models.ReconciliationResult{}}
+	if after != nil {
+		keys = keys[sort.Search(len(keys), func(i int) bool { return after.before(keys[i], desc) }):]
+	}
+	if q.Limit > 0 && len(keys) > q.Limit {
+		keys = keys[:q.Limit]
+		page.NextCursor = encodeCursor(q.Sort, keys[len(keys)-1])
+	}
+	for _, k := range keys {
+		page.Results = append(page.Results, idx.results[k.Position])
+	}
+	return page, nil
+}
+
+func intersectSorted(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func statusStrings(statuses []models.ReconciliationStatus) []string {
+	out := make([]string, len(statuses))
+	for i, s := range statuses {
+		out[i] = string(s)
+	}
+	return out
+}
+
+func amountUnits(a *money.Amount) *int64 {
+	if a == nil {
+		return nil
+	}
+	v := a.Units()
+	return &v
+}
+
+func intValue(i *int) *int64 {
+	if i == nil {
+		return nil
+	}
+	v := int64(*i)
+	return &v
+}
+
+func timeNanos(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	v := t.UnixNano()
+	return &v
+}
@@ -0,0 +1,596 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// SQLiteDriver is the database/sql driver name the SQLite store opens. The pure-Go
+// modernc.org/sqlite driver registers under this name; the server links it.
+const SQLiteDriver = "sqlite"
+
+// SQLite is a Store backed by a SQLite database file. Records are stored as JSON
+// documents next to the columns used for lookups, so model changes do not need a
+// schema migration unless a new column must be indexed.
+type SQLite struct {
+	db *sql.DB
+}
+
+// migrations are applied in order; the index of each entry plus one is its schema version.
+// Never edit an applied migration, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE transactions (
+		id               TEXT PRIMARY KEY,
+		order_id         TEXT NOT NULL,
+		processor_name   TEXT NOT NULL,
+		processor_txn_id TEXT NOT NULL,
+		data             TEXT NOT NULL
+	);
+	CREATE INDEX idx_transactions_processor_key ON transactions (processor_name, processor_txn_id);
+	CREATE INDEX idx_transactions_order_id ON transactions (order_id);
+
+	CREATE TABLE settlements (
+		id               TEXT PRIMARY KEY,
+		processor_name   TEXT NOT NULL,
+		processor_txn_id TEXT NOT NULL,
+		order_reference  TEXT NOT NULL,
+		data             TEXT NOT NULL
+	);
+	CREATE INDEX idx_settlements_processor_key ON settlements (processor_name, processor_txn_id);
+	CREATE INDEX idx_settlements_order_reference ON settlements (order_reference);
+
+	CREATE TABLE runs (
+		id         TEXT PRIMARY KEY,
+		created_at TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		data       TEXT NOT NULL
+	);`,
+
+	`CREATE TABLE run_inputs (
+		run_id TEXT PRIMARY KEY,
+		data   TEXT NOT NULL
+	);`,
+
+	`CREATE TABLE fx_rates (
+		id            TEXT PRIMARY KEY,
+		from_currency TEXT NOT NULL,
+		to_currency   TEXT NOT NULL,
+		date          TEXT NOT NULL,
+		data          TEXT NOT NULL
+	);`,
+
+	// Results of a run's report, for paged queries. Amounts are stored in
+	// ten-thousandths and timestamps in Unix nanoseconds, so both compare and
+	// sort as integers.
+	`CREATE TABLE run_results (
+		run_id          TEXT NOT NULL,
+		position        INTEGER NOT NULL,
+		status          TEXT NOT NULL,
+		processor_name  TEXT NOT NULL,
+		currency        TEXT NOT NULL,
+		country         TEXT NOT NULL,
+		expected_amount INTEGER NOT NULL,
+		variance_amount INTEGER NOT NULL,
+		days_to_settle  INTEGER,
+		authorized_at   INTEGER,
+		settled_at      INTEGER,
+		data            TEXT NOT NULL,
+		PRIMARY KEY (run_id, position)
+	);
+	CREATE INDEX idx_run_results_status ON run_results (run_id, status);
+	CREATE INDEX idx_run_results_processor_name ON run_results (run_id, processor_name);
+	CREATE INDEX idx_run_results_currency ON run_results (run_id, currency);
+	CREATE INDEX idx_run_results_country ON run_results (run_id, country);
+	CREATE INDEX idx_run_results_expected_amount ON run_results (run_id, expected_amount);
+	CREATE INDEX idx_run_results_variance_amount ON run_results (run_id, variance_amount);
+	CREATE INDEX idx_run_results_days_to_settle ON run_results (run_id, days_to_settle);
+	CREATE INDEX idx_run_results_authorized_at ON run_results (run_id, authorized_at);
+	CREATE INDEX idx_run_results_settled_at ON run_results (run_id, settled_at);`,
+
+	// Reports move out of the run document, which is rewritten on every
+	// progress update, and are written once. A report stored here has no
+	// results, which are in run_results, except for those moved from runs.
+	`CREATE TABLE run_reports (
+		run_id TEXT PRIMARY KEY,
+		data   TEXT NOT NULL
+	);
+	INSERT INTO run_reports (run_id, data)
+		SELECT id, json_extract(data, '$.report') FROM runs WHERE json_extract(data, '$.report') IS NOT NULL;
+	UPDATE runs SET data = json_remove(data, '$.report');`,
+}
+
+// OpenSQLite opens (creating if needed) the SQLite database at path and migrates it
+// to the latest schema version.
+func OpenSQLite(path string) (*SQLite, error) {
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		return nil, fmt.Errorf("no database/sql driver registered as %q; import modernc.org/sqlite", SQLiteDriver)
+	}
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY between our own goroutines.
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{"PRAGMA journal_mode = WAL", "PRAGMA busy_timeout = 5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", pragma, err)
+		}
+	}
+	s := &SQLite{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close releases the database handle.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, len(migrations))
+	}
+	for v := current + 1; v <= len(migrations); v++ {
+		err := s.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[v-1]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, v, time.Now().UTC().Format(time.RFC3339))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %d: %w", v, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsert inserts or replaces rows by id inside one transaction and returns how many ids were new.
+// Each row is the list of column values in the order of cols, with id first.
+func (s *SQLite) upsert(table string, cols []string, rows [][]any) (int, error) {
+	updates := make([]string, 0, len(cols)-1)
+	for _, c := range cols[1:] {
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", c, c))
+	}
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (?%s) ON CONFLICT (id) DO UPDATE SET %s`,
+		table, strings.Join(cols, ", "), strings.Repeat(", ?", len(cols)-1), strings.Join(updates, ", "))
+	exists := fmt.Sprintf(`SELECT 1 FROM %s WHERE id = ?`, table)
+
+	count := 0
+	err := s.inTx(func(tx *sql.Tx) error {
+		ins, err := tx.Prepare(insert)
+		if err != nil {
+			return err
+		}
+		defer ins.Close()
+		for _, row := range rows {
+			var one int
+			switch err := tx.QueryRow(exists, row[0]).Scan(&one); {
+			case errors.Is(err, sql.ErrNoRows):
+				count++
+			case err != nil:
+				return err
+			}
+			if _, err := ins.Exec(row...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("saving %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// getJSON loads the data document of the row with the given id into dst.
+func (s *SQLite) getJSON(table, id string, dst any) error {
+	var data string
+	err := s.db.QueryRow(fmt.Sprintf(`SELECT data FROM %s WHERE id = ?`, table), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s %s: %w", table, id, err)
+	}
+	return json.Unmarshal([]byte(data), dst)
+}
+
+// listJSON decodes the data document of every row in table, ordered by id.
+func listJSON[T any](db *sql.DB, table string) ([]T, error) {
+	return listJSONWhere[T](db, table, "1 ORDER BY id")
+}
+
+// listJSONWhere decodes the data document of the rows of table selected by
+// the where clause, which may end in an ORDER BY.
+func listJSONWhere[T any](db *sql.DB, table, where string, args ...any) ([]T, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT data FROM %s WHERE %s`, table, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", table, err)
+	}
+	defer rows.Close()
+	result := make([]T, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var v T
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			return nil, fmt.Errorf("decoding %s row: %w", table, err)
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// --- Transactions ---
+
+func (s *SQLite) AddTransactions(txns []models.Transaction) (int, error) {
+	rows := make([][]any, 0, len(txns))
+	for _, t := range txns {
+		data, err := json.Marshal(t)
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, []any{t.ID, t.OrderID, t.ProcessorName, t.ProcessorTxnID, string(data)})
+	}
+	return s.upsert("transactions", []string{"id", "order_id", "processor_name", "processor_txn_id", "data"}, rows)
+}
+
+func (s *SQLite) GetTransaction(id string) (models.Transaction, error) {
+	var t models.Transaction
+	err := s.getJSON("transactions", id, &t)
+	return t, err
+}
+
+func (s *SQLite) ListTransactions() ([]models.Transaction, error) {
+	return listJSON[models.Transaction](s.db, "transactions")
+}
+
+// --- Settlements ---
+
+func (s *SQLite) AddSettlements(recs []models.SettlementRecord) (int, error) {
+	rows := make([][]any, 0, len(recs))
+	for _, r := range recs {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, []any{r.ID, r.ProcessorName, r.ProcessorTxnID, r.OrderReference, string(data)})
+	}
+	return s.upsert("settlements", []string{"id", "processor_name", "processor_txn_id", "order_reference", "data"}, rows)
+}
+
+func (s *SQLite) GetSettlement(id string) (models.SettlementRecord, error) {
+	var r models.SettlementRecord
+	err := s.getJSON("settlements", id, &r)
+	return r, err
+}
+
+func (s *SQLite) ListSettlements() ([]models.SettlementRecord, error) {
+	return listJSON[models.SettlementRecord](s.db, "settlements")
+}
+
+// --- Reconciliation Runs ---
+
+// SaveRun stores the run without its report, which is stored by saveReport
+// the first time the run has one.
+func (s *SQLite) SaveRun(run *models.ReconciliationRun) error {
+	doc := *run
+	doc.Report = nil
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = s.upsert("runs", []string{"id", "created_at", "status", "data"},
+		[][]any{{run.ID, run.CreatedAt.UTC().Format(time.RFC3339Nano), run.Status, string(data)}})
+	if err != nil || run.Report == nil {
+		return err
+	}
+	return s.saveReport(run.ID, run.Report)
+}
+
+// saveReport stores a run's report, unless it is stored already: a report
+// does not change once written. Its results go to run_results, one row each,
+// and the rest of it to run_reports.
+func (s *SQLite) saveReport(runID string, rep *models.ReconciliationReport) error {
+	doc := *rep
+	doc.Results = nil
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	err = s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`INSERT INTO run_reports (run_id, data) VALUES (?, ?) ON CONFLICT (run_id) DO NOTHING`, runID, string(data))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		return insertResults(tx, runID, rep.Results)
+	})
+	if err != nil {
+		return fmt.Errorf("saving report of run %s: %w", runID, err)
+	}
+	return nil
+}
+
+// insertResults adds the rows of a report's results to run_results.
+func insertResults(tx *sql.Tx, runID string, results []models.ReconciliationResult) error {
+	ins, err := tx.Prepare(`INSERT INTO run_results (run_id, position, status, processor_name, currency, country,
+		expected_amount, variance_amount, days_to_settle, authorized_at, settled_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	nullable := func(k resultKey) any {
+		if k.Null {
+			return nil
+		}
+		return k.Value
+	}
+	for pos, r := range results {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = ins.Exec(runID, pos, r.Status, r.ProcessorName, r.Currency, r.Country,
+			r.ExpectedAmount.Units(), r.VarianceAmount.Units(), nullable(resultKeyOf(r, "days_to_settle", pos)),
+			nullable(resultKeyOf(r, "authorized_at", pos)), nullable(resultKeyOf(r, "settled_at", pos)), string(data))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadReport attaches its report, if any, to a run read from runs.
+func (s *SQLite) loadReport(run *models.ReconciliationRun) error {
+	var data string
+	switch err := s.db.QueryRow(`SELECT data FROM run_reports WHERE run_id = ?`, run.ID).Scan(&data); {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("reading report of run %s: %w", run.ID, err)
+	}
+	var rep models.ReconciliationReport
+	if err := json.Unmarshal([]byte(data), &rep); err != nil {
+		return fmt.Errorf("decoding report of run %s: %w", run.ID, err)
+	}
+	if rep.Results == nil {
+		results, err := listJSONWhere[models.ReconciliationResult](s.db, "run_results", "run_id = ? ORDER BY position", run.ID)
+		if err != nil {
+			return err
+		}
+		rep.Results = results
+	}
+	run.Report = &rep
+	return nil
+}
+
+// QueryResults filters, sorts and pages in SQL on the indexed result columns.
+// The results of a run completed before they were stored separately are
+// stored on its first query.
+func (s *SQLite) QueryResults(runID string, q ResultQuery) (ResultPage, error) {
+	after, err := q.decodeCursor()
+	if err != nil {
+		return ResultPage{}, err
+	}
+	var one int
+	switch err := s.db.QueryRow(`SELECT 1 FROM run_results WHERE run_id = ? LIMIT 1`, runID).Scan(&one); {
+	case errors.Is(err, sql.ErrNoRows):
+		run, err := s.GetRun(runID)
+		if err != nil {
+			return ResultPage{}, err
+		}
+		if run.Report == nil {
+			return ResultPage{}, ErrNotFound
+		}
+		err = s.inTx(func(tx *sql.Tx) error { return insertResults(tx, runID, run.Report.Results) })
+		if err != nil {
+			return ResultPage{}, fmt.Errorf("saving results of run %s: %w", runID, err)
+		}
+	case err != nil:
+		return ResultPage{}, fmt.Errorf("reading results of run %s: %w", runID, err)
+	}
+
+	where, args := []string{"run_id = ?"}, []any{runID}
+	for _, col := range resultFilterColumns {
+		if values := col.values(q); len(values) > 0 {
+			where = append(where, fmt.Sprintf("%s IN (?%s)", col.name, strings.Repeat(", ?", len(values)-1)))
+			for _, v := range values {
+				args = append(args, v)
+			}
+		}
+	}
+	for _, rg := range []struct {
+		col      string
+		min, max *int64
+	}{
+		{"variance_amount", amountUnits(q.MinVariance), amountUnits(q.MaxVariance)},
+		{"days_to_settle", intValue(q.MinDaysToSettle), intValue(q.MaxDaysToSettle)},
+		{"authorized_at", timeNanos(q.AuthorizedFrom), timeNanos(q.AuthorizedTo)},
+		{"settled_at", timeNanos(q.SettledFrom), timeNanos(q.SettledTo)},
+	} {
+		if rg.min != nil {
+			where, args = append(where, rg.col+" >= ?"), append(args, *rg.min)
+		}
+		if rg.max != nil {
+			where, args = append(where, rg.col+" <= ?"), append(args, *rg.max)
+		}
+	}
+
+	page := ResultPage{Results: []models.ReconciliationResult{}}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM run_results WHERE `+strings.Join(where, " AND "), args...).Scan(&page.Total); err != nil {
+		return ResultPage{}, fmt.Errorf("counting results of run %s: %w", runID, err)
+	}
+
+	// Results without a value for the sort field come last, ties in report
+	// order, as resultKey.before orders them; the cursor continues after the
+	// last key of the previous page.
+	field, desc := q.sortField()
+	order := "position"
+	if field != "" {
+		dir, cmp := "ASC", ">"
+		if desc {
+			dir, cmp = "DESC", "<"
+		}
+		order = fmt.Sprintf("%s IS NULL, %s %s, position", field, field, dir)
+		if after != nil && after.Null {
+			where, args = append(where, field+" IS NULL AND position > ?"), append(args, after.Position)
+		} else if after != nil {
+			where = append(where, fmt.Sprintf("(%s IS NULL OR %s %s ? OR (%s = ? AND position > ?))", field, field, cmp, field))
+			args = append(args, after.Value, after.Value, after.Position)
+		}
+	} else if after != nil {
+		where, args = append(where, "position > ?"), append(args, after.Position)
+	}
+	query := `SELECT position, data FROM run_results WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + order
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit+1)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return ResultPage{}, fmt.Errorf("querying results of run %s: %w", runID, err)
+	}
+	defer rows.Close()
+	var last resultKey
+	for rows.Next() {
+		var pos int
+		var data string
+		if err := rows.Scan(&pos, &data); err != nil {
+			return ResultPage{}, err
+		}
+		if q.Limit > 0 && len(page.Results) == q.Limit {
+			page.NextCursor = encodeCursor(q.Sort, last)
+			break
+		}
+		var r models.ReconciliationResult
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return ResultPage{}, fmt.Errorf("decoding run_results row: %w", err)
+		}
+		page.Results = append(page.Results, r)
+		last = resultKeyOf(r, field, pos)
+	}
+	return page, rows.Err()
+}
+
+func (s *SQLite) GetRun(id string) (*models.ReconciliationRun, error) {
+	run, err := s.GetRunInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadReport(run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetRunInfo reads only the run's row, not run_reports or run_results.
+func (s *SQLite) GetRunInfo(id string) (*models.ReconciliationRun, error) {
+	var run models.ReconciliationRun
+	if err := s.getJSON("runs", id, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *SQLite) ListRuns() ([]*models.ReconciliationRun, error) {
+	return listJSON[*models.ReconciliationRun](s.db, "runs")
+}
+
+func (s *SQLite) SaveRunInputs(runID string, in models.RunInputs) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return s.inTx(func(tx *sql.Tx) error {
+		var one int
+		switch err := tx.QueryRow(`SELECT 1 FROM run_inputs WHERE run_id = ?`, runID).Scan(&one); {
+		case err == nil:
+			return ErrExists
+		case !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("reading run_inputs %s: %w", runID, err)
+		}
+		_, err := tx.Exec(`INSERT INTO run_inputs (run_id, data) VALUES (?, ?)`, runID, string(data))
+		return err
+	})
+}
+
+func (s *SQLite) GetRunInputs(runID string) (models.RunInputs, error) {
+	var in models.RunInputs
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM run_inputs WHERE run_id = ?`, runID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return in, ErrNotFound
+	}
+	if err != nil {
+		return in, fmt.Errorf("reading run_inputs %s: %w", runID, err)
+	}
+	err = json.Unmarshal([]byte(data), &in)
+	return in, err
+}
+
+// --- FX Rates ---
+
+func (s *SQLite) AddFXRates(rates []models.FXRate) (int, error) {
+	rows := make([][]any, 0, len(rates))
+	for _, r := range rates {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, []any{fxRateID(r), r.From, r.To, r.Date.UTC().Format(time.DateOnly), string(data)})
+	}
+	return s.upsert("fx_rates", []string{"id", "from_currency", "to_currency", "date", "data"}, rows)
+}
+
+func (s *SQLite) ListFXRates() ([]models.FXRate, error) {
+	return listJSON[models.FXRate](s.db, "fx_rates")
+}
+
+// Clear removes all data from the store. The schema is kept.
+func (s *SQLite) Clear() error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, table := range []string{"transactions", "settlements", "runs", "run_inputs", "fx_rates", "run_results", "run_reports"} {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return fmt.Errorf("clearing %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,4 @@
+package store
+
+// Register the driver so the shared store tests also exercise the SQLite backend.
+import _ "modernc.org/sqlite"
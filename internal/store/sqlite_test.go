@@ -0,0 +1,94 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+)
+
+// TestSQLiteReportIsWrittenOnce checks that saving a run with a report keeps
+// the report out of the run document, which every progress update rewrites.
+func TestSQLiteReportIsWrittenOnce(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	run := &models.ReconciliationRun{ID: "RUN-0001", Status: "completed", Report: &models.ReconciliationReport{
+		RunID:   "RUN-0001",
+		Results: []models.ReconciliationResult{{ID: "R0", Status: models.StatusMatched}},
+	}}
+	if err := s.SaveRun(run); err != nil {
+		t.Fatal(err)
+	}
+	run.Report.RunID = "changed"
+	if err := s.SaveRun(run); err != nil {
+		t.Fatal(err)
+	}
+
+	var runData, reportData string
+	if err := s.db.QueryRow(`SELECT data FROM runs WHERE id = 'RUN-0001'`).Scan(&runData); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(runData, `"report"`) {
+		t.Errorf("run document contains the report: %s", runData)
+	}
+	if err := s.db.QueryRow(`SELECT data FROM run_reports WHERE run_id = 'RUN-0001'`).Scan(&reportData); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(reportData, `"R0"`) || !strings.Contains(reportData, `"RUN-0001"`) {
+		t.Errorf("expected the first report without its results, got %s", reportData)
+	}
+}
+
+// TestSQLiteMigratesReportsOutOfRuns opens a database written before reports
+// were stored apart from runs.
+func TestSQLiteMigratesReportsOutOfRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	db, err := sql.Open(SQLiteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const before = 5 // schema version before run_reports
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)`)
+	for v := 1; v <= before && err == nil; v++ {
+		if _, err = db.Exec(migrations[v-1]); err == nil {
+			_, err = db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, '')`, v)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+	legacy, _ := json.Marshal(models.ReconciliationRun{ID: "RUN-0001", Status: "completed", Report: &models.ReconciliationReport{
+		RunID:   "RUN-0001",
+		Results: []models.ReconciliationResult{{ID: "R0", Status: models.StatusMatched, SettledAt: &day}, {ID: "R1", Status: models.StatusUnsettled}},
+	}})
+	if _, err := db.Exec(`INSERT INTO runs (id, created_at, status, data) VALUES ('RUN-0001', '', 'completed', ?)`, string(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	run, err := s.GetRun("RUN-0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Report == nil || len(run.Report.Results) != 2 || !run.Report.Results[0].SettledAt.Equal(day) {
+		t.Fatalf("report not migrated: %+v", run.Report)
+	}
+	page, err := s.QueryResults("RUN-0001", ResultQuery{Sort: "settled_at"})
+	if err != nil || page.Total != 2 || page.Results[0].ID != "R0" {
+		t.Errorf("QueryResults = %+v, %v", page, err)
+	}
+}
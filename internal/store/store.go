@@ -1,148 +1,63 @@
 package store
 
 import (
-	"fmt"
-	"sync"
+	"errors"
+	"time"
 
 	"github.com/denys-rosario/settlement-reconciler/internal/models"
 )
 
-// Store is a thread-safe in-memory data store for transactions,
-// settlements, and reconciliation runs.
-type Store struct {
-	mu           sync.RWMutex
-	transactions map[string]models.Transaction   // keyed by ID
-	settlements  map[string]models.SettlementRecord // keyed by ID
-	runs         map[string]*models.ReconciliationRun
-}
-
-func New() *Store {
-	return &Store{
-		transactions: make(map[string]models.Transaction),
-		settlements:  make(map[string]models.SettlementRecord),
-		runs:         make(map[string]*models.ReconciliationRun),
-	}
-}
-
-// --- Transactions ---
-
-func (s *Store) AddTransactions(txns []models.Transaction) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	count := 0
-	for _, t := range txns {
-		if _, exists := s.transactions[t.ID]; !exists {
-			count++
-		}
-		s.transactions[t.ID] = t
-	}
-	return count
-}
-
-func (s *Store) GetTransaction(id string) (models.Transaction, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	t, ok := s.transactions[id]
-	return t, ok
-}
-
-func (s *Store) ListTransactions() []models.Transaction {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	result := make([]models.Transaction, 0, len(s.transactions))
-	for _, t := range s.transactions {
-		result = append(result, t)
-	}
-	return result
-}
-
-// --- Settlements ---
-
-func (s *Store) AddSettlements(recs []models.SettlementRecord) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	count := 0
-	for _, r := range recs {
-		if _, exists := s.settlements[r.ID]; !exists {
-			count++
-		}
-		s.settlements[r.ID] = r
-	}
-	return count
-}
-
-func (s *Store) GetSettlement(id string) (models.SettlementRecord, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	r, ok := s.settlements[id]
-	return r, ok
-}
-
-func (s *Store) ListSettlements() []models.SettlementRecord {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	result := make([]models.SettlementRecord, 0, len(s.settlements))
-	for _, r := range s.settlements {
-		result = append(result, r)
-	}
-	return result
-}
-
-// --- Reconciliation Runs ---
-
-func (s *Store) SaveRun(run *models.ReconciliationRun) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.runs[run.ID] = run
-}
-
-func (s *Store) GetRun(id string) (*models.ReconciliationRun, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	r, ok := s.runs[id]
-	return r, ok
-}
-
-func (s *Store) ListRuns() []*models.ReconciliationRun {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	result := make([]*models.ReconciliationRun, 0, len(s.runs))
-	for _, r := range s.runs {
-		result = append(result, r)
-	}
-	return result
-}
-
-// --- Lookup helpers used by the reconciler ---
-
-// TransactionsByProcessorTxnID builds an index of processor_name:processor_txn_id -> Transaction.
-func (s *Store) TransactionsByProcessorTxnID() map[string]models.Transaction {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	idx := make(map[string]models.Transaction, len(s.transactions))
-	for _, t := range s.transactions {
-		key := fmt.Sprintf("%s:%s", t.ProcessorName, t.ProcessorTxnID)
-		idx[key] = t
-	}
-	return idx
-}
-
-// TransactionsByOrderID builds an index of order_id -> Transaction.
-func (s *Store) TransactionsByOrderID() map[string]models.Transaction {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	idx := make(map[string]models.Transaction, len(s.transactions))
-	for _, t := range s.transactions {
-		idx[t.OrderID] = t
-	}
-	return idx
-}
+var (
+	// ErrNotFound is returned when a record with the requested ID does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned when writing data that may only be written once.
+	ErrExists = errors.New("already exists")
+)
 
-// Clear removes all data from the store.
-func (s *Store) Clear() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.transactions = make(map[string]models.Transaction)
-	s.settlements = make(map[string]models.SettlementRecord)
-	s.runs = make(map[string]*models.ReconciliationRun)
+// Store persists transactions, settlements, and reconciliation runs.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// AddTransactions inserts or replaces transactions by ID and returns how many were new.
+	AddTransactions(txns []models.Transaction) (int, error)
+	GetTransaction(id string) (models.Transaction, error)
+	ListTransactions() ([]models.Transaction, error)
+
+	// AddSettlements inserts or replaces settlement records by ID and returns how many were new.
+	AddSettlements(recs []models.SettlementRecord) (int, error)
+	GetSettlement(id string) (models.SettlementRecord, error)
+	ListSettlements() ([]models.SettlementRecord, error)
+
+	// SaveRun inserts or replaces a run. A run saved without a report keeps
+	// the report it has.
+	SaveRun(run *models.ReconciliationRun) error
+	// GetRun returns a run with its report.
+	GetRun(id string) (*models.ReconciliationRun, error)
+	// GetRunInfo returns a run without its report, for callers that only
+	// need its status or snapshot.
+	GetRunInfo(id string) (*models.ReconciliationRun, error)
+	// ListRuns returns all runs without their reports; use GetRun to load one.
+	ListRuns() ([]*models.ReconciliationRun, error)
+	// QueryResults returns a page of the results of a run's report, filtered
+	// and sorted per q. It returns ErrNotFound until the run has a report, and
+	// ErrInvalidCursor for a cursor issued for another sort.
+	QueryResults(runID string, q ResultQuery) (ResultPage, error)
+
+	// SaveRunInputs records the input records of a run. Inputs are immutable:
+	// saving them twice for the same run returns ErrExists.
+	SaveRunInputs(runID string, in models.RunInputs) error
+	GetRunInputs(runID string) (models.RunInputs, error)
+
+	// AddFXRates inserts or replaces dated FX rates by currency pair and date
+	// and returns how many were new.
+	AddFXRates(rates []models.FXRate) (int, error)
+	// ListFXRates returns all dated FX rates ordered by pair and date.
+	ListFXRates() ([]models.FXRate, error)
+
+	// Clear removes all data from the store.
+	Clear() error
+}
+
+// fxRateID identifies a dated FX rate by currency pair and day; IDs sort by pair, then date.
+func fxRateID(r models.FXRate) string {
+	return r.From + ":" + r.To + ":" + r.Date.UTC().Format(time.DateOnly)
 }
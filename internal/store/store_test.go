@@ -0,0 +1,340 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/denys-rosario/settlement-reconciler/internal/models"
+	"github.com/denys-rosario/settlement-reconciler/internal/money"
+)
+
+// backends returns a fresh instance of every Store implementation.
+func backends(t *testing.T) map[string]Store {
+	t.Helper()
+	if !slices.Contains(sql.Drivers(), SQLiteDriver) {
+		t.Fatalf("SQLite driver %q is not registered", SQLiteDriver)
+	}
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return map[string]Store{"memory": New(), "sqlite": s}
+}
+
+func TestStoreTransactions(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			txns := []models.Transaction{
+				{ID: "TXN-2", OrderID: "ORD-2", ProcessorName: "P", ProcessorTxnID: "P-2", Amount: money.MustParse("20.50"), Currency: "USD"},
+				{ID: "TXN-1", OrderID: "ORD-1", ProcessorName: "P", ProcessorTxnID: "P-1", Amount: money.MustParse("10"), Currency: "USD"},
+			}
+			if n, err := s.AddTransactions(txns); err != nil || n != 2 {
+				t.Fatalf("AddTransactions = %d, %v; want 2, nil", n, err)
+			}
+			txns[0].Amount = money.MustParse("21")
+			if n, err := s.AddTransactions(txns[:1]); err != nil || n != 0 {
+				t.Fatalf("re-adding existing ID = %d, %v; want 0, nil", n, err)
+			}
+
+			got, err := s.GetTransaction("TXN-2")
+			if err != nil {
+				t.Fatalf("GetTransaction: %v", err)
+			}
+			if got.Amount != money.MustParse("21") {
+				t.Errorf("expected upserted amount 21.00, got %s", got.Amount)
+			}
+			if _, err := s.GetTransaction("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			list, err := s.ListTransactions()
+			if err != nil || len(list) != 2 {
+				t.Fatalf("ListTransactions = %d items, %v; want 2", len(list), err)
+			}
+		})
+	}
+}
+
+func TestStoreSettlements(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			recs := []models.SettlementRecord{
+				{ID: "S-1", ProcessorName: "P", ProcessorTxnID: "P-1", GrossAmount: money.MustParse("10"), NetAmount: money.MustParse("9.70"), FeeAmount: money.MustParse("0.30"), Currency: "USD"},
+			}
+			if n, err := s.AddSettlements(recs); err != nil || n != 1 {
+				t.Fatalf("AddSettlements = %d, %v; want 1, nil", n, err)
+			}
+			got, err := s.GetSettlement("S-1")
+			if err != nil {
+				t.Fatalf("GetSettlement: %v", err)
+			}
+			if got.NetAmount != money.MustParse("9.70") {
+				t.Errorf("expected net 9.70, got %s", got.NetAmount)
+			}
+			if _, err := s.GetSettlement("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreRunsAndClear(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			run := &models.ReconciliationRun{ID: "RUN-0001", CreatedAt: time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC), Status: "running"}
+			if err := s.SaveRun(run); err != nil {
+				t.Fatalf("SaveRun: %v", err)
+			}
+			run.Status = "completed"
+			if err := s.SaveRun(run); err != nil {
+				t.Fatalf("SaveRun: %v", err)
+			}
+			got, err := s.GetRun("RUN-0001")
+			if err != nil {
+				t.Fatalf("GetRun: %v", err)
+			}
+			if got.Status != "completed" {
+				t.Errorf("expected status completed, got %s", got.Status)
+			}
+			runs, err := s.ListRuns()
+			if err != nil || len(runs) != 1 {
+				t.Fatalf("ListRuns = %d items, %v; want 1", len(runs), err)
+			}
+
+			if _, err := s.AddTransactions([]models.Transaction{{ID: "TXN-1"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Clear(); err != nil {
+				t.Fatalf("Clear: %v", err)
+			}
+			if _, err := s.GetRun("RUN-0001"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected run to be cleared, got %v", err)
+			}
+			if list, _ := s.ListTransactions(); len(list) != 0 {
+				t.Errorf("expected no transactions after Clear, got %d", len(list))
+			}
+		})
+	}
+}
+
+func TestStoreRunReport(t *testing.T) {
+	rep := &models.ReconciliationReport{
+		RunID:   "RUN-0001",
+		Summary: models.ReportSummary{TotalTransactions: 2},
+		Results: []models.ReconciliationResult{{ID: "R0", Status: models.StatusMatched}, {ID: "R1", Status: models.StatusUnsettled}},
+	}
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			run := &models.ReconciliationRun{ID: "RUN-0001", Status: "running", Progress: 100, Report: rep}
+			if err := s.SaveRun(run); err != nil {
+				t.Fatal(err)
+			}
+			// Later saves update the run and keep the report it has.
+			run.Status = "completed"
+			if err := s.SaveRun(run); err != nil {
+				t.Fatal(err)
+			}
+			// Runs are listed and looked up without their reports, and saving
+			// one of those keeps the report.
+			info, err := s.GetRunInfo("RUN-0001")
+			if err != nil {
+				t.Fatal(err)
+			}
+			runs, err := s.ListRuns()
+			if err != nil || len(runs) != 1 {
+				t.Fatalf("ListRuns = %d items, %v; want 1", len(runs), err)
+			}
+			for _, got := range []*models.ReconciliationRun{info, runs[0]} {
+				if got.Status != "completed" || got.Report != nil {
+					t.Fatalf("got status %s, report %v; want completed without report", got.Status, got.Report)
+				}
+			}
+			info.Progress = 99
+			if err := s.SaveRun(info); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.GetRun("RUN-0001")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Progress != 99 || got.Report == nil {
+				t.Fatalf("got progress %d, report %v", got.Progress, got.Report)
+			}
+			if got.Report.Summary.TotalTransactions != 2 || len(got.Report.Results) != 2 || got.Report.Results[1].ID != "R1" {
+				t.Errorf("report not kept: %+v", got.Report)
+			}
+		})
+	}
+}
+
+func TestStoreRunInputsAreWriteOnce(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			in := models.RunInputs{
+				Transactions: []models.Transaction{{ID: "TXN-1", Amount: money.MustParse("10")}},
+				Settlements:  []models.SettlementRecord{{ID: "S-1", GrossAmount: money.MustParse("10")}},
+			}
+			if _, err := s.GetRunInputs("RUN-0001"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+			if err := s.SaveRunInputs("RUN-0001", in); err != nil {
+				t.Fatalf("SaveRunInputs: %v", err)
+			}
+			if err := s.SaveRunInputs("RUN-0001", models.RunInputs{}); !errors.Is(err, ErrExists) {
+				t.Errorf("expected ErrExists on second save, got %v", err)
+			}
+			got, err := s.GetRunInputs("RUN-0001")
+			if err != nil {
+				t.Fatalf("GetRunInputs: %v", err)
+			}
+			if len(got.Transactions) != 1 || len(got.Settlements) != 1 || got.Transactions[0].Amount != money.MustParse("10") {
+				t.Errorf("unexpected inputs: %+v", got)
+			}
+		})
+	}
+}
+
+func TestStoreFXRates(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			jan := func(day int) time.Time { return time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC) }
+			rates := []models.FXRate{
+				{From: "MXN", To: "USD", Date: jan(15), Rate: 0.059},
+				{From: "BRL", To: "USD", Date: jan(2), Rate: 0.20},
+				{From: "MXN", To: "USD", Date: jan(2), Rate: 0.058},
+			}
+			if n, err := s.AddFXRates(rates); err != nil || n != 3 {
+				t.Fatalf("AddFXRates = %d, %v; want 3, nil", n, err)
+			}
+			if n, err := s.AddFXRates([]models.FXRate{{From: "MXN", To: "USD", Date: jan(15), Rate: 0.06}}); err != nil || n != 0 {
+				t.Fatalf("re-adding a pair and date = %d, %v; want 0, nil", n, err)
+			}
+
+			got, err := s.ListFXRates()
+			if err != nil {
+				t.Fatalf("ListFXRates: %v", err)
+			}
+			want := []models.FXRate{
+				{From: "BRL", To: "USD", Date: jan(2), Rate: 0.20},
+				{From: "MXN", To: "USD", Date: jan(2), Rate: 0.058},
+				{From: "MXN", To: "USD", Date: jan(15), Rate: 0.06},
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("ListFXRates = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestStoreQueryResults(t *testing.T) {
+	day := func(d int) *time.Time { t := time.Date(2025, 1, d, 12, 0, 0, 0, time.UTC); return &t }
+	days := func(n int) *int { return &n }
+	results := []models.ReconciliationResult{
+		{ID: "R0", Status: models.StatusMatched, ProcessorName: "A", Currency: "MXN", Country: "MX", VarianceAmount: money.MustParse("0"), AuthorizedAt: day(1), SettledAt: day(3), DaysToSettle: days(2)},
+		{ID: "R1", Status: models.StatusMatchedWithVariance, ProcessorName: "A", Currency: "MXN", Country: "MX", VarianceAmount: money.MustParse("-12.5"), AuthorizedAt: day(2), SettledAt: day(4), DaysToSettle: days(2)},
+		{ID: "R2", Status: models.StatusUnsettled, ProcessorName: "B", Currency: "BRL", Country: "BR", VarianceAmount: money.MustParse("-100"), AuthorizedAt: day(2)},
+		{ID: "R3", Status: models.StatusMatchedWithVariance, ProcessorName: "B", Currency: "BRL", Country: "BR", VarianceAmount: money.MustParse("3"), AuthorizedAt: day(5), SettledAt: day(12), DaysToSettle: days(7)},
+		{ID: "R4", Status: models.StatusUnexpectedSettlement, ProcessorName: "A", Currency: "MXN", Country: "MX", VarianceAmount: money.MustParse("50"), SettledAt: day(6)},
+	}
+	ids := func(page ResultPage) []string {
+		var out []string
+		for _, r := range page.Results {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			run := &models.ReconciliationRun{ID: "RUN-0001", Status: "running"}
+			if err := s.SaveRun(run); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.QueryResults("RUN-0001", ResultQuery{}); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected ErrNotFound before the report, got %v", err)
+			}
+			run.Status, run.Report = "completed", &models.ReconciliationReport{Results: results}
+			if err := s.SaveRun(run); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name string
+				q    ResultQuery
+				want []string
+			}{
+				{"all in report order", ResultQuery{}, []string{"R0", "R1", "R2", "R3", "R4"}},
+				{"status", ResultQuery{Statuses: []models.ReconciliationStatus{models.StatusMatchedWithVariance, models.StatusUnsettled}}, []string{"R1", "R2", "R3"}},
+				{"processor and currency", ResultQuery{Processors: []string{"A"}, Currencies: []string{"MXN", "USD"}}, []string{"R0", "R1", "R4"}},
+				{"no match", ResultQuery{Processors: []string{"A"}, Countries: []string{"BR"}}, nil},
+				{"variance range", ResultQuery{MinVariance: ptr(money.MustParse("-20")), MaxVariance: ptr(money.MustParse("3"))}, []string{"R0", "R1", "R3"}},
+				{"days to settle", ResultQuery{MinDaysToSettle: days(3)}, []string{"R3"}},
+				{"settled range", ResultQuery{SettledFrom: day(4), SettledTo: day(6)}, []string{"R1", "R4"}},
+				{"authorized range", ResultQuery{AuthorizedTo: day(2)}, []string{"R0", "R1", "R2"}},
+				{"variance ascending", ResultQuery{Sort: "variance_amount"}, []string{"R2", "R1", "R0", "R3", "R4"}},
+				{"days descending, missing last", ResultQuery{Sort: "-days_to_settle"}, []string{"R3", "R0", "R1", "R2", "R4"}},
+			}
+			for _, tt := range tests {
+				page, err := s.QueryResults("RUN-0001", tt.q)
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+				if got := ids(page); !slices.Equal(got, tt.want) || page.Total != len(tt.want) || page.NextCursor != "" {
+					t.Errorf("%s: got %v (total %d, cursor %q), want %v", tt.name, got, page.Total, page.NextCursor, tt.want)
+				}
+			}
+
+			// Every sort, paged at any size, ends its pages at the same results
+			// and with the same cursors as the in-memory index: missing values
+			// last, ties in report order. Each result is visited once.
+			index := newResultIndex(results)
+			sorts := []string{""}
+			for _, field := range ResultSortFields {
+				sorts = append(sorts, field, "-"+field)
+			}
+			for _, sort := range sorts {
+				for limit := 1; limit <= 3; limit++ {
+					q := ResultQuery{Sort: sort, Limit: limit}
+					var got []string
+					for {
+						page, err := s.QueryResults("RUN-0001", q)
+						if err != nil {
+							t.Fatalf("sort %q: %v", sort, err)
+						}
+						want, _ := index.query(q)
+						if !slices.Equal(ids(page), ids(want)) || page.NextCursor != want.NextCursor || page.Total != 5 {
+							t.Fatalf("sort %q, limit %d, cursor %q: got %v (total %d, next %q), want %v (next %q)",
+								sort, limit, q.Cursor, ids(page), page.Total, page.NextCursor, ids(want), want.NextCursor)
+						}
+						got = append(got, ids(page)...)
+						if page.NextCursor == "" {
+							break
+						}
+						q.Cursor = page.NextCursor
+					}
+					if all, _ := index.query(ResultQuery{Sort: sort}); !slices.Equal(got, ids(all)) {
+						t.Errorf("sort %q, limit %d: paged %v, want %v", sort, limit, got, ids(all))
+					}
+				}
+			}
+			if all, _ := s.QueryResults("RUN-0001", ResultQuery{Sort: "-settled_at"}); !slices.Equal(ids(all), []string{"R3", "R4", "R1", "R0", "R2"}) {
+				t.Errorf("settled descending: got %v, want missing last", ids(all))
+			}
+
+			first, _ := s.QueryResults("RUN-0001", ResultQuery{Sort: "variance_amount", Limit: 1})
+			if _, err := s.QueryResults("RUN-0001", ResultQuery{Sort: "expected_amount", Cursor: first.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor for a cursor of another sort, got %v", err)
+			}
+			if _, err := s.QueryResults("RUN-0001", ResultQuery{Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }